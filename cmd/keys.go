@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"go-api/internal/keys"
+)
+
+// keysUsage describes the keys subcommand
+const keysUsage = `Usage: api-server keys <command> [flags]
+
+Commands:
+  generate  create a new API key, print it once and store only its hash
+  hash      replace the plain text keys in the key file with salted hashes
+  import    copy the keys of a key file into the key store, skipping keys it already holds
+
+Run 'api-server keys <command> -h' for the flags of a command.
+`
+
+// runKeys runs the keys subcommand and returns the process exit code
+func runKeys(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "generate":
+		return runKeysGenerate(args[1:])
+	case "hash":
+		return runKeysHash(args[1:])
+	case "import":
+		return runKeysImport(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown keys command %q\n\n%s", args[0], keysUsage)
+		return 2
+	}
+}
+
+// runKeysGenerate creates a key, adds its hash to the key store and prints the key
+func runKeysGenerate(args []string) int {
+	flags := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	backend := flags.String("backend", keysBackend(), "key store backend, file or bolt")
+	file := flags.String("file", "", "key file or database to add the key to (default from API_KEYS_FILE or API_KEYS_DB)")
+	owner := flags.String("owner", "", "person or service the key is issued to")
+	team := flags.String("team", "", "team the owner belongs to")
+	label := flags.String("label", "", "what the key is used for")
+	tier := flags.String("tier", "", "rate limit tier")
+	models := flags.String("models", "", "comma-separated models the key may use, * matches any suffix (default all)")
+	maxTokens := flags.Int("max-tokens", 0, "largest max_tokens a request may ask for (default no cap)")
+	features := flags.String("features", "", "comma-separated features the key may use: streaming, tools (default all)")
+	expiresIn := flags.Duration("expires-in", 0, "how long until the key expires, e.g. 720h (default never)")
+	auditOptOut := flags.Bool("audit-opt-out", false, "keep the key's requests out of the audit log")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	secret, err := keys.Generate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate key: %v\n", err)
+		return 1
+	}
+	key, err := keys.NewHashedKey(secret)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to hash key: %v\n", err)
+		return 1
+	}
+
+	key.Owner = *owner
+	key.Team = *team
+	key.Label = *label
+	key.RateLimitTier = *tier
+	key.AllowedModels = splitList(*models)
+	key.MaxTokens = *maxTokens
+	key.AllowedFeatures = splitList(*features)
+	key.AuditOptOut = *auditOptOut
+	if *expiresIn > 0 {
+		key.ExpiresAt = key.CreatedAt.Add(*expiresIn)
+	}
+
+	if *file == "" {
+		*file = keyStorePath(*backend)
+	}
+	store, err := keys.OpenBackend(*backend, *file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open %s: %v\n", *file, err)
+		return 1
+	}
+	defer store.Close()
+
+	if err := store.Save(key); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", *file, err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Added key %s (%s) to %s. It is shown only once, so store it now:\n", key.ID, key.Prefix, *file)
+	fmt.Println(secret)
+	return 0
+}
+
+// runKeysHash hashes the plain text keys in the key file
+func runKeysHash(args []string) int {
+	flags := flag.NewFlagSet("keys hash", flag.ContinueOnError)
+	file := flags.String("file", apiKeysFile(), "key file to hash")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	n, err := keys.HashFile(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to hash %s: %v\n", *file, err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Hashed %d plain text keys in %s\n", n, *file)
+	return 0
+}
+
+// runKeysImport copies the keys of a key file into the key store, such as a
+// BoltDB database taking over from the file
+func runKeysImport(args []string) int {
+	flags := flag.NewFlagSet("keys import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: api-server keys import [flags] <key file>")
+		flags.PrintDefaults()
+	}
+	backend := flags.String("backend", keysBackend(), "key store backend to import into, file or bolt")
+	file := flags.String("file", "", "key file or database to import into (default from API_KEYS_FILE or API_KEYS_DB)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	source := flags.Arg(0)
+
+	if *file == "" {
+		*file = keyStorePath(*backend)
+	}
+	dst, err := keys.OpenBackend(*backend, *file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open %s: %v\n", *file, err)
+		return 1
+	}
+	defer dst.Close()
+
+	n, err := keys.Import(dst, keys.NewFileBackend(source))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to import %s into %s: %v\n", source, *file, err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d keys from %s into %s\n", n, source, *file)
+	return 0
+}
+
+// splitList splits a comma-separated flag value, returning nil for an empty one
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// apiKeysFile returns the key file path from API_KEYS_FILE, or DefaultAPIKeysFile
+func apiKeysFile() string {
+	if path := os.Getenv("API_KEYS_FILE"); path != "" {
+		return path
+	}
+	return DefaultAPIKeysFile
+}
+
+// keysBackend returns the key store backend from KEYS_BACKEND, or the key file
+func keysBackend() string {
+	if backend := os.Getenv("KEYS_BACKEND"); backend != "" {
+		return backend
+	}
+	return keys.BackendFile
+}
+
+// keyStorePath returns where the given backend keeps its keys
+func keyStorePath(backend string) string {
+	if backend != keys.BackendBolt {
+		return apiKeysFile()
+	}
+	if path := os.Getenv("API_KEYS_DB"); path != "" {
+		return path
+	}
+	return DefaultAPIKeysDB
+}
@@ -19,16 +19,37 @@ package main
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
-// @description API key authentication with Bearer prefix (e.g., "Bearer your-api-key"). The 'Bearer ' prefix is REQUIRED - requests without it will be rejected.
+// @description API key or, when OIDC_ISSUER is set, JWT authentication with Bearer prefix (e.g., "Bearer your-api-key"). The 'Bearer ' prefix is REQUIRED - requests without it will be rejected.
+
+// @securityDefinitions.apikey AdminAuth
+// @in header
+// @name Authorization
+// @description Admin token from ADMIN_API_KEY with Bearer prefix (e.g., "Bearer your-admin-token"). Required for the /admin routes.
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	// Import swagger docs
 	"go-api/docs/swagger"
+	"go-api/internal/api"
+	"go-api/internal/apierror"
+	"go-api/internal/audit"
+	"go-api/internal/billing"
+	"go-api/internal/keys"
 	"go-api/internal/middleware"
+	"go-api/internal/oidc"
+	"go-api/internal/ratelimit"
+	"go-api/internal/requestid"
 	"go-api/internal/routes"
+	"go-api/internal/tracing"
+	"go-api/internal/usage"
+	"go-api/pkg/provider"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
@@ -38,9 +59,41 @@ import (
 const (
 	// DefaultPort is the port used when no PORT environment variable is set
 	DefaultPort = "8082"
+
+	// DefaultProvidersConfig is the provider config used when no PROVIDERS_CONFIG environment variable is set
+	DefaultProvidersConfig = "providers.yaml"
+
+	// DefaultAPIKeysFile is the key file used when no API_KEYS_FILE environment variable is set
+	DefaultAPIKeysFile = "api-keys.yaml"
+
+	// DefaultAPIKeysDB is the key database used by the bolt backend when no API_KEYS_DB environment variable is set
+	DefaultAPIKeysDB = "api-keys.db"
+
+	// DefaultRateLimitsFile is the rate limit config used when no RATE_LIMITS_FILE environment variable is set
+	DefaultRateLimitsFile = "rate-limits.yaml"
+
+	// DefaultRedisURL is the Redis server used by the redis rate limiter backend when no REDIS_URL environment variable is set
+	DefaultRedisURL = "redis://localhost:6379/0"
+
+	// DefaultPricingFile is the model price list used when no PRICING_FILE environment variable is set
+	DefaultPricingFile = "pricing.yaml"
+
+	// DefaultLedgerDB is the spend ledger used when no LEDGER_DB environment variable is set
+	DefaultLedgerDB = "ledger.db"
+
+	// DefaultUsageDB is the usage store used when no USAGE_DB environment variable is set
+	DefaultUsageDB = "usage.db"
+
+	// DefaultAuditConfig is the audit log config used when no AUDIT_CONFIG environment variable is set
+	DefaultAuditConfig = "audit.yaml"
 )
 
 func main() {
+	// api-server keys ... manages the key file instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		os.Exit(runKeys(os.Args[2:]))
+	}
+
 	// Load environment variables from .env file if present
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: .env file not found, using environment variables")
@@ -60,16 +113,136 @@ func main() {
 		swagger.SwaggerInfo.Schemes = []string{"http", "https"}
 	}
 
-	// Create Echo instance
+	// Trace requests, exporting spans over OTLP if OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to configure tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+	if tracing.Enabled() {
+		log.Printf("Exporting traces over OTLP")
+	}
+
+	// Load the model to provider mapping
+	providersConfig := os.Getenv("PROVIDERS_CONFIG")
+	if providersConfig == "" {
+		providersConfig = DefaultProvidersConfig
+	}
+	config, err := provider.LoadConfig(providersConfig)
+	if err != nil {
+		log.Fatalf("Failed to load provider config: %v", err)
+	}
+
+	// Open the usage store, which the chat handler records every completion in
+	usageDB := os.Getenv("USAGE_DB")
+	if usageDB == "" {
+		usageDB = DefaultUsageDB
+	}
+	usageStore, err := usage.OpenStore(usageDB)
+	if err != nil {
+		log.Fatalf("Failed to open the usage store: %v", err)
+	}
+	defer usageStore.Close()
+
+	// Write an audit log of every completion, if the audit config enables it
+	auditLog, err := openAuditLog()
+	if err != nil {
+		log.Fatalf("Failed to open the audit log: %v", err)
+	}
+	if auditLog != nil {
+		defer auditLog.Close()
+	}
+
+	// Create the chat service, which owns the upstream clients
+	chatService, err := api.NewChatService(api.Config{
+		Providers: config,
+		Timeouts:  api.DefaultTimeouts(),
+		Logger:    log.Default(),
+		Metrics:   middleware.UpstreamMetrics{},
+		Usage:     usageStore,
+		Audit:     auditLog,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure providers: %v", err)
+	}
+
+	// Load the API keys from the configured backend, reloading them whenever
+	// the key file changes or on SIGHUP
+	keyStore, err := openKeyStore()
+	if err != nil {
+		log.Fatalf("Failed to load API keys: %v", err)
+	}
+	defer keyStore.Close()
+	stopWatching := keyStore.Watch(keys.DefaultReloadInterval)
+	defer stopWatching()
+
+	// Accept JWTs from the identity provider alongside static keys, if one is configured
+	verifier, err := jwtVerifier()
+	if err != nil {
+		log.Fatalf("Failed to configure JWT authentication: %v", err)
+	}
+
+	// Cost completions at the model prices, keeping what each key has spent
+	// in a ledger that survives restarts
+	pricingFile := os.Getenv("PRICING_FILE")
+	if pricingFile == "" {
+		pricingFile = DefaultPricingFile
+	}
+	pricing, err := billing.LoadPricing(pricingFile)
+	if err != nil {
+		log.Fatalf("Failed to load model prices: %v", err)
+	}
+	ledgerDB := os.Getenv("LEDGER_DB")
+	if ledgerDB == "" {
+		ledgerDB = DefaultLedgerDB
+	}
+	ledger, err := billing.OpenBoltLedger(ledgerDB)
+	if err != nil {
+		log.Fatalf("Failed to open the spend ledger: %v", err)
+	}
+	defer ledger.Close()
+
+	// Create Echo instance, rendering every error in the OpenAI format
 	e := echo.New()
+	e.HTTPErrorHandler = apierror.HTTPErrorHandler
 
 	// Middleware
-	e.Use(echomw.Logger())
+	// Give every request an ID first, so that logs, errors and traces all carry it
+	e.Use(middleware.RequestID())
+	e.Use(middleware.Tracing())
+	e.Use(middleware.AccessLogger())
 	e.Use(echomw.Recover())
-	e.Use(echomw.CORS())
+	e.Use(echomw.CORSWithConfig(echomw.CORSConfig{
+		ExposeHeaders: []string{requestid.Header, requestid.UpstreamHeader},
+	}))
 
-	// Add rate limiter middleware
-	e.Use(middleware.DefaultRateLimiter())
+	// Add rate limiter middleware, with limits from the rate limit config,
+	// reloaded whenever it changes or on SIGHUP. Limiters are shared between
+	// replicas through Redis when RATE_LIMIT_BACKEND asks for it.
+	rateLimitsFile := os.Getenv("RATE_LIMITS_FILE")
+	if rateLimitsFile == "" {
+		rateLimitsFile = DefaultRateLimitsFile
+	}
+	ratePolicy, err := ratelimit.LoadPolicy(rateLimitsFile)
+	if err != nil {
+		log.Fatalf("Failed to load rate limits: %v", err)
+	}
+	stopWatchingRates := ratePolicy.Watch(ratelimit.DefaultReloadInterval)
+	defer stopWatchingRates()
+
+	limiterBackend, err := rateLimitBackend()
+	if err != nil {
+		log.Fatalf("Failed to configure the rate limiter: %v", err)
+	}
+	if closer, ok := limiterBackend.(io.Closer); ok {
+		defer closer.Close()
+	}
+	// Requests are limited per caller, so the limiter runs on each route after
+	// authentication rather than for every request
+	rateLimiter := middleware.RateLimiterWithConfig(&middleware.RateLimiterConfig{
+		Policy:  ratePolicy,
+		Backend: limiterBackend,
+	})
 
 	// Add Prometheus middleware for metrics collection
 	e.Use(middleware.PrometheusMiddleware())
@@ -81,7 +254,28 @@ func main() {
 	routes.RegisterSwaggerRoutes(e)
 
 	// Register API routes
-	routes.RegisterRoutes(e)
+	routes.RegisterRoutes(e, chatService, routes.ChatOptions{
+		KeyStore:           keyStore,
+		Verifier:           verifier,
+		RateLimiter:        rateLimiter,
+		TokenLimiter:       ratelimit.NewTokenLimiter(),
+		TokenLimits:        tokenLimits(),
+		RatePolicy:         ratePolicy,
+		ConcurrencyLimiter: ratelimit.NewConcurrencyLimiter(middleware.ConcurrencyMetrics{}),
+		Pricing:            pricing,
+		Ledger:             ledger,
+	})
+
+	// Register the usage reports. Every key's usage is only reported to the admin token.
+	adminToken := os.Getenv("ADMIN_API_KEY")
+	routes.RegisterUsageRoutes(e, api.NewUsageReporter(usageStore), keyStore, verifier, rateLimiter, adminToken)
+
+	// Register the admin API only when an admin token is configured
+	if adminToken != "" {
+		routes.RegisterAdminRoutes(e, api.NewKeyAdmin(keyStore), adminToken)
+	} else {
+		log.Printf("ADMIN_API_KEY is not set, the /admin API is disabled")
+	}
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -90,3 +284,132 @@ func main() {
 	}
 	e.Logger.Fatal(e.Start(":" + port))
 }
+
+// openAuditLog opens the audit log described by AUDIT_CONFIG, or returns nil if it is disabled
+func openAuditLog() (*audit.Logger, error) {
+	path := os.Getenv("AUDIT_CONFIG")
+	if path == "" {
+		path = DefaultAuditConfig
+	}
+	config, err := audit.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if !config.Enabled {
+		return nil, nil
+	}
+	log.Printf("Writing the audit log to %s", config.Path)
+	return audit.Open(config)
+}
+
+// openKeyStore opens the key store backend selected by KEYS_BACKEND
+func openKeyStore() (*keys.Store, error) {
+	kind := keysBackend()
+	if kind == keys.BackendFile {
+		return keys.NewStore(apiKeysFile())
+	}
+
+	backend, err := keys.OpenBackend(kind, keyStorePath(kind))
+	if err != nil {
+		return nil, err
+	}
+	if err := seedKeyStore(backend); err != nil {
+		backend.Close()
+		return nil, err
+	}
+	store, err := keys.NewStoreWithBackend(backend)
+	if err != nil {
+		backend.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// seedKeyStore imports the key file named by API_KEYS_FILE into backend if
+// it holds no keys yet, so switching a deployment from the file backend to a
+// database keeps its keys
+func seedKeyStore(backend keys.Backend) error {
+	path := os.Getenv("API_KEYS_FILE")
+	if path == "" {
+		return nil
+	}
+	held, err := backend.Load()
+	if err != nil || len(held) > 0 {
+		return err
+	}
+
+	n, err := keys.Import(backend, keys.NewFileBackend(path))
+	if err != nil {
+		return fmt.Errorf("failed to import the keys of %s: %w", path, err)
+	}
+	if n > 0 {
+		log.Printf("Imported %d keys from %s into the empty key store", n, path)
+	}
+	return nil
+}
+
+// jwtVerifier returns a JWT verifier configured from the OIDC_* environment
+// variables, or nil if OIDC_ISSUER is not set
+func jwtVerifier() (*oidc.Verifier, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+	return oidc.NewVerifier(oidc.Config{
+		Issuer:      issuer,
+		Audience:    os.Getenv("OIDC_AUDIENCE"),
+		JWKS:        os.Getenv("OIDC_JWKS"),
+		GroupsClaim: os.Getenv("OIDC_GROUPS_CLAIM"),
+		TierClaim:   os.Getenv("OIDC_TIER_CLAIM"),
+	})
+}
+
+// rateLimitBackend opens the rate limiter backend selected by RATE_LIMIT_BACKEND.
+// It returns nil for the memory backend, the default.
+func rateLimitBackend() (ratelimit.Backend, error) {
+	switch kind := os.Getenv("RATE_LIMIT_BACKEND"); kind {
+	case "", ratelimit.BackendMemory:
+		return nil, nil
+	case ratelimit.BackendRedis:
+		url := os.Getenv("REDIS_URL")
+		if url == "" {
+			url = DefaultRedisURL
+		}
+		backend, err := ratelimit.OpenRedisBackend(url)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := backend.Ping(ctx); err != nil {
+			backend.Close()
+			return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+		}
+		return backend, nil
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_BACKEND %q, expected %q or %q", kind, ratelimit.BackendMemory, ratelimit.BackendRedis)
+	}
+}
+
+// tokenLimits returns the default token budgets from TOKENS_PER_MINUTE and
+// TOKENS_PER_DAY. Unset budgets are unlimited.
+func tokenLimits() ratelimit.Limits {
+	return ratelimit.Limits{
+		TokensPerMinute: envInt("TOKENS_PER_MINUTE"),
+		TokensPerDay:    envInt("TOKENS_PER_DAY"),
+	}
+}
+
+// envInt reads a non-negative integer environment variable, or 0 if it's unset
+func envInt(name string) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		log.Fatalf("%s must be a non-negative integer, got %q", name, value)
+	}
+	return n
+}
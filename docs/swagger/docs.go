@@ -24,6 +24,519 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/keys": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Lists every API key with its metadata. Secrets and hashes are never returned.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List API keys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.APIKeyList"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Generates a new API key. The secret is returned only in this response; only its hash is stored.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Create an API key",
+                "parameters": [
+                    {
+                        "description": "Key metadata",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.CreateAPIKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/types.APIKeyWithSecret"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.APIKey"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Key not found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Delete an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.DeletedAPIKey"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Key not found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Changes the metadata and access policy of a key. Only the fields present in the body are changed; a zero expires_at removes the expiry.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Update an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.UpdateAPIKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.APIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Key not found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys/{id}/disable": {
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Rejects the key from the next request on, without deleting it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Disable an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.APIKey"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Key not found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys/{id}/enable": {
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Enable an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.APIKey"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Key not found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys/{id}/quota": {
+            "put": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Replaces the rate limits of a key. Zero fields fall back to the server defaults.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Set the quota of an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New quota",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.APIKeyQuota"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.APIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Key not found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/keys/{id}/rotate": {
+            "post": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Replaces the secret of a key, keeping its ID, metadata and quota. The old secret stops working immediately and the new one is returned only in this response.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Rotate an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.APIKeyWithSecret"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Key not found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/usage": {
+            "get": {
+                "security": [
+                    {
+                        "AdminAuth": []
+                    }
+                ],
+                "description": "Reports the requests and tokens of every key by model, in hourly or daily buckets. Times are in UTC. Send format=csv or Accept: text/csv for CSV.",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get the usage of every key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Start of the range, as a date or RFC 3339 time (default: start of this month)",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range, as a date (included) or RFC 3339 time (excluded). Default: now",
+                        "name": "end",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bucket size: hour or day (default: day)",
+                        "name": "bucket",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only report this model",
+                        "name": "model",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only report this key",
+                        "name": "key_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only report the keys of this team",
+                        "name": "team",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json (default) or csv",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.UsageReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/chat/completions": {
             "post": {
                 "security": [
@@ -61,19 +574,125 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid request body",
+                        "description": "Invalid request body",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized - Invalid or missing API key",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "The API key is not allowed to use this model, max_tokens or feature",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Model not found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Request or token rate limit exceeded",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "502": {
+                        "description": "Upstream provider error",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "All upstream providers unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "504": {
+                        "description": "Upstream provider timed out",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/usage": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Reports the requests and tokens of the calling key by model, in hourly or daily buckets. Times are in UTC. Send format=csv or Accept: text/csv for CSV.",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
+                "tags": [
+                    "usage"
+                ],
+                "summary": "Get your usage",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Start of the range, as a date or RFC 3339 time (default: start of this month)",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of the range, as a date (included) or RFC 3339 time (excluded). Default: now",
+                        "name": "end",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bucket size: hour or day (default: day)",
+                        "name": "bucket",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only report this model",
+                        "name": "model",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json (default) or csv",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.UsageReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query",
                         "schema": {
                             "$ref": "#/definitions/types.ErrorResponse"
                         }
                     },
                     "401": {
-                        "description": "Unauthorized - Invalid or missing API key",
-                        "schema": {
-                            "$ref": "#/definitions/types.ErrorResponse"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal server error",
+                        "description": "Missing or invalid API key",
                         "schema": {
                             "$ref": "#/definitions/types.ErrorResponse"
                         }
@@ -128,6 +747,192 @@ const docTemplate = `{
                 }
             }
         },
+        "types.APIKey": {
+            "type": "object",
+            "properties": {
+                "allowed_features": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "streaming"
+                    ]
+                },
+                "allowed_models": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "audit_opt_out": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "key_3f2a9c1b7d4e"
+                },
+                "label": {
+                    "type": "string",
+                    "example": "staging"
+                },
+                "max_tokens": {
+                    "type": "integer",
+                    "example": 1024
+                },
+                "object": {
+                    "type": "string",
+                    "example": "api_key"
+                },
+                "owner": {
+                    "type": "string",
+                    "example": "alice"
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "scarlett-AbCdEfGh"
+                },
+                "quota": {
+                    "$ref": "#/definitions/types.APIKeyQuota"
+                },
+                "rate_limit_tier": {
+                    "type": "string",
+                    "example": "free"
+                },
+                "team": {
+                    "type": "string",
+                    "example": "search"
+                }
+            }
+        },
+        "types.APIKeyList": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.APIKey"
+                    }
+                },
+                "object": {
+                    "type": "string",
+                    "example": "list"
+                }
+            }
+        },
+        "types.APIKeyQuota": {
+            "type": "object",
+            "properties": {
+                "burst": {
+                    "type": "integer",
+                    "example": 10
+                },
+                "max_concurrent_requests": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "monthly_budget_usd": {
+                    "type": "number",
+                    "example": 100
+                },
+                "monthly_soft_budget_usd": {
+                    "type": "number",
+                    "example": 80
+                },
+                "requests_per_second": {
+                    "type": "number",
+                    "example": 5
+                },
+                "tokens_per_day": {
+                    "type": "integer",
+                    "example": 2000000
+                },
+                "tokens_per_minute": {
+                    "type": "integer",
+                    "example": 60000
+                }
+            }
+        },
+        "types.APIKeyWithSecret": {
+            "type": "object",
+            "properties": {
+                "allowed_features": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "streaming"
+                    ]
+                },
+                "allowed_models": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "audit_opt_out": {
+                    "type": "boolean"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "key_3f2a9c1b7d4e"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "scarlett-AbCdEfGhIjKlMnOpQrStUvWxYz0123456789abcd"
+                },
+                "label": {
+                    "type": "string",
+                    "example": "staging"
+                },
+                "max_tokens": {
+                    "type": "integer",
+                    "example": 1024
+                },
+                "object": {
+                    "type": "string",
+                    "example": "api_key"
+                },
+                "owner": {
+                    "type": "string",
+                    "example": "alice"
+                },
+                "prefix": {
+                    "type": "string",
+                    "example": "scarlett-AbCdEfGh"
+                },
+                "quota": {
+                    "$ref": "#/definitions/types.APIKeyQuota"
+                },
+                "rate_limit_tier": {
+                    "type": "string",
+                    "example": "free"
+                },
+                "team": {
+                    "type": "string",
+                    "example": "search"
+                }
+            }
+        },
         "types.ChatResponse": {
             "type": "object",
             "properties": {
@@ -171,6 +976,72 @@ const docTemplate = `{
                 }
             }
         },
+        "types.CreateAPIKeyRequest": {
+            "type": "object",
+            "properties": {
+                "allowed_features": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "streaming"
+                    ]
+                },
+                "allowed_models": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "audit_opt_out": {
+                    "type": "boolean"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "label": {
+                    "type": "string",
+                    "example": "staging"
+                },
+                "max_tokens": {
+                    "type": "integer",
+                    "example": 1024
+                },
+                "owner": {
+                    "type": "string",
+                    "example": "alice"
+                },
+                "quota": {
+                    "$ref": "#/definitions/types.APIKeyQuota"
+                },
+                "rate_limit_tier": {
+                    "type": "string",
+                    "example": "free"
+                },
+                "team": {
+                    "type": "string",
+                    "example": "search"
+                }
+            }
+        },
+        "types.DeletedAPIKey": {
+            "type": "object",
+            "properties": {
+                "deleted": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "id": {
+                    "type": "string",
+                    "example": "key_3f2a9c1b7d4e"
+                },
+                "object": {
+                    "type": "string",
+                    "example": "api_key"
+                }
+            }
+        },
         "types.ErrorResponse": {
             "type": "object",
             "properties": {
@@ -188,6 +1059,23 @@ const docTemplate = `{
                             "type": "string"
                         }
                     }
+                },
+                "request_id": {
+                    "description": "ID of the request, to quote when reporting a problem",
+                    "type": "string",
+                    "example": "req_6f1c0a9e2b7d4c3a8e5f1b2d"
+                }
+            }
+        },
+        "types.FunctionCall": {
+            "type": "object",
+            "properties": {
+                "arguments": {
+                    "description": "Arguments is a JSON object encoded as a string",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
                 }
             }
         },
@@ -200,10 +1088,84 @@ const docTemplate = `{
                     "type": "string",
                     "example": "Hello, how are you today?"
                 },
+                "name": {
+                    "description": "Name of the participant, or of the function for legacy function messages",
+                    "type": "string"
+                },
                 "role": {
                     "description": "Role of the message sender (e.g., user, assistant)\nexample: user",
                     "type": "string",
                     "example": "user"
+                },
+                "tool_call_id": {
+                    "description": "ID of the tool call a tool message responds to",
+                    "type": "string"
+                },
+                "tool_calls": {
+                    "description": "Tool calls made by an assistant message",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.ToolCall"
+                    }
+                }
+            }
+        },
+        "types.ToolCall": {
+            "type": "object",
+            "properties": {
+                "function": {
+                    "$ref": "#/definitions/types.FunctionCall"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type is always function",
+                    "type": "string"
+                }
+            }
+        },
+        "types.UpdateAPIKeyRequest": {
+            "type": "object",
+            "properties": {
+                "allowed_features": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "allowed_models": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "audit_opt_out": {
+                    "type": "boolean"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "label": {
+                    "type": "string"
+                },
+                "max_tokens": {
+                    "type": "integer"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "quota": {
+                    "$ref": "#/definitions/types.APIKeyQuota"
+                },
+                "rate_limit_tier": {
+                    "type": "string"
+                },
+                "team": {
+                    "type": "string"
                 }
             }
         },
@@ -220,11 +1182,81 @@ const docTemplate = `{
                     "type": "integer"
                 }
             }
+        },
+        "types.UsageBucket": {
+            "type": "object",
+            "properties": {
+                "completion_tokens": {
+                    "type": "integer",
+                    "example": 3400
+                },
+                "key_id": {
+                    "type": "string",
+                    "example": "key_3f2a9c1b7d4e"
+                },
+                "model": {
+                    "type": "string",
+                    "example": "llama-3.3-70b-versatile"
+                },
+                "prompt_tokens": {
+                    "type": "integer",
+                    "example": 12000
+                },
+                "requests": {
+                    "type": "integer",
+                    "example": 42
+                },
+                "start": {
+                    "type": "string",
+                    "example": "2025-01-01T00:00:00Z"
+                },
+                "team": {
+                    "type": "string",
+                    "example": "search"
+                },
+                "total_tokens": {
+                    "type": "integer",
+                    "example": 15400
+                }
+            }
+        },
+        "types.UsageReport": {
+            "type": "object",
+            "properties": {
+                "bucket": {
+                    "type": "string",
+                    "example": "day"
+                },
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.UsageBucket"
+                    }
+                },
+                "end": {
+                    "type": "string",
+                    "example": "2025-02-01T00:00:00Z"
+                },
+                "object": {
+                    "type": "string",
+                    "example": "list"
+                },
+                "start": {
+                    "type": "string",
+                    "example": "2025-01-01T00:00:00Z"
+                }
+            }
         }
     },
     "securityDefinitions": {
+        "AdminAuth": {
+            "description": "Admin token from ADMIN_API_KEY with Bearer prefix (e.g., \"Bearer your-admin-token\"). Required for the /admin routes.",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        },
         "BearerAuth": {
-            "description": "API key authentication with Bearer prefix (e.g., \"Bearer your-api-key\"). The 'Bearer ' prefix is REQUIRED - requests without it will be rejected.",
+            "description": "API key or, when OIDC_ISSUER is set, JWT authentication with Bearer prefix (e.g., \"Bearer your-api-key\"). The 'Bearer ' prefix is REQUIRED - requests without it will be rejected.",
             "type": "apiKey",
             "name": "Authorization",
             "in": "header"
@@ -1,40 +1,78 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"time"
 
+	"go-api/internal/apierror"
+	"go-api/internal/audit"
+	"go-api/internal/identity"
+	"go-api/internal/requestid"
+	"go-api/internal/tracing"
 	"go-api/internal/types"
-	"go-api/pkg/groq"
+	"go-api/internal/usage"
+	"go-api/internal/validation"
+	"go-api/pkg/provider"
+	"go-api/pkg/sse"
 
 	"github.com/labstack/echo/v4"
 )
 
-type Handler struct {
-	groqClient *groq.Client
-}
+// @model ChatRequest
+// @Description Chat completion request
+// @Property model string "Model ID to use" Required: true Example: "deepseek-r1-distill-llama-70b"
+// @Property messages array "Array of messages" Required: true Items: {"$ref": "#/definitions/Message"} Example: [{"role":"user","content":"Hello, how are you?"}]
+// @Property temperature number "Temperature for sampling (0.0 to 2.0)" Default: 0.7 Example: 0.7
+// @Property max_tokens integer "Maximum tokens to generate" Default: 100 Example: 100
+// @Property stream boolean "Stream the response" Default: false Example: false
 
-func NewHandler(apiKey string) *Handler {
-	return &Handler{
-		groqClient: groq.NewClient(apiKey),
-	}
-}
-
-func (h *Handler) HandleChatCompletions(c echo.Context) error {
+// HandleChatCompletions handles the chat completions endpoint. Errors are
+// written here rather than returned, so the handler behaves the same whether
+// or not it runs behind apierror.HTTPErrorHandler.
+// @Summary Process chat completions request
+// @Description An API for LLM chat completion requests using Scarlett's LLM providers. Important: Authorization header must use Bearer format (e.g., "Bearer your-api-key").
+// @Tags chat
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ChatRequestExample true "Chat request payload"
+// @Success 200 {object} types.ChatResponse
+// @Failure 400 {object} types.ErrorResponse "Invalid request body"
+// @Failure 401 {object} types.ErrorResponse "Unauthorized - Invalid or missing API key"
+// @Failure 403 {object} types.ErrorResponse "The API key is not allowed to use this model, max_tokens or feature"
+// @Failure 404 {object} types.ErrorResponse "Model not found"
+// @Failure 429 {object} types.ErrorResponse "Request or token rate limit exceeded"
+// @Failure 500 {object} types.ErrorResponse "Internal server error"
+// @Failure 502 {object} types.ErrorResponse "Upstream provider error"
+// @Failure 503 {object} types.ErrorResponse "All upstream providers unavailable"
+// @Failure 504 {object} types.ErrorResponse "Upstream provider timed out"
+// @Example curl request
+//
+//	curl -X POST https://api.scarlett.ai/chat/completions \
+//	  -H "Authorization: Bearer your-api-key" \
+//	  -H "Content-Type: application/json" \
+//	  -d '{
+//	    "model": "deepseek-r1-distill-llama-70b",
+//	    "messages": [
+//	      {
+//	        "role": "user",
+//	        "content": "Hello, how are you?"
+//	      }
+//	    ],
+//	    "temperature": 0.7,
+//	    "max_tokens": 50
+//	  }'
+//
+// @Router /chat/completions [post]
+func (s *ChatService) HandleChatCompletions(c echo.Context) error {
 	// Parse request body
 	var chatReq types.ChatRequest
 	if err := c.Bind(&chatReq); err != nil {
-		return c.JSON(http.StatusBadRequest, types.ErrorResponse{
-			Error: struct {
-				Message string      `json:"message"`
-				Type    string      `json:"type"`
-				Param   string      `json:"param,omitempty"`
-				Code    interface{} `json:"code,omitempty"`
-			}{
-				Message: "Invalid request body",
-				Type:    "invalid_request_error",
-			},
-		})
+		return apierror.Write(c, apierror.InvalidRequest("Invalid request body").WithCause(err))
 	}
 
 	// Set default values
@@ -42,50 +80,154 @@ func (h *Handler) HandleChatCompletions(c echo.Context) error {
 		chatReq.N = 1
 	}
 
-	// Make request to Groq API
-	resp, err := h.groqClient.ChatCompletion(&chatReq)
+	// Reject invalid parameters here rather than with an opaque upstream error
+	if verr := validation.ValidateChatRequest(&chatReq); verr != nil {
+		return apierror.Write(c, verr.APIError())
+	}
+
+	// Audit the completion once it has been sent, unless the caller opted out
+	record := s.auditRecord(c, &chatReq)
+	if record != nil {
+		defer s.finishAudit(c, record)
+	}
+
+	// Bound the whole completion, retries and failover included. Streams
+	// get their own limit since they legitimately run for a long time.
+	ctx := c.Request().Context()
+	timeout := s.timeouts.Request
+	if chatReq.Stream {
+		timeout = s.timeouts.Stream
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Trace the completion, with the status finally sent to the client
+	ctx, completion := tracing.StartCompletion(ctx, &chatReq)
+	defer func() { completion.End(c.Response().Status) }()
+
+	// Send the request to the provider serving the requested model,
+	// retrying and failing over to its fallbacks as configured
+	start := time.Now()
+	resp, route, err := s.registry.ChatCompletion(ctx, &chatReq)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Error: struct {
-				Message string      `json:"message"`
-				Type    string      `json:"type"`
-				Param   string      `json:"param,omitempty"`
-				Code    interface{} `json:"code,omitempty"`
-			}{
-				Message: "Failed to make request to Groq API",
-				Type:    "api_error",
-			},
-		})
+		s.logger.Printf("request %s: chat completion for model %s failed: %v", requestid.FromEcho(c), chatReq.Model, err)
+		record.SetError(err.Error())
+		completion.Fail(err)
+		if errors.Is(err, provider.ErrUnknownModel) {
+			return apierror.Write(c, apierror.ModelNotFound(chatReq.Model))
+		}
+		if errors.Is(err, provider.ErrUpstreamUnavailable) {
+			return apierror.Write(c, apierror.UpstreamUnavailable("All upstream providers for `"+chatReq.Model+"` are currently unavailable. Please try again later."))
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return apierror.Write(c, apierror.UpstreamTimeout("The upstream provider did not respond in time"))
+		}
+		return apierror.Write(c, apierror.Upstream("Failed to make request to upstream provider").WithCause(err))
 	}
 	defer resp.Body.Close()
+	s.metrics.ObserveUpstream(route, resp.StatusCode, time.Since(start))
+	upstreamID := requestid.Upstream(resp.Header)
+	record.SetUpstream(route.String(), resp.StatusCode, upstreamID)
+	completion.Upstream(route.String(), upstreamID)
+	if resp.StatusCode != http.StatusOK {
+		s.logger.Printf("request %s: upstream %s returned status %d (upstream request %s)", requestid.FromEcho(c), route, resp.StatusCode, upstreamID)
+	}
 
-	// If streaming is requested, stream the response
-	if chatReq.Stream {
-		c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
-		c.Response().Header().Set("Cache-Control", "no-cache")
-		c.Response().Header().Set("Connection", "keep-alive")
+	// Tell the client which upstream actually served the request, and the
+	// ID it gave the request
+	c.Response().Header().Set(provider.HeaderUpstream, route.String())
+	if upstreamID != "" {
+		c.Response().Header().Set(requestid.UpstreamHeader, upstreamID)
+	}
+
+	// Upstream errors arrive as plain JSON even for streaming requests.
+	// Map them to the status and type the client should see.
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		upstreamErr := apierror.FromUpstream(route.Provider, resp.StatusCode, resp.Header, body)
+		record.SetError(upstreamErr.Message)
+		return apierror.Write(c, upstreamErr)
+	}
 
-		// Copy the stream directly to the client
-		_, err = io.Copy(c.Response().Writer, resp.Body)
+	// Relay streams chunk by chunk
+	if chatReq.Stream {
+		accumulator := usage.NewAccumulator(chatReq.N)
+		err := sse.Relay(ctx, c.Response(), resp.Body, s.timeouts.Heartbeat, func(chunk *types.ChatCompletionChunk) {
+			completion.Chunk(chunk)
+			accumulator.Add(chunk)
+		}, sse.WithRequestID(requestid.FromEcho(c)))
+		u := accumulator.Usage(&chatReq)
+		s.recordUsage(c, chatReq.Model, u, record)
+		record.SetCompletions(accumulator.ID(), accumulator.Choices())
+		completion.Finish(accumulator.ID(), "", accumulator.Choices(), u)
+		if err != nil {
+			record.SetError(err.Error())
+			completion.Fail(err)
+		}
 		return err
 	}
 
 	// For non-streaming responses, just proxy the response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, types.ErrorResponse{
-			Error: struct {
-				Message string      `json:"message"`
-				Type    string      `json:"type"`
-				Param   string      `json:"param,omitempty"`
-				Code    interface{} `json:"code,omitempty"`
-			}{
-				Message: "Failed to read response from Groq API",
-				Type:    "api_error",
-			},
-		})
-	}
-
-	// Return response with same status code and body
+		return apierror.Write(c, apierror.Upstream("Failed to read response from "+route.Provider).WithCause(err))
+	}
+
+	// Record usage of the completion
+	var chatResp types.ChatResponse
+	if err := json.Unmarshal(body, &chatResp); err == nil {
+		u := usage.FromResponse(&chatReq, &chatResp)
+		s.recordUsage(c, chatReq.Model, u, record)
+		record.SetCompletions(chatResp.ID, chatResp.Choices)
+		completion.Finish(chatResp.ID, chatResp.Model, chatResp.Choices, u)
+	}
+
 	return c.JSONBlob(resp.StatusCode, body)
 }
+
+// recordUsage stores the usage of a completion of model on the context, for
+// metrics and budgets, in the audit record and in the usage store, for usage reports
+func (s *ChatService) recordUsage(c echo.Context, model string, u types.Usage, audited *audit.Record) {
+	usage.Set(c, u)
+	audited.SetUsage(u)
+	if s.usage == nil {
+		return
+	}
+
+	record := usage.Record{Time: time.Now(), Model: model, Usage: u}
+	if id, ok := identity.FromContext(c); ok {
+		record.KeyID, record.Team = id.KeyID, id.Team
+	}
+	if err := s.usage.Record(record); err != nil {
+		s.logger.Printf("request %s: failed to record usage of key %s: %v", requestid.FromEcho(c), record.KeyID, err)
+	}
+}
+
+// auditRecord starts the audit record of req, or returns nil if there is no
+// audit log or the caller opted out of it
+func (s *ChatService) auditRecord(c echo.Context, req *types.ChatRequest) *audit.Record {
+	if s.audit == nil {
+		return nil
+	}
+	id, ok := identity.FromContext(c)
+	if ok && id.AuditOptOut {
+		return nil
+	}
+
+	record := audit.NewRecord(req)
+	record.RequestID = requestid.FromEcho(c)
+	if ok {
+		record.KeyID, record.Owner, record.Team = id.KeyID, id.Owner, id.Team
+	}
+	return record
+}
+
+// finishAudit completes the record with the outcome of the request and queues it
+func (s *ChatService) finishAudit(c echo.Context, record *audit.Record) {
+	record.LatencyMS = time.Since(record.Time).Milliseconds()
+	record.Status = c.Response().Status
+	s.audit.Log(record)
+}
@@ -10,6 +10,7 @@ import (
 
 	"go-api/internal/api"
 	"go-api/internal/types"
+	"go-api/pkg/provider"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
@@ -20,7 +21,7 @@ import (
 var _ = Describe("Chat API", func() {
 	var (
 		e       *echo.Echo
-		handler *api.Handler
+		handler *api.ChatService
 	)
 
 	BeforeEach(func() {
@@ -33,12 +34,14 @@ var _ = Describe("Chat API", func() {
 
 		// Setup Echo and handler
 		e = echo.New()
-		handler = api.NewHandler(apiKey)
+		handler, err = api.NewChatService(api.Config{Providers: provider.DefaultConfig()})
+		Expect(err).NotTo(HaveOccurred())
 	})
 
 	Context("POST /chat/completions", func() {
 		It("should successfully process a chat completion request", func() {
 			// Prepare request body
+			temperature := 0.7
 			reqBody := types.ChatRequest{
 				Messages: []types.Message{
 					{
@@ -51,7 +54,7 @@ var _ = Describe("Chat API", func() {
 					},
 				},
 				Model:       "deepseek-r1-distill-llama-70b",
-				Temperature: 0.7,
+				Temperature: &temperature,
 				MaxTokens:   150,
 				Stream:      false,
 			}
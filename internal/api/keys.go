@@ -0,0 +1,373 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/keys"
+	"go-api/internal/types"
+	"go-api/internal/validation"
+
+	"github.com/labstack/echo/v4"
+)
+
+// KeyAdmin serves the admin API for managing API keys. Changes go through the
+// key store, so they apply to the next request without a restart.
+type KeyAdmin struct {
+	store *keys.Store
+}
+
+// NewKeyAdmin creates the admin API for store
+func NewKeyAdmin(store *keys.Store) *KeyAdmin {
+	return &KeyAdmin{store: store}
+}
+
+// ListKeys handles GET /admin/keys
+// @Summary List API keys
+// @Description Lists every API key with its metadata. Secrets and hashes are never returned.
+// @Tags admin
+// @Produce json
+// @Security AdminAuth
+// @Success 200 {object} types.APIKeyList
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Router /admin/keys [get]
+func (a *KeyAdmin) ListKeys(c echo.Context) error {
+	list := types.APIKeyList{Object: "list", Data: []types.APIKey{}}
+	for _, key := range a.store.List() {
+		list.Data = append(list.Data, keyView(key))
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// CreateKey handles POST /admin/keys
+// @Summary Create an API key
+// @Description Generates a new API key. The secret is returned only in this response; only its hash is stored.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security AdminAuth
+// @Param request body types.CreateAPIKeyRequest true "Key metadata"
+// @Success 201 {object} types.APIKeyWithSecret
+// @Failure 400 {object} types.ErrorResponse "Invalid request body"
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Router /admin/keys [post]
+func (a *KeyAdmin) CreateKey(c echo.Context) error {
+	var req types.CreateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.InvalidRequest("Invalid request body")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return apierror.InvalidParam("expires_at", validation.CodeInvalidValue, "expires_at must be in the future")
+	}
+	if err := validateQuota(req.Quota); err != nil {
+		return err
+	}
+	if err := validatePolicy(req.MaxTokens, req.AllowedFeatures); err != nil {
+		return err
+	}
+
+	template := keys.Key{
+		Owner:           req.Owner,
+		Team:            req.Team,
+		Label:           req.Label,
+		AllowedModels:   req.AllowedModels,
+		MaxTokens:       req.MaxTokens,
+		AllowedFeatures: req.AllowedFeatures,
+		RateLimitTier:   req.RateLimitTier,
+		Quota:           keys.Quota(req.Quota),
+		AuditOptOut:     req.AuditOptOut,
+	}
+	if req.ExpiresAt != nil {
+		template.ExpiresAt = req.ExpiresAt.UTC()
+	}
+
+	key, secret, err := a.store.Create(template)
+	if err != nil {
+		return storeError(err)
+	}
+	return c.JSON(http.StatusCreated, types.APIKeyWithSecret{APIKey: keyView(key), Key: secret})
+}
+
+// GetKey handles GET /admin/keys/:id
+// @Summary Get an API key
+// @Tags admin
+// @Produce json
+// @Security AdminAuth
+// @Param id path string true "Key ID"
+// @Success 200 {object} types.APIKey
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Failure 404 {object} types.ErrorResponse "Key not found"
+// @Router /admin/keys/{id} [get]
+func (a *KeyAdmin) GetKey(c echo.Context) error {
+	key, err := a.store.Get(c.Param("id"))
+	if err != nil {
+		return storeError(err)
+	}
+	return c.JSON(http.StatusOK, keyView(key))
+}
+
+// UpdateKey handles PATCH /admin/keys/:id
+// @Summary Update an API key
+// @Description Changes the metadata and access policy of a key. Only the fields present in the body are changed; a zero expires_at removes the expiry.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security AdminAuth
+// @Param id path string true "Key ID"
+// @Param request body types.UpdateAPIKeyRequest true "Fields to change"
+// @Success 200 {object} types.APIKey
+// @Failure 400 {object} types.ErrorResponse "Invalid request body"
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Failure 404 {object} types.ErrorResponse "Key not found"
+// @Router /admin/keys/{id} [patch]
+func (a *KeyAdmin) UpdateKey(c echo.Context) error {
+	var req types.UpdateAPIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return apierror.InvalidRequest("Invalid request body")
+	}
+	if req.Quota != nil {
+		if err := validateQuota(*req.Quota); err != nil {
+			return err
+		}
+	}
+	var maxTokens int
+	var features []string
+	if req.MaxTokens != nil {
+		maxTokens = *req.MaxTokens
+	}
+	if req.AllowedFeatures != nil {
+		features = *req.AllowedFeatures
+	}
+	if err := validatePolicy(maxTokens, features); err != nil {
+		return err
+	}
+
+	return a.update(c, func(key *keys.Key) {
+		if req.Owner != nil {
+			key.Owner = *req.Owner
+		}
+		if req.Team != nil {
+			key.Team = *req.Team
+		}
+		if req.Label != nil {
+			key.Label = *req.Label
+		}
+		if req.ExpiresAt != nil {
+			key.ExpiresAt = req.ExpiresAt.UTC()
+		}
+		if req.Disabled != nil {
+			key.Disabled = *req.Disabled
+		}
+		if req.AllowedModels != nil {
+			key.AllowedModels = *req.AllowedModels
+		}
+		if req.MaxTokens != nil {
+			key.MaxTokens = *req.MaxTokens
+		}
+		if req.AllowedFeatures != nil {
+			key.AllowedFeatures = *req.AllowedFeatures
+		}
+		if req.RateLimitTier != nil {
+			key.RateLimitTier = *req.RateLimitTier
+		}
+		if req.Quota != nil {
+			key.Quota = keys.Quota(*req.Quota)
+		}
+		if req.AuditOptOut != nil {
+			key.AuditOptOut = *req.AuditOptOut
+		}
+	})
+}
+
+// SetQuota handles PUT /admin/keys/:id/quota
+// @Summary Set the quota of an API key
+// @Description Replaces the rate limits of a key. Zero fields fall back to the server defaults.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security AdminAuth
+// @Param id path string true "Key ID"
+// @Param request body types.APIKeyQuota true "New quota"
+// @Success 200 {object} types.APIKey
+// @Failure 400 {object} types.ErrorResponse "Invalid request body"
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Failure 404 {object} types.ErrorResponse "Key not found"
+// @Router /admin/keys/{id}/quota [put]
+func (a *KeyAdmin) SetQuota(c echo.Context) error {
+	var quota types.APIKeyQuota
+	if err := c.Bind(&quota); err != nil {
+		return apierror.InvalidRequest("Invalid request body")
+	}
+	if err := validateQuota(quota); err != nil {
+		return err
+	}
+
+	return a.update(c, func(key *keys.Key) {
+		key.Quota = keys.Quota(quota)
+	})
+}
+
+// DisableKey handles POST /admin/keys/:id/disable
+// @Summary Disable an API key
+// @Description Rejects the key from the next request on, without deleting it.
+// @Tags admin
+// @Produce json
+// @Security AdminAuth
+// @Param id path string true "Key ID"
+// @Success 200 {object} types.APIKey
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Failure 404 {object} types.ErrorResponse "Key not found"
+// @Router /admin/keys/{id}/disable [post]
+func (a *KeyAdmin) DisableKey(c echo.Context) error {
+	return a.update(c, func(key *keys.Key) {
+		key.Disabled = true
+	})
+}
+
+// EnableKey handles POST /admin/keys/:id/enable
+// @Summary Enable an API key
+// @Tags admin
+// @Produce json
+// @Security AdminAuth
+// @Param id path string true "Key ID"
+// @Success 200 {object} types.APIKey
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Failure 404 {object} types.ErrorResponse "Key not found"
+// @Router /admin/keys/{id}/enable [post]
+func (a *KeyAdmin) EnableKey(c echo.Context) error {
+	return a.update(c, func(key *keys.Key) {
+		key.Disabled = false
+	})
+}
+
+// RotateKey handles POST /admin/keys/:id/rotate
+// @Summary Rotate an API key
+// @Description Replaces the secret of a key, keeping its ID, metadata and quota. The old secret stops working immediately and the new one is returned only in this response.
+// @Tags admin
+// @Produce json
+// @Security AdminAuth
+// @Param id path string true "Key ID"
+// @Success 200 {object} types.APIKeyWithSecret
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Failure 404 {object} types.ErrorResponse "Key not found"
+// @Router /admin/keys/{id}/rotate [post]
+func (a *KeyAdmin) RotateKey(c echo.Context) error {
+	key, secret, err := a.store.Rotate(c.Param("id"))
+	if err != nil {
+		return storeError(err)
+	}
+	return c.JSON(http.StatusOK, types.APIKeyWithSecret{APIKey: keyView(key), Key: secret})
+}
+
+// DeleteKey handles DELETE /admin/keys/:id
+// @Summary Delete an API key
+// @Tags admin
+// @Produce json
+// @Security AdminAuth
+// @Param id path string true "Key ID"
+// @Success 200 {object} types.DeletedAPIKey
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Failure 404 {object} types.ErrorResponse "Key not found"
+// @Router /admin/keys/{id} [delete]
+func (a *KeyAdmin) DeleteKey(c echo.Context) error {
+	id := c.Param("id")
+	if err := a.store.Delete(id); err != nil {
+		return storeError(err)
+	}
+	return c.JSON(http.StatusOK, types.DeletedAPIKey{ID: id, Object: "api_key", Deleted: true})
+}
+
+// update applies fn to the key named in the path and responds with the result
+func (a *KeyAdmin) update(c echo.Context, fn func(key *keys.Key)) error {
+	key, err := a.store.Update(c.Param("id"), func(key *keys.Key) error {
+		fn(key)
+		return nil
+	})
+	if err != nil {
+		return storeError(err)
+	}
+	return c.JSON(http.StatusOK, keyView(key))
+}
+
+// validateQuota rejects negative limits, and a soft budget over the hard one
+func validateQuota(quota types.APIKeyQuota) error {
+	if quota.RequestsPerSecond < 0 {
+		return apierror.InvalidParam("quota.requests_per_second", validation.CodeInvalidValue, "requests_per_second must not be negative")
+	}
+	if quota.Burst < 0 {
+		return apierror.InvalidParam("quota.burst", validation.CodeInvalidValue, "burst must not be negative")
+	}
+	if quota.TokensPerMinute < 0 {
+		return apierror.InvalidParam("quota.tokens_per_minute", validation.CodeInvalidValue, "tokens_per_minute must not be negative")
+	}
+	if quota.TokensPerDay < 0 {
+		return apierror.InvalidParam("quota.tokens_per_day", validation.CodeInvalidValue, "tokens_per_day must not be negative")
+	}
+	if quota.MaxConcurrentRequests < 0 {
+		return apierror.InvalidParam("quota.max_concurrent_requests", validation.CodeInvalidValue, "max_concurrent_requests must not be negative")
+	}
+	if quota.MonthlyBudgetUSD < 0 {
+		return apierror.InvalidParam("quota.monthly_budget_usd", validation.CodeInvalidValue, "monthly_budget_usd must not be negative")
+	}
+	if quota.MonthlySoftBudgetUSD < 0 {
+		return apierror.InvalidParam("quota.monthly_soft_budget_usd", validation.CodeInvalidValue, "monthly_soft_budget_usd must not be negative")
+	}
+	if quota.MonthlyBudgetUSD > 0 && quota.MonthlySoftBudgetUSD > quota.MonthlyBudgetUSD {
+		return apierror.InvalidParam("quota.monthly_soft_budget_usd", validation.CodeInvalidValue, "monthly_soft_budget_usd must not be more than monthly_budget_usd")
+	}
+	return nil
+}
+
+// validatePolicy rejects a negative max_tokens and unknown features
+func validatePolicy(maxTokens int, features []string) error {
+	if maxTokens < 0 {
+		return apierror.InvalidParam("max_tokens", validation.CodeInvalidValue, "max_tokens must not be negative")
+	}
+	for _, feature := range features {
+		if !slices.Contains(identity.Features, feature) {
+			return apierror.InvalidParam("allowed_features", validation.CodeInvalidValue,
+				fmt.Sprintf("Unknown feature '%s', expected one of %s", feature, strings.Join(identity.Features, ", ")))
+		}
+	}
+	return nil
+}
+
+// storeError maps key store errors to API errors
+func storeError(err error) error {
+	if errors.Is(err, keys.ErrKeyNotFound) {
+		return apierror.NotFound("No API key with that id").WithCode("api_key_not_found")
+	}
+	return apierror.Internal("Failed to update the key store").WithCause(err)
+}
+
+// keyView returns the admin API representation of key
+func keyView(key keys.Key) types.APIKey {
+	view := types.APIKey{
+		ID:              key.ID,
+		Object:          "api_key",
+		Prefix:          key.Prefix,
+		Owner:           key.Owner,
+		Team:            key.Team,
+		Label:           key.Label,
+		Disabled:        key.Disabled,
+		AllowedModels:   key.AllowedModels,
+		MaxTokens:       key.MaxTokens,
+		AllowedFeatures: key.AllowedFeatures,
+		RateLimitTier:   key.RateLimitTier,
+		Quota:           types.APIKeyQuota(key.Quota),
+		AuditOptOut:     key.AuditOptOut,
+	}
+	if !key.CreatedAt.IsZero() {
+		view.CreatedAt = &key.CreatedAt
+	}
+	if !key.ExpiresAt.IsZero() {
+		view.ExpiresAt = &key.ExpiresAt
+	}
+	return view
+}
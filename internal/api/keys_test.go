@@ -0,0 +1,170 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"go-api/internal/api"
+	"go-api/internal/apierror"
+	"go-api/internal/keys"
+	"go-api/internal/middleware"
+	"go-api/internal/routes"
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KeyAdmin", func() {
+	const adminToken = "admin-token-for-tests"
+
+	var (
+		e     *echo.Echo
+		store *keys.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		store, err = keys.NewStoreFromKeys()
+		Expect(err).NotTo(HaveOccurred())
+
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		routes.RegisterAdminRoutes(e, api.NewKeyAdmin(store), adminToken)
+		e.GET("/protected", func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		}, middleware.APIKeyAuth(store, nil))
+	})
+
+	// call sends a request with the given token and decodes the response into out
+	call := func(method, path, token, body string, out interface{}) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if out != nil {
+			ExpectWithOffset(1, json.Unmarshal(rec.Body.Bytes(), out)).To(Succeed())
+		}
+		return rec.Code
+	}
+
+	// create makes a key through the admin API
+	create := func(body string) types.APIKeyWithSecret {
+		var created types.APIKeyWithSecret
+		ExpectWithOffset(1, call(http.MethodPost, "/admin/keys", adminToken, body, &created)).To(Equal(http.StatusCreated))
+		return created
+	}
+
+	It("requires the admin token", func() {
+		var errResp types.ErrorResponse
+		Expect(call(http.MethodGet, "/admin/keys", "", "", &errResp)).To(Equal(http.StatusUnauthorized))
+		Expect(errResp.Error.Code).To(Equal("missing_api_key"))
+
+		Expect(call(http.MethodGet, "/admin/keys", "wrong", "", &errResp)).To(Equal(http.StatusUnauthorized))
+		Expect(errResp.Error.Code).To(Equal("invalid_admin_token"))
+
+		// API keys are not admin tokens
+		created := create(`{}`)
+		Expect(call(http.MethodGet, "/admin/keys", created.Key, "", nil)).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("creates keys that authenticate immediately and never lists their secret", func() {
+		created := create(`{"owner":"alice","team":"search","allowed_models":["llama-3.3-70b"],"quota":{"requests_per_second":2,"burst":4}}`)
+		Expect(created.ID).To(HavePrefix("key_"))
+		Expect(created.Key).To(HavePrefix(keys.KeyPrefix))
+		Expect(created.Prefix).To(Equal(keys.PrefixOf(created.Key)))
+		Expect(created.Quota).To(Equal(types.APIKeyQuota{RequestsPerSecond: 2, Burst: 4}))
+
+		Expect(call(http.MethodGet, "/protected", created.Key, "", nil)).To(Equal(http.StatusNoContent))
+
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).NotTo(ContainSubstring(created.Key))
+		Expect(rec.Body.String()).NotTo(ContainSubstring(`"hash"`))
+
+		var list types.APIKeyList
+		Expect(json.Unmarshal(rec.Body.Bytes(), &list)).To(Succeed())
+		Expect(list.Data).To(HaveLen(1))
+		Expect(list.Data[0].Owner).To(Equal("alice"))
+	})
+
+	It("disables, enables and rotates keys with immediate effect", func() {
+		created := create(`{"label":"ci"}`)
+		path := "/admin/keys/" + created.ID
+
+		var key types.APIKey
+		Expect(call(http.MethodPost, path+"/disable", adminToken, "", &key)).To(Equal(http.StatusOK))
+		Expect(key.Disabled).To(BeTrue())
+		var errResp types.ErrorResponse
+		Expect(call(http.MethodGet, "/protected", created.Key, "", &errResp)).To(Equal(http.StatusUnauthorized))
+		Expect(errResp.Error.Code).To(Equal("api_key_disabled"))
+
+		Expect(call(http.MethodPost, path+"/enable", adminToken, "", &key)).To(Equal(http.StatusOK))
+		Expect(call(http.MethodGet, "/protected", created.Key, "", nil)).To(Equal(http.StatusNoContent))
+
+		var rotated types.APIKeyWithSecret
+		Expect(call(http.MethodPost, path+"/rotate", adminToken, "", &rotated)).To(Equal(http.StatusOK))
+		Expect(rotated.ID).To(Equal(created.ID))
+		Expect(rotated.Label).To(Equal("ci"))
+		Expect(rotated.Key).NotTo(Equal(created.Key))
+		Expect(call(http.MethodGet, "/protected", created.Key, "", nil)).To(Equal(http.StatusUnauthorized))
+		Expect(call(http.MethodGet, "/protected", rotated.Key, "", nil)).To(Equal(http.StatusNoContent))
+	})
+
+	It("updates metadata and quotas", func() {
+		created := create(`{"owner":"bob","rate_limit_tier":"free"}`)
+		path := "/admin/keys/" + created.ID
+
+		var key types.APIKey
+		Expect(call(http.MethodPatch, path, adminToken, `{"team":"ranking","rate_limit_tier":"pro","max_tokens":512,"allowed_features":["streaming"]}`, &key)).To(Equal(http.StatusOK))
+		Expect(key.Owner).To(Equal("bob"))
+		Expect(key.Team).To(Equal("ranking"))
+		Expect(key.RateLimitTier).To(Equal("pro"))
+		Expect(key.MaxTokens).To(Equal(512))
+		Expect(key.AllowedFeatures).To(Equal([]string{"streaming"}))
+
+		Expect(call(http.MethodPatch, path, adminToken, `{"audit_opt_out":true}`, &key)).To(Equal(http.StatusOK))
+		Expect(key.AuditOptOut).To(BeTrue())
+		Expect(key.Team).To(Equal("ranking"))
+
+		var errResp types.ErrorResponse
+		Expect(call(http.MethodPatch, path, adminToken, `{"allowed_features":["telepathy"]}`, &errResp)).To(Equal(http.StatusBadRequest))
+		Expect(errResp.Error.Param).To(Equal("allowed_features"))
+
+		Expect(call(http.MethodPut, path+"/quota", adminToken, `{"requests_per_second":0.5,"burst":1}`, &key)).To(Equal(http.StatusOK))
+		Expect(key.Quota).To(Equal(types.APIKeyQuota{RequestsPerSecond: 0.5, Burst: 1}))
+
+		Expect(call(http.MethodPut, path+"/quota", adminToken, `{"burst":-1}`, &errResp)).To(Equal(http.StatusBadRequest))
+		Expect(errResp.Error.Param).To(Equal("quota.burst"))
+
+		Expect(call(http.MethodPut, path+"/quota", adminToken, `{"monthly_budget_usd":10,"monthly_soft_budget_usd":20}`, &errResp)).To(Equal(http.StatusBadRequest))
+		Expect(errResp.Error.Param).To(Equal("quota.monthly_soft_budget_usd"))
+
+		Expect(call(http.MethodGet, path, adminToken, "", &key)).To(Equal(http.StatusOK))
+		Expect(key.Quota.Burst).To(Equal(1))
+	})
+
+	It("deletes keys", func() {
+		created := create(`{}`)
+		path := "/admin/keys/" + created.ID
+
+		var deleted types.DeletedAPIKey
+		Expect(call(http.MethodDelete, path, adminToken, "", &deleted)).To(Equal(http.StatusOK))
+		Expect(deleted).To(Equal(types.DeletedAPIKey{ID: created.ID, Object: "api_key", Deleted: true}))
+		Expect(call(http.MethodGet, "/protected", created.Key, "", nil)).To(Equal(http.StatusUnauthorized))
+
+		var errResp types.ErrorResponse
+		Expect(call(http.MethodGet, path, adminToken, "", &errResp)).To(Equal(http.StatusNotFound))
+		Expect(errResp.Error.Code).To(Equal("api_key_not_found"))
+		Expect(call(http.MethodDelete, path, adminToken, "", nil)).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"go-api/internal/audit"
+	"go-api/internal/usage"
+	"go-api/pkg/provider"
+	"go-api/pkg/sse"
+)
+
+const (
+	// DefaultRequestTimeout bounds a non-streaming completion, including retries and failover
+	DefaultRequestTimeout = 2 * time.Minute
+
+	// DefaultResponseHeaderTimeout is how long a single upstream attempt may take to start responding
+	DefaultResponseHeaderTimeout = time.Minute
+)
+
+// Timeouts bounds how long the chat service waits on upstreams
+type Timeouts struct {
+	// Request bounds a whole non-streaming completion, including retries and failover
+	Request time.Duration
+
+	// Stream bounds a whole streamed completion. Zero lets streams run as long as the upstream keeps sending.
+	Stream time.Duration
+
+	// ResponseHeader bounds each upstream attempt until its response headers arrive.
+	// Only applied to the HTTP client the service creates itself.
+	ResponseHeader time.Duration
+
+	// FirstByte bounds each streamed upstream attempt from its response headers
+	// until its first bytes arrive. An attempt that runs out of it is retried.
+	FirstByte time.Duration
+
+	// Heartbeat is how long a stream may sit idle before a keep-alive comment is sent
+	Heartbeat time.Duration
+}
+
+// DefaultTimeouts returns the timeouts used for any left unset
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Request:        DefaultRequestTimeout,
+		ResponseHeader: DefaultResponseHeaderTimeout,
+		FirstByte:      provider.DefaultFirstByteTimeout,
+		Heartbeat:      sse.DefaultHeartbeatInterval,
+	}
+}
+
+// withDefaults fills in zero fields from DefaultTimeouts. Stream has no default.
+func (t Timeouts) withDefaults() Timeouts {
+	defaults := DefaultTimeouts()
+	if t.Request <= 0 {
+		t.Request = defaults.Request
+	}
+	if t.ResponseHeader <= 0 {
+		t.ResponseHeader = defaults.ResponseHeader
+	}
+	if t.FirstByte <= 0 {
+		t.FirstByte = defaults.FirstByte
+	}
+	if t.Heartbeat <= 0 {
+		t.Heartbeat = defaults.Heartbeat
+	}
+	return t
+}
+
+// Metrics receives what the chat service observes about its upstreams
+type Metrics interface {
+	// ObserveUpstream records an upstream response and how long it took to arrive
+	ObserveUpstream(route provider.Route, status int, duration time.Duration)
+
+	// ObserveBreakerTransition records a circuit breaker state change
+	ObserveBreakerTransition(route provider.Route, from, to provider.BreakerState)
+}
+
+// nopMetrics discards all observations
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveUpstream(provider.Route, int, time.Duration) {}
+
+func (nopMetrics) ObserveBreakerTransition(provider.Route, provider.BreakerState, provider.BreakerState) {
+}
+
+// Config holds the chat service's dependencies
+type Config struct {
+	// Providers describes the upstreams and which models they serve. Required.
+	Providers *provider.Config
+
+	// HTTPClient is shared by every upstream. Defaults to a client with Timeouts.ResponseHeader applied.
+	HTTPClient *http.Client
+
+	// Timeouts bounds upstream requests. Zero fields use DefaultTimeouts.
+	Timeouts Timeouts
+
+	// Logger receives upstream failures. Defaults to the standard logger.
+	Logger *log.Logger
+
+	// Metrics receives upstream observations. Defaults to discarding them.
+	Metrics Metrics
+
+	// Usage stores the usage of every completion for usage reports. Nil stores nothing.
+	Usage *usage.Store
+
+	// Audit receives an audit record of every completion. Nil audits nothing.
+	Audit *audit.Logger
+}
+
+// ChatService serves chat completions from the provider configured for each model
+type ChatService struct {
+	registry *provider.Registry
+	timeouts Timeouts
+	logger   *log.Logger
+	metrics  Metrics
+	usage    *usage.Store
+	audit    *audit.Logger
+}
+
+// NewChatService creates the chat service, building a provider registry from config
+func NewChatService(config Config) (*ChatService, error) {
+	if config.Providers == nil {
+		return nil, errors.New("chat service needs a provider config")
+	}
+
+	timeouts := config.Timeouts.withDefaults()
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.ResponseHeaderTimeout = timeouts.ResponseHeader
+		httpClient = &http.Client{Transport: transport}
+	}
+
+	logger := config.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = nopMetrics{}
+	}
+
+	registry, err := provider.NewRegistryFromConfig(config.Providers, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	registry.SetFirstByteTimeout(timeouts.FirstByte)
+	registry.OnBreakerStateChange(metrics.ObserveBreakerTransition)
+
+	return &ChatService{
+		registry: registry,
+		timeouts: timeouts,
+		logger:   logger,
+		metrics:  metrics,
+		usage:    config.Usage,
+		audit:    config.Audit,
+	}, nil
+}
@@ -0,0 +1,393 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go-api/internal/api"
+	"go-api/internal/audit"
+	"go-api/internal/identity"
+	"go-api/internal/requestid"
+	"go-api/internal/tracing"
+	"go-api/internal/types"
+	"go-api/internal/usage"
+	"go-api/pkg/provider"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingMetrics remembers every upstream observation
+type recordingMetrics struct {
+	mu       sync.Mutex
+	statuses []int
+}
+
+func (m *recordingMetrics) ObserveUpstream(route provider.Route, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses = append(m.statuses, status)
+}
+
+func (m *recordingMetrics) ObserveBreakerTransition(provider.Route, provider.BreakerState, provider.BreakerState) {
+}
+
+func (m *recordingMetrics) Statuses() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]int(nil), m.statuses...)
+}
+
+var _ = Describe("ChatService", func() {
+	var (
+		upstream *httptest.Server
+		reply    func(w http.ResponseWriter, r *http.Request)
+		metrics  *recordingMetrics
+		timeouts api.Timeouts
+		store    *usage.Store
+		auditLog *audit.Logger
+		service  *api.ChatService
+	)
+
+	BeforeEach(func() {
+		reply = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-Id", "req_upstream_1")
+			io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","model":"llama","choices":[{"index":0,"message":{"role":"assistant","content":"Paris"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11}}`)
+		}
+		upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reply(w, r)
+		}))
+		DeferCleanup(upstream.Close)
+
+		metrics = &recordingMetrics{}
+		timeouts = api.Timeouts{}
+		store = nil
+		auditLog = nil
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		service, err = api.NewChatService(api.Config{
+			Providers: &provider.Config{
+				DefaultProvider: "local",
+				Providers:       []provider.ProviderConfig{{Name: "local", Type: provider.TypeOpenAI, BaseURL: upstream.URL}},
+				Retry:           provider.RetryPolicy{MaxAttempts: 1},
+			},
+			HTTPClient: upstream.Client(),
+			Timeouts:   timeouts,
+			Logger:     log.New(GinkgoWriter, "", 0),
+			Metrics:    metrics,
+			Usage:      store,
+			Audit:      auditLog,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	// post sends body to the service and returns the recorder and context
+	post := func(body string) (*httptest.ResponseRecorder, echo.Context) {
+		req := httptest.NewRequest(http.MethodPost, "/chat/completions", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		Expect(service.HandleChatCompletions(c)).To(Succeed())
+		return rec, c
+	}
+
+	It("requires a provider config", func() {
+		_, err := api.NewChatService(api.Config{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("proxies completions and records usage and upstream metrics", func() {
+		rec, c := post(`{"model": "llama", "messages": [{"role": "user", "content": "Capital of France?"}]}`)
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get(provider.HeaderUpstream)).To(Equal("local/llama"))
+
+		var resp types.ChatResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.Choices[0].Message.Content).To(Equal("Paris"))
+
+		u, ok := usage.FromContext(c)
+		Expect(ok).To(BeTrue())
+		Expect(u.TotalTokens).To(Equal(11))
+		Expect(metrics.Statuses()).To(Equal([]int{http.StatusOK}))
+	})
+
+	It("forwards the request ID to the upstream and reports the upstream's", func() {
+		var forwarded string
+		reply = func(w http.ResponseWriter, r *http.Request) {
+			forwarded = r.Header.Get(requestid.Header)
+			w.Header().Set("X-Request-Id", "req_upstream_1")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":{"message":"bad prompt","type":"invalid_request_error"}}`)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(`{"model": "llama", "messages": [{"role": "user", "content": "hi"}]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		requestid.Set(c, "req_123")
+		Expect(service.HandleChatCompletions(c)).To(Succeed())
+
+		Expect(forwarded).To(Equal("req_123"))
+		Expect(rec.Header().Get(requestid.Header)).To(Equal("req_123"))
+		Expect(rec.Header().Get(requestid.UpstreamHeader)).To(Equal("req_upstream_1"))
+
+		var body types.ErrorResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(Succeed())
+		Expect(body.RequestID).To(Equal("req_123"))
+	})
+
+	Context("with tracing", func() {
+		var (
+			exporter    *tracetest.InMemoryExporter
+			traceparent string
+		)
+
+		BeforeEach(func() {
+			exporter = tracetest.NewInMemoryExporter()
+			otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+			DeferCleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+			answer := reply
+			reply = func(w http.ResponseWriter, r *http.Request) {
+				traceparent = r.Header.Get("traceparent")
+				answer(w, r)
+			}
+		})
+
+		// spans returns the ended spans by name, with their attributes
+		spans := func() map[string]map[attribute.Key]attribute.Value {
+			byName := make(map[string]map[attribute.Key]attribute.Value)
+			for _, span := range exporter.GetSpans() {
+				attrs := make(map[attribute.Key]attribute.Value)
+				for _, kv := range span.Attributes {
+					attrs[kv.Key] = kv.Value
+				}
+				byName[span.Name] = attrs
+			}
+			return byName
+		}
+
+		It("traces the completion and the upstream call, and sends the trace context upstream", func() {
+			post(`{"model": "llama", "max_tokens": 50, "messages": [{"role": "user", "content": "Capital of France?"}]}`)
+
+			recorded := exporter.GetSpans()
+			Expect(recorded).To(HaveLen(2))
+			upstreamSpan, chatSpan := recorded[0], recorded[1]
+			Expect(chatSpan.Name).To(Equal("chat llama"))
+			Expect(upstreamSpan.Parent.SpanID()).To(Equal(chatSpan.SpanContext.SpanID()))
+			Expect(traceparent).To(Equal(fmt.Sprintf("00-%s-%s-01", upstreamSpan.SpanContext.TraceID(), upstreamSpan.SpanContext.SpanID())))
+
+			attrs := spans()["chat llama"]
+			Expect(attrs["gen_ai.request.model"].AsString()).To(Equal("llama"))
+			Expect(attrs["gen_ai.request.max_tokens"].AsInt64()).To(Equal(int64(50)))
+			Expect(attrs["gen_ai.response.id"].AsString()).To(Equal("chatcmpl-1"))
+			Expect(attrs["gen_ai.response.finish_reasons"].AsStringSlice()).To(Equal([]string{"stop"}))
+			Expect(attrs["gen_ai.usage.input_tokens"].AsInt64()).To(Equal(int64(10)))
+			Expect(attrs["gen_ai.usage.output_tokens"].AsInt64()).To(Equal(int64(1)))
+			Expect(attrs[tracing.UpstreamKey].AsString()).To(Equal("local/llama"))
+			Expect(attrs[tracing.UpstreamRequestIDKey].AsString()).To(Equal("req_upstream_1"))
+		})
+
+		It("records the time to first token of streams", func() {
+			reply = func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, "data: {\"id\":\"c\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Paris\"},\"finish_reason\":\"stop\"}]}\n\n")
+				io.WriteString(w, "data: [DONE]\n\n")
+			}
+
+			post(`{"model": "llama", "stream": true, "messages": [{"role": "user", "content": "Capital of France?"}]}`)
+
+			attrs := spans()["chat llama"]
+			Expect(attrs).To(HaveKey(tracing.TimeToFirstTokenKey))
+			Expect(attrs["gen_ai.response.id"].AsString()).To(Equal("c"))
+			Expect(attrs["gen_ai.response.finish_reasons"].AsStringSlice()).To(Equal([]string{"stop"}))
+		})
+	})
+
+	Context("with a usage store", func() {
+		BeforeEach(func() {
+			var err error
+			store, err = usage.OpenStore(filepath.Join(GinkgoT().TempDir(), "usage.db"))
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(store.Close)
+		})
+
+		It("stores the usage of each caller for usage reports", func() {
+			req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(`{"model": "llama", "messages": [{"role": "user", "content": "Capital of France?"}]}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			identity.Set(c, &identity.Identity{KeyID: "key_alice", Team: "search"})
+			Expect(service.HandleChatCompletions(c)).To(Succeed())
+
+			now := time.Now()
+			buckets, err := store.Query(usage.Query{Start: now.Add(-time.Hour), End: now.Add(time.Hour), Bucket: usage.BucketDay})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buckets).To(HaveLen(1))
+			Expect(buckets[0].KeyID).To(Equal("key_alice"))
+			Expect(buckets[0].Team).To(Equal("search"))
+			Expect(buckets[0].Model).To(Equal("llama"))
+			Expect(buckets[0].TotalTokens).To(Equal(int64(11)))
+		})
+	})
+
+	Context("with an audit log", func() {
+		var path string
+
+		BeforeEach(func() {
+			config := audit.DefaultConfig()
+			config.Path = filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+			path = config.Path
+			var err error
+			auditLog, err = audit.Open(config)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		// send sends a request as caller and returns the audit records written
+		send := func(caller *identity.Identity, body string) []audit.Record {
+			req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			requestid.Set(c, "req_123")
+			identity.Set(c, caller)
+			Expect(service.HandleChatCompletions(c)).To(Succeed())
+			Expect(auditLog.Close()).To(Succeed())
+
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			var records []audit.Record
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+				if line == "" {
+					continue
+				}
+				var record audit.Record
+				Expect(json.Unmarshal([]byte(line), &record)).To(Succeed())
+				records = append(records, record)
+			}
+			return records
+		}
+
+		It("audits each completion", func() {
+			records := send(&identity.Identity{KeyID: "key_alice", Owner: "alice"}, `{"model": "llama", "temperature": 0.2, "messages": [{"role": "user", "content": "Capital of France?"}]}`)
+			Expect(records).To(HaveLen(1))
+
+			record := records[0]
+			Expect(record.RequestID).To(Equal("req_123"))
+			Expect(record.KeyID).To(Equal("key_alice"))
+			Expect(record.Owner).To(Equal("alice"))
+			Expect(record.Model).To(Equal("llama"))
+			Expect(record.Parameters).To(HaveKeyWithValue("temperature", 0.2))
+			Expect(record.Prompt[0].Content).To(Equal("Capital of France?"))
+			Expect(record.Completions).To(Equal([]audit.Completion{{Content: "Paris", FinishReason: "stop"}}))
+			Expect(record.Usage.TotalTokens).To(Equal(11))
+			Expect(record.Upstream).To(Equal("local/llama"))
+			Expect(record.UpstreamStatus).To(Equal(http.StatusOK))
+			Expect(record.UpstreamRequestID).To(Equal("req_upstream_1"))
+			Expect(record.CompletionID).To(Equal("chatcmpl-1"))
+			Expect(record.Status).To(Equal(http.StatusOK))
+		})
+
+		It("records upstream errors", func() {
+			reply = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"error":{"message":"bad prompt","type":"invalid_request_error"}}`)
+			}
+			records := send(&identity.Identity{KeyID: "key_alice"}, `{"model": "llama", "messages": [{"role": "user", "content": "hi"}]}`)
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].UpstreamStatus).To(Equal(http.StatusBadRequest))
+			Expect(records[0].Status).To(Equal(http.StatusBadRequest))
+			Expect(records[0].Error).To(ContainSubstring("bad prompt"))
+		})
+
+		It("skips callers that opted out", func() {
+			Expect(send(&identity.Identity{KeyID: "key_private", AuditOptOut: true}, `{"model": "llama", "messages": [{"role": "user", "content": "hi"}]}`)).To(BeEmpty())
+		})
+	})
+
+	It("relays streams", func() {
+		reply = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"id\":\"c\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Par\"}}]}\n\n")
+			io.WriteString(w, "data: {\"id\":\"c\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"is\"},\"finish_reason\":\"stop\"}]}\n\n")
+			io.WriteString(w, "data: [DONE]\n\n")
+		}
+
+		rec, c := post(`{"model": "llama", "stream": true, "messages": [{"role": "user", "content": "Capital of France?"}]}`)
+
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring(`"content":"Par"`))
+		Expect(strings.TrimSpace(rec.Body.String())).To(HaveSuffix("data: [DONE]"))
+
+		u, ok := usage.FromContext(c)
+		Expect(ok).To(BeTrue())
+		Expect(u.CompletionTokens).To(BeNumerically(">", 0))
+	})
+
+	It("rejects invalid requests without calling the upstream", func() {
+		rec, _ := post(`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "temperature": 5}`)
+
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+		var errResp types.ErrorResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+		Expect(errResp.Error.Param).To(Equal("temperature"))
+		Expect(metrics.Statuses()).To(BeEmpty())
+	})
+
+	It("maps upstream errors instead of flattening them", func() {
+		reply = func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error":{"message":"Invalid API Key","type":"invalid_request_error","code":"invalid_api_key"}}`)
+		}
+
+		rec, _ := post(`{"model": "llama", "messages": [{"role": "user", "content": "hi"}]}`)
+
+		Expect(rec.Code).To(Equal(http.StatusBadGateway))
+		var errResp types.ErrorResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+		Expect(errResp.Error.Type).To(Equal("api_error"))
+		Expect(errResp.Error.Code).To(Equal("upstream_authentication_failed"))
+		Expect(metrics.Statuses()).To(Equal([]int{http.StatusUnauthorized}))
+	})
+
+	Context("when the upstream is slower than the request timeout", func() {
+		BeforeEach(func() {
+			timeouts.Request = 50 * time.Millisecond
+			reply = func(w http.ResponseWriter, r *http.Request) {
+				// Reading the body lets the server notice the client hanging up
+				io.Copy(io.Discard, r.Body)
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+			}
+		})
+
+		It("gives up with a gateway timeout", func() {
+			rec, _ := post(`{"model": "llama", "messages": [{"role": "user", "content": "hi"}]}`)
+
+			Expect(rec.Code).To(Equal(http.StatusGatewayTimeout))
+			var errResp types.ErrorResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+			Expect(errResp.Error.Code).To(Equal("timeout"))
+		})
+	})
+})
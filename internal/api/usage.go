@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/types"
+	"go-api/internal/usage"
+	"go-api/internal/validation"
+
+	"github.com/labstack/echo/v4"
+)
+
+// dateFormat is the layout of start and end given as plain dates
+const dateFormat = "2006-01-02"
+
+// usageCSVHeader is the first row of usage reports exported as CSV
+var usageCSVHeader = []string{"start", "key_id", "team", "model", "requests", "prompt_tokens", "completion_tokens", "total_tokens"}
+
+// UsageReporter serves usage reports from the usage store the chat handler writes
+type UsageReporter struct {
+	store *usage.Store
+}
+
+// NewUsageReporter creates the usage endpoints for store
+func NewUsageReporter(store *usage.Store) *UsageReporter {
+	return &UsageReporter{store: store}
+}
+
+// OwnUsage handles GET /v1/usage
+// @Summary Get your usage
+// @Description Reports the requests and tokens of the calling key by model, in hourly or daily buckets. Times are in UTC. Send format=csv or Accept: text/csv for CSV.
+// @Tags usage
+// @Produce json,text/csv
+// @Security BearerAuth
+// @Param start query string false "Start of the range, as a date or RFC 3339 time (default: start of this month)"
+// @Param end query string false "End of the range, as a date (included) or RFC 3339 time (excluded). Default: now"
+// @Param bucket query string false "Bucket size: hour or day (default: day)"
+// @Param model query string false "Only report this model"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} types.UsageReport
+// @Failure 400 {object} types.ErrorResponse "Invalid query"
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid API key"
+// @Router /v1/usage [get]
+func (r *UsageReporter) OwnUsage(c echo.Context) error {
+	id, ok := identity.FromContext(c)
+	if !ok {
+		return apierror.Unauthorized("Missing API key")
+	}
+	q, err := usageQuery(c)
+	if err != nil {
+		return err
+	}
+	q.KeyID = id.KeyID
+	return r.report(c, q)
+}
+
+// AllUsage handles GET /admin/usage
+// @Summary Get the usage of every key
+// @Description Reports the requests and tokens of every key by model, in hourly or daily buckets. Times are in UTC. Send format=csv or Accept: text/csv for CSV.
+// @Tags admin
+// @Produce json,text/csv
+// @Security AdminAuth
+// @Param start query string false "Start of the range, as a date or RFC 3339 time (default: start of this month)"
+// @Param end query string false "End of the range, as a date (included) or RFC 3339 time (excluded). Default: now"
+// @Param bucket query string false "Bucket size: hour or day (default: day)"
+// @Param model query string false "Only report this model"
+// @Param key_id query string false "Only report this key"
+// @Param team query string false "Only report the keys of this team"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} types.UsageReport
+// @Failure 400 {object} types.ErrorResponse "Invalid query"
+// @Failure 401 {object} types.ErrorResponse "Missing or invalid admin token"
+// @Router /admin/usage [get]
+func (r *UsageReporter) AllUsage(c echo.Context) error {
+	q, err := usageQuery(c)
+	if err != nil {
+		return err
+	}
+	q.KeyID = c.QueryParam("key_id")
+	q.Team = c.QueryParam("team")
+	return r.report(c, q)
+}
+
+// report writes the usage matching q as JSON or CSV
+func (r *UsageReporter) report(c echo.Context, q usage.Query) error {
+	buckets, err := r.store.Query(q)
+	if err != nil {
+		return apierror.Internal("Failed to read usage").WithCause(err)
+	}
+
+	if wantsCSV(c) {
+		return writeUsageCSV(c, buckets)
+	}
+	return c.JSON(http.StatusOK, types.UsageReport{
+		Object: "list",
+		Bucket: q.Bucket,
+		Start:  q.Start,
+		End:    q.End,
+		Data:   buckets,
+	})
+}
+
+// usageQuery reads the time range, bucket size and model filter shared by both endpoints
+func usageQuery(c echo.Context) (usage.Query, error) {
+	now := time.Now().UTC()
+	q := usage.Query{
+		Start:  time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC),
+		End:    now,
+		Bucket: usage.BucketDay,
+		Model:  c.QueryParam("model"),
+	}
+
+	if bucket := c.QueryParam("bucket"); bucket != "" {
+		if bucket != usage.BucketHour && bucket != usage.BucketDay {
+			return q, apierror.InvalidParam("bucket", validation.CodeInvalidValue, "bucket must be hour or day")
+		}
+		q.Bucket = bucket
+	}
+	if format := c.QueryParam("format"); format != "" && format != "json" && format != "csv" {
+		return q, apierror.InvalidParam("format", validation.CodeInvalidValue, "format must be json or csv")
+	}
+
+	if start := c.QueryParam("start"); start != "" {
+		t, err := parseUsageTime(start, false)
+		if err != nil {
+			return q, apierror.InvalidParam("start", validation.CodeInvalidValue, "start must be a date such as 2025-01-31 or an RFC 3339 time")
+		}
+		q.Start = t
+	}
+	if end := c.QueryParam("end"); end != "" {
+		t, err := parseUsageTime(end, true)
+		if err != nil {
+			return q, apierror.InvalidParam("end", validation.CodeInvalidValue, "end must be a date such as 2025-01-31 or an RFC 3339 time")
+		}
+		q.End = t
+	}
+	if !q.End.After(q.Start) {
+		return q, apierror.InvalidParam("end", validation.CodeInvalidValue, "end must be after start")
+	}
+
+	// Usage is kept by the hour, so ranges start on an hour
+	q.Start = q.Start.Truncate(time.Hour)
+	return q, nil
+}
+
+// parseUsageTime parses a date or an RFC 3339 time as UTC. A date used as
+// the end of a range includes that whole day.
+func parseUsageTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(dateFormat, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// wantsCSV reports whether the caller asked for CSV, with format=csv or an Accept header
+func wantsCSV(c echo.Context) bool {
+	if format := c.QueryParam("format"); format != "" {
+		return format == "csv"
+	}
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/csv")
+}
+
+// writeUsageCSV writes buckets as CSV, one row per bucket after a header row
+func writeUsageCSV(c echo.Context, buckets []types.UsageBucket) error {
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	header.Set(echo.HeaderContentDisposition, `attachment; filename="usage.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	if err := w.Write(usageCSVHeader); err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		err := w.Write([]string{
+			b.Start.Format(time.RFC3339),
+			b.KeyID,
+			b.Team,
+			b.Model,
+			strconv.FormatInt(b.Requests, 10),
+			strconv.FormatInt(b.PromptTokens, 10),
+			strconv.FormatInt(b.CompletionTokens, 10),
+			strconv.FormatInt(b.TotalTokens, 10),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,141 @@
+package api_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-api/internal/api"
+	"go-api/internal/apierror"
+	"go-api/internal/keys"
+	"go-api/internal/routes"
+	"go-api/internal/types"
+	"go-api/internal/usage"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UsageReporter", func() {
+	const adminToken = "admin-token-for-tests"
+
+	var (
+		e          *echo.Echo
+		store      *usage.Store
+		alice, bob keys.Key
+		secret     string
+	)
+
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		keyStore, err := keys.NewStoreFromKeys()
+		Expect(err).NotTo(HaveOccurred())
+		alice, secret, err = keyStore.Create(keys.Key{Owner: "alice", Team: "search"})
+		Expect(err).NotTo(HaveOccurred())
+		bob, _, err = keyStore.Create(keys.Key{Owner: "bob", Team: "ads"})
+		Expect(err).NotTo(HaveOccurred())
+
+		store, err = usage.OpenStore(filepath.Join(GinkgoT().TempDir(), "usage.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() { store.Close() })
+
+		for _, r := range []usage.Record{
+			{Time: day.Add(9 * time.Hour), KeyID: alice.ID, Team: "search", Model: "llama", Usage: types.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}},
+			{Time: day.Add(10 * time.Hour), KeyID: alice.ID, Team: "search", Model: "gemma", Usage: types.Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}},
+			{Time: day.Add(11 * time.Hour), KeyID: bob.ID, Team: "ads", Model: "llama", Usage: types.Usage{PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150}},
+		} {
+			Expect(store.Record(r)).To(Succeed())
+		}
+
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		routes.RegisterUsageRoutes(e, api.NewUsageReporter(store), keyStore, nil, nil, adminToken)
+	})
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	report := func(path, token string) types.UsageReport {
+		rec := get(path, token)
+		ExpectWithOffset(1, rec.Code).To(Equal(http.StatusOK))
+		var report types.UsageReport
+		ExpectWithOffset(1, json.Unmarshal(rec.Body.Bytes(), &report)).To(Succeed())
+		return report
+	}
+
+	It("reports only the caller's own usage", func() {
+		r := report("/v1/usage?start=2025-01-15&end=2025-01-15", secret)
+		Expect(r.Bucket).To(Equal("day"))
+		Expect(r.Start).To(Equal(day))
+		Expect(r.End).To(Equal(day.AddDate(0, 0, 1)))
+		Expect(r.Data).To(HaveLen(2))
+		for _, b := range r.Data {
+			Expect(b.KeyID).To(Equal(alice.ID))
+		}
+
+		r = report("/v1/usage?start=2025-01-15&end=2025-01-15&model=llama&bucket=hour", secret)
+		Expect(r.Data).To(Equal([]types.UsageBucket{{
+			Start: day.Add(9 * time.Hour), KeyID: alice.ID, Team: "search", Model: "llama",
+			Requests: 1, PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15,
+		}}))
+
+		Expect(get("/v1/usage", "").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("reports every key to the admin token", func() {
+		Expect(report("/admin/usage?start=2025-01-15&end=2025-01-16", adminToken).Data).To(HaveLen(3))
+		Expect(report("/admin/usage?start=2025-01-15&end=2025-01-16&team=ads", adminToken).Data).To(HaveLen(1))
+		Expect(report("/admin/usage?start=2025-01-15&end=2025-01-16&key_id="+alice.ID+"&model=gemma", adminToken).Data).To(HaveLen(1))
+
+		// Ranges given as RFC 3339 times exclude the end
+		Expect(report("/admin/usage?start=2025-01-15T00:00:00Z&end=2025-01-15T11:00:00Z", adminToken).Data).To(HaveLen(2))
+
+		Expect(get("/admin/usage", secret).Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("exports CSV", func() {
+		rec := get("/admin/usage?start=2025-01-15&end=2025-01-15&format=csv", adminToken)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get(echo.HeaderContentType)).To(HavePrefix("text/csv"))
+
+		rows, err := csv.NewReader(strings.NewReader(rec.Body.String())).ReadAll()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows).To(HaveLen(4))
+		Expect(rows[0]).To(Equal([]string{"start", "key_id", "team", "model", "requests", "prompt_tokens", "completion_tokens", "total_tokens"}))
+		Expect(rows).To(ContainElement([]string{"2025-01-15T00:00:00Z", bob.ID, "ads", "llama", "1", "100", "50", "150"}))
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/usage?start=2025-01-15", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		req.Header.Set(echo.HeaderAccept, "text/csv")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		Expect(rec.Header().Get(echo.HeaderContentType)).To(HavePrefix("text/csv"))
+	})
+
+	It("rejects invalid queries", func() {
+		for param, query := range map[string]string{
+			"bucket": "bucket=week",
+			"format": "format=xml",
+			"start":  "start=yesterday",
+			"end":    "start=2025-01-15&end=2025-01-14T00:00:00Z",
+		} {
+			rec := get("/admin/usage?"+query, adminToken)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest), query)
+
+			var errResp types.ErrorResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+			Expect(errResp.Error.Param).To(Equal(param))
+		}
+	})
+})
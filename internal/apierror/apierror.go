@@ -0,0 +1,286 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-api/internal/requestid"
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Error types, following the types OpenAI uses where one exists
+const (
+	TypeInvalidRequest      = "invalid_request_error"
+	TypeUnauthorized        = "unauthorized"
+	TypePermission          = "permission_error"
+	TypeNotFound            = "not_found_error"
+	TypeRateLimit           = "rate_limit_error"
+	TypeInsufficientQuota   = "insufficient_quota"
+	TypeAPI                 = "api_error"
+	TypeUpstreamUnavailable = "upstream_unavailable"
+	TypeInternal            = "internal_error"
+)
+
+// Error is an API error with the HTTP status it is sent with
+type Error struct {
+	// Status is the HTTP status code of the response
+	Status int
+	// Type is one of the Type* constants
+	Type string
+	// Message explains the problem to the client
+	Message string
+	// Param names the offending request parameter, if any
+	Param string
+	// Code is a machine-readable error code, if any
+	Code interface{}
+	// Header holds extra response headers, such as Retry-After
+	Header http.Header
+	// Err is the underlying cause. It is logged but never sent to the client.
+	Err error
+}
+
+// New creates an Error
+func New(status int, errType, message string) *Error {
+	return &Error{Status: status, Type: errType, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Type, e.Message, e.Err)
+	}
+	return e.Type + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCode sets the error code
+func (e *Error) WithCode(code interface{}) *Error {
+	e.Code = code
+	return e
+}
+
+// WithParam sets the offending parameter
+func (e *Error) WithParam(param string) *Error {
+	e.Param = param
+	return e
+}
+
+// WithHeader adds a response header
+func (e *Error) WithHeader(key, value string) *Error {
+	if e.Header == nil {
+		e.Header = make(http.Header)
+	}
+	e.Header.Set(key, value)
+	return e
+}
+
+// WithCause records the underlying error
+func (e *Error) WithCause(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// Response returns the OpenAI-style body of the error
+func (e *Error) Response() types.ErrorResponse {
+	var resp types.ErrorResponse
+	resp.Error.Message = e.Message
+	resp.Error.Type = e.Type
+	resp.Error.Param = e.Param
+	resp.Error.Code = e.Code
+	return resp
+}
+
+// InvalidRequest is a 400 for a request that can't be understood
+func InvalidRequest(message string) *Error {
+	return New(http.StatusBadRequest, TypeInvalidRequest, message)
+}
+
+// InvalidParam is a 400 for a request parameter that is missing or invalid
+func InvalidParam(param, code, message string) *Error {
+	return InvalidRequest(message).WithParam(param).WithCode(code)
+}
+
+// Unauthorized is a 401 for a missing or invalid credential
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, TypeUnauthorized, message)
+}
+
+// PermissionDenied is a 403 for a credential that isn't allowed to do what was asked
+func PermissionDenied(message string) *Error {
+	return New(http.StatusForbidden, TypePermission, message).WithCode("permission_denied")
+}
+
+// NotFound is a 404 for a resource that doesn't exist
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, TypeNotFound, message)
+}
+
+// ModelNotFound is a 404 for a model no provider serves
+func ModelNotFound(model string) *Error {
+	return New(http.StatusNotFound, TypeInvalidRequest, "The model `"+model+"` does not exist").
+		WithParam("model").
+		WithCode("model_not_found")
+}
+
+// RateLimited is a 429 for a client sending too much
+func RateLimited(message string) *Error {
+	return New(http.StatusTooManyRequests, TypeRateLimit, message).WithCode("rate_limit_exceeded")
+}
+
+// ConcurrencyLimited is a 429 for a client with too many requests in flight
+func ConcurrencyLimited(message string) *Error {
+	return New(http.StatusTooManyRequests, TypeRateLimit, message).WithCode("concurrency_limit_exceeded")
+}
+
+// InsufficientQuota is a 429 for a client that has used up its quota
+func InsufficientQuota(message string) *Error {
+	return New(http.StatusTooManyRequests, TypeInsufficientQuota, message).WithCode("insufficient_quota")
+}
+
+// Upstream is a 502 for an upstream that failed or returned something unusable
+func Upstream(message string) *Error {
+	return New(http.StatusBadGateway, TypeAPI, message)
+}
+
+// UpstreamUnavailable is a 503 for a model whose upstreams are all out of rotation
+func UpstreamUnavailable(message string) *Error {
+	return New(http.StatusServiceUnavailable, TypeUpstreamUnavailable, message)
+}
+
+// UpstreamTimeout is a 504 for an upstream that didn't respond in time
+func UpstreamTimeout(message string) *Error {
+	return New(http.StatusGatewayTimeout, TypeAPI, message).WithCode("timeout")
+}
+
+// Internal is a 500 for a failure of our own
+func Internal(message string) *Error {
+	return New(http.StatusInternalServerError, TypeInternal, message)
+}
+
+// FromUpstream maps an upstream error response to the error sent to the client.
+// Client errors keep their status and the upstream's message, since they are
+// about the request. Upstream credential problems and server errors are ours,
+// not the client's, so they become gateway errors.
+func FromUpstream(providerName string, status int, header http.Header, body []byte) *Error {
+	var upstream types.ErrorResponse
+	message := ""
+	if err := json.Unmarshal(body, &upstream); err == nil {
+		message = upstream.Error.Message
+	}
+	if message == "" {
+		message = strings.TrimSpace(string(body))
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+
+	var e *Error
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e = Upstream("The upstream provider " + providerName + " rejected the gateway's credentials").
+			WithCode("upstream_authentication_failed")
+	case status == http.StatusNotFound:
+		e = New(http.StatusNotFound, TypeInvalidRequest, message).WithCode(upstream.Error.Code)
+	case status == http.StatusTooManyRequests:
+		e = New(http.StatusTooManyRequests, TypeRateLimit, message).WithCode("upstream_rate_limited")
+		if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+			e.WithHeader("Retry-After", retryAfter)
+		}
+	case status == http.StatusServiceUnavailable:
+		e = UpstreamUnavailable(message)
+	case status == http.StatusGatewayTimeout:
+		e = UpstreamTimeout(message)
+	case status >= 400 && status < 500:
+		// Anything else the upstream didn't like is a problem with the request
+		e = InvalidRequest(message).WithParam(upstream.Error.Param).WithCode(upstream.Error.Code)
+		if status == http.StatusRequestEntityTooLarge {
+			e.Status = status
+		}
+	default:
+		e = Upstream(message)
+	}
+
+	return e.WithCause(fmt.Errorf("%s returned status %d", providerName, status))
+}
+
+// Write sends err to the client as an OpenAI-style error. Anything that isn't
+// an *Error or *echo.HTTPError is reported as a 500 without its details.
+func Write(c echo.Context, err error) error {
+	e := From(err)
+	for key, values := range e.Header {
+		for _, value := range values {
+			c.Response().Header().Add(key, value)
+		}
+	}
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(e.Status)
+	}
+	resp := e.Response()
+	resp.RequestID = requestid.FromEcho(c)
+	return c.JSON(e.Status, resp)
+}
+
+// From converts any error to an *Error
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return fromHTTPError(httpErr)
+	}
+
+	return Internal("Internal server error").WithCause(err)
+}
+
+// fromHTTPError converts errors raised by Echo itself, such as unknown routes or bad bodies
+func fromHTTPError(httpErr *echo.HTTPError) *Error {
+	message, ok := httpErr.Message.(string)
+	if !ok {
+		message = http.StatusText(httpErr.Code)
+	}
+
+	switch {
+	case httpErr.Code == http.StatusUnauthorized:
+		return Unauthorized(message)
+	case httpErr.Code == http.StatusForbidden:
+		return PermissionDenied(message)
+	case httpErr.Code == http.StatusNotFound:
+		return NotFound(message)
+	case httpErr.Code == http.StatusTooManyRequests:
+		return RateLimited(message)
+	case httpErr.Code >= 400 && httpErr.Code < 500:
+		e := InvalidRequest(message)
+		e.Status = httpErr.Code
+		return e
+	default:
+		e := Internal(message).WithCause(httpErr.Internal)
+		e.Status = httpErr.Code
+		return e
+	}
+}
+
+// HTTPErrorHandler renders every error returned by a handler or middleware
+// as an OpenAI-style error. Set it as echo.Echo.HTTPErrorHandler.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	e := From(err)
+	if e.Status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+	if writeErr := Write(c, e); writeErr != nil {
+		c.Logger().Error(writeErr)
+	}
+}
@@ -0,0 +1,110 @@
+package apierror_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-api/internal/apierror"
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FromUpstream", func() {
+	DescribeTable("maps upstream errors to the status and type the client sees",
+		func(status int, body string, wantStatus int, wantType string, wantCode interface{}) {
+			e := apierror.FromUpstream("groq", status, http.Header{}, []byte(body))
+			Expect(e.Status).To(Equal(wantStatus))
+			Expect(e.Type).To(Equal(wantType))
+			if wantCode == nil {
+				Expect(e.Code).To(BeNil())
+			} else {
+				Expect(e.Code).To(Equal(wantCode))
+			}
+		},
+		Entry("bad request keeps the upstream's param and code", http.StatusBadRequest,
+			`{"error":{"message":"context too long","type":"invalid_request_error","param":"messages","code":"context_length_exceeded"}}`,
+			http.StatusBadRequest, apierror.TypeInvalidRequest, "context_length_exceeded"),
+		Entry("unprocessable entity is a bad request", http.StatusUnprocessableEntity, `{"error":{"message":"bad"}}`,
+			http.StatusBadRequest, apierror.TypeInvalidRequest, nil),
+		Entry("our credentials being rejected is a gateway error", http.StatusUnauthorized, `{"error":{"message":"Invalid API Key"}}`,
+			http.StatusBadGateway, apierror.TypeAPI, "upstream_authentication_failed"),
+		Entry("unknown upstream model", http.StatusNotFound, `{"error":{"message":"model not found","code":"model_not_found"}}`,
+			http.StatusNotFound, apierror.TypeInvalidRequest, "model_not_found"),
+		Entry("upstream rate limits", http.StatusTooManyRequests, `{"error":{"message":"slow down"}}`,
+			http.StatusTooManyRequests, apierror.TypeRateLimit, "upstream_rate_limited"),
+		Entry("upstream server errors", http.StatusInternalServerError, `oops`,
+			http.StatusBadGateway, apierror.TypeAPI, nil),
+		Entry("upstream overload", http.StatusServiceUnavailable, ``,
+			http.StatusServiceUnavailable, apierror.TypeUpstreamUnavailable, nil),
+	)
+
+	It("keeps the upstream message and Retry-After", func() {
+		header := http.Header{"Retry-After": []string{"7"}}
+		e := apierror.FromUpstream("groq", http.StatusTooManyRequests, header, []byte(`{"error":{"message":"slow down"}}`))
+		Expect(e.Message).To(Equal("slow down"))
+		Expect(e.Header.Get("Retry-After")).To(Equal("7"))
+	})
+
+	It("falls back to the raw body as the message", func() {
+		e := apierror.FromUpstream("vllm", http.StatusBadGateway, http.Header{}, []byte("upstream connect error\n"))
+		Expect(e.Message).To(Equal("upstream connect error"))
+	})
+})
+
+var _ = Describe("HTTPErrorHandler", func() {
+	// render runs err through the handler and returns the response
+	render := func(err error) (*httptest.ResponseRecorder, types.ErrorResponse) {
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/chat/completions", nil), rec)
+		apierror.HTTPErrorHandler(err, c)
+
+		var body types.ErrorResponse
+		ExpectWithOffset(1, json.Unmarshal(rec.Body.Bytes(), &body)).To(Succeed())
+		return rec, body
+	}
+
+	It("renders API errors with their status, fields and headers", func() {
+		rec, body := render(apierror.RateLimited("Too many requests").WithHeader("Retry-After", "2"))
+
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("2"))
+		Expect(body.Error.Type).To(Equal(apierror.TypeRateLimit))
+		Expect(body.Error.Code).To(Equal("rate_limit_exceeded"))
+		Expect(body.Error.Message).To(Equal("Too many requests"))
+	})
+
+	It("renders wrapped API errors", func() {
+		rec, body := render(errors.Join(errors.New("context"), apierror.Unauthorized("Invalid API key")))
+
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+		Expect(body.Error.Type).To(Equal(apierror.TypeUnauthorized))
+	})
+
+	It("renders Echo's own errors", func() {
+		rec, body := render(echo.ErrNotFound)
+
+		Expect(rec.Code).To(Equal(http.StatusNotFound))
+		Expect(body.Error.Type).To(Equal(apierror.TypeNotFound))
+		Expect(body.Error.Message).To(Equal("Not Found"))
+	})
+
+	It("hides the details of unexpected errors", func() {
+		rec, body := render(errors.New("database password is hunter2"))
+
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(body.Error.Type).To(Equal(apierror.TypeInternal))
+		Expect(body.Error.Message).NotTo(ContainSubstring("hunter2"))
+	})
+})
+
+func TestAPIError(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "API Error Suite")
+}
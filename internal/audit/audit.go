@@ -0,0 +1,259 @@
+// Package audit writes an audit log of chat completions: one JSON record per
+// line with who asked what, what came back and how long it took, masked by
+// redaction rules and written in the background.
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-api/internal/types"
+)
+
+// dropWarningInterval is how often dropped records are reported in the log
+const dropWarningInterval = time.Minute
+
+// Record is the audit record of one chat completion
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+
+	// KeyID, Owner and Team identify the caller
+	KeyID string `json:"key_id,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Team  string `json:"team,omitempty"`
+
+	// Model is the model asked for, and Parameters every other field of the
+	// request except its messages
+	Model      string         `json:"model"`
+	Parameters map[string]any `json:"parameters,omitempty"`
+
+	// Prompt holds the messages of the request
+	Prompt []Message `json:"prompt"`
+
+	// Completions holds what the model generated, one per choice
+	Completions []Completion `json:"completions,omitempty"`
+
+	Usage *types.Usage `json:"usage,omitempty"`
+
+	// LatencyMS is how long the request took, in milliseconds, until the
+	// response or the stream had been sent
+	LatencyMS int64 `json:"latency_ms"`
+
+	// Upstream names the provider and model that served the request, and
+	// UpstreamStatus the status it answered with
+	Upstream       string `json:"upstream,omitempty"`
+	UpstreamStatus int    `json:"upstream_status,omitempty"`
+
+	// UpstreamRequestID is the ID the upstream gave the request, and
+	// CompletionID the id of the completion it returned
+	UpstreamRequestID string `json:"upstream_request_id,omitempty"`
+	CompletionID      string `json:"completion_id,omitempty"`
+
+	// Status is the status sent to the caller
+	Status int `json:"status"`
+
+	// Error describes why the request failed, if it did
+	Error string `json:"error,omitempty"`
+}
+
+// Message is a prompt message as audited
+type Message struct {
+	Role       string `json:"role"`
+	Name       string `json:"name,omitempty"`
+	Content    string `json:"content"`
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// Completion is a generated choice as audited
+type Completion struct {
+	Index        int              `json:"index"`
+	Content      string           `json:"content"`
+	ToolCalls    []types.ToolCall `json:"tool_calls,omitempty"`
+	FinishReason string           `json:"finish_reason,omitempty"`
+}
+
+// NewRecord starts the record of req, copying its messages and parameters
+func NewRecord(req *types.ChatRequest) *Record {
+	record := &Record{Time: time.Now().UTC(), Model: req.Model}
+	for _, m := range req.Messages {
+		record.Prompt = append(record.Prompt, Message{Role: m.Role, Name: m.Name, Content: m.Text(), ToolCallID: m.ToolCallID})
+	}
+
+	// Parameters are what remains of the request once its model and messages are taken out
+	if data, err := json.Marshal(req); err == nil {
+		var parameters map[string]any
+		if json.Unmarshal(data, &parameters) == nil {
+			delete(parameters, "model")
+			delete(parameters, "messages")
+			record.Parameters = parameters
+		}
+	}
+	return record
+}
+
+// SetUpstream records the upstream that served the request, the status it
+// answered with and the ID it gave the request
+func (r *Record) SetUpstream(upstream string, status int, requestID string) {
+	if r == nil {
+		return
+	}
+	r.Upstream, r.UpstreamStatus, r.UpstreamRequestID = upstream, status, requestID
+}
+
+// SetError records why the request failed
+func (r *Record) SetError(message string) {
+	if r == nil {
+		return
+	}
+	r.Error = message
+}
+
+// SetUsage records the usage of the completion
+func (r *Record) SetUsage(u types.Usage) {
+	if r == nil {
+		return
+	}
+	r.Usage = &u
+}
+
+// SetCompletions records the id of the completion and the choices the model
+// generated. Like the other setters, it does nothing on a nil record, so
+// callers needn't check whether the request is audited.
+func (r *Record) SetCompletions(id string, choices []types.Choice) {
+	if r == nil {
+		return
+	}
+	r.CompletionID = id
+	r.Completions = r.Completions[:0]
+	for _, choice := range choices {
+		r.Completions = append(r.Completions, Completion{
+			Index:        choice.Index,
+			Content:      choice.Message.Text(),
+			ToolCalls:    choice.Message.ToolCalls,
+			FinishReason: choice.FinishReason,
+		})
+	}
+}
+
+// redact masks the free text of the record: prompts, completions, tool call
+// arguments and string parameters
+func (r *Record) redact(redactor *Redactor) {
+	for i := range r.Prompt {
+		r.Prompt[i].Content = redactor.String(r.Prompt[i].Content)
+	}
+	for i := range r.Completions {
+		c := &r.Completions[i]
+		c.Content = redactor.String(c.Content)
+		// The tool calls are shared with the response, so they are copied before masking
+		calls := make([]types.ToolCall, len(c.ToolCalls))
+		copy(calls, c.ToolCalls)
+		for j := range calls {
+			calls[j].Function.Arguments = redactor.String(calls[j].Function.Arguments)
+		}
+		c.ToolCalls = calls
+	}
+	for k, v := range r.Parameters {
+		r.Parameters[k] = redactor.Value(v)
+	}
+}
+
+// Logger writes audit records to a rotating JSONL file from a background
+// goroutine. Log never blocks: when the buffer is full, records are dropped
+// and counted.
+type Logger struct {
+	redactor *Redactor
+	file     *rotatingFile
+	records  chan *Record
+	done     chan struct{}
+
+	// mu guards closed, so that no record is sent once records is closed
+	mu     sync.RWMutex
+	closed bool
+
+	dropped  atomic.Int64
+	lastWarn atomic.Int64
+}
+
+// Open starts a logger writing to the file in config
+func Open(config *Config) (*Logger, error) {
+	redactor, err := NewRedactor(config.Redact)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openRotatingFile(config.Path, int64(config.MaxSizeMB)<<20, config.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		redactor: redactor,
+		file:     file,
+		records:  make(chan *Record, config.BufferSize),
+		done:     make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Log queues record to be written. The logger owns it from then on. Nil
+// and closed loggers discard every record.
+func (l *Logger) Log(record *Record) {
+	if l == nil {
+		return
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.records <- record:
+	default:
+		dropped := l.dropped.Add(1)
+		now := time.Now().UnixNano()
+		last := l.lastWarn.Load()
+		if now-last >= int64(dropWarningInterval) && l.lastWarn.CompareAndSwap(last, now) {
+			log.Printf("Audit log buffer full, %d records dropped so far", dropped)
+		}
+	}
+}
+
+// Dropped returns how many records were dropped because the buffer was full
+func (l *Logger) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+// Close writes the records still queued and closes the file
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.records)
+	l.mu.Unlock()
+
+	<-l.done
+	return l.file.Close()
+}
+
+// run writes queued records until the logger is closed
+func (l *Logger) run() {
+	defer close(l.done)
+	for record := range l.records {
+		record.redact(l.redactor)
+		line, err := json.Marshal(record)
+		if err != nil {
+			log.Printf("Failed to encode audit record: %v", err)
+			continue
+		}
+		if _, err := l.file.Write(append(line, '\n')); err != nil {
+			log.Printf("Failed to write audit record: %v", err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package audit_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-api/internal/audit"
+	"go-api/internal/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAudit(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Audit Suite")
+}
+
+// readRecords decodes every record in the JSONL file at path
+func readRecords(path string) []audit.Record {
+	file, err := os.Open(path)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	defer file.Close()
+
+	var records []audit.Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record audit.Record
+		ExpectWithOffset(1, json.Unmarshal(scanner.Bytes(), &record)).To(Succeed())
+		records = append(records, record)
+	}
+	ExpectWithOffset(1, scanner.Err()).NotTo(HaveOccurred())
+	return records
+}
+
+var _ = Describe("Logger", func() {
+	var (
+		config *audit.Config
+		req    *types.ChatRequest
+	)
+
+	BeforeEach(func() {
+		config = audit.DefaultConfig()
+		config.Path = filepath.Join(GinkgoT().TempDir(), "audit.jsonl")
+
+		temperature := 0.5
+		req = &types.ChatRequest{
+			Model:       "llama-3.3-70b-versatile",
+			Temperature: &temperature,
+			MaxTokens:   100,
+			User:        "alice@example.com",
+			Messages: []types.Message{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "Email bob@example.com, card 4111 1111 1111 1111."},
+			},
+		}
+	})
+
+	open := func() *audit.Logger {
+		logger, err := audit.Open(config)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return logger
+	}
+
+	It("writes one record per completion", func() {
+		logger := open()
+
+		record := audit.NewRecord(req)
+		record.RequestID = "req_1"
+		record.KeyID = "key_alice"
+		record.SetUpstream("groq/llama-3.3-70b-versatile", 200, "req_groq_1")
+		record.SetUsage(types.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12})
+		record.SetCompletions("chatcmpl-1", []types.Choice{{Message: types.Message{Role: "assistant", Content: "Done."}, FinishReason: "stop"}})
+		record.Status = 200
+		logger.Log(record)
+		logger.Log(audit.NewRecord(req))
+		Expect(logger.Close()).To(Succeed())
+
+		records := readRecords(config.Path)
+		Expect(records).To(HaveLen(2))
+		first := records[0]
+		Expect(first.RequestID).To(Equal("req_1"))
+		Expect(first.KeyID).To(Equal("key_alice"))
+		Expect(first.Model).To(Equal("llama-3.3-70b-versatile"))
+		Expect(first.Parameters).To(HaveKeyWithValue("temperature", 0.5))
+		Expect(first.Parameters).To(HaveKeyWithValue("max_tokens", 100.0))
+		Expect(first.Parameters).NotTo(HaveKey("messages"))
+		Expect(first.Prompt).To(HaveLen(2))
+		Expect(first.Prompt[0].Content).To(Equal("Be brief."))
+		Expect(first.Completions).To(Equal([]audit.Completion{{Content: "Done.", FinishReason: "stop"}}))
+		Expect(first.Usage.TotalTokens).To(Equal(12))
+		Expect(first.Upstream).To(Equal("groq/llama-3.3-70b-versatile"))
+		Expect(first.UpstreamStatus).To(Equal(200))
+		Expect(first.UpstreamRequestID).To(Equal("req_groq_1"))
+		Expect(first.CompletionID).To(Equal("chatcmpl-1"))
+	})
+
+	It("masks personal data before writing", func() {
+		logger := open()
+		record := audit.NewRecord(req)
+		record.SetCompletions("chatcmpl-1", []types.Choice{{Message: types.Message{
+			Content:   "I'll write to bob@example.com.",
+			ToolCalls: []types.ToolCall{{ID: "call_1", Type: "function", Function: types.FunctionCall{Name: "send", Arguments: `{"to":"bob@example.com"}`}}},
+		}}})
+		logger.Log(record)
+		Expect(logger.Close()).To(Succeed())
+
+		written := readRecords(config.Path)[0]
+		Expect(written.Prompt[1].Content).To(Equal("Email [REDACTED:email], card [REDACTED:card]."))
+		Expect(written.Completions[0].Content).To(Equal("I'll write to [REDACTED:email]."))
+		Expect(written.Completions[0].ToolCalls[0].Function.Arguments).To(Equal(`{"to":"[REDACTED:email]"}`))
+		Expect(written.Parameters).To(HaveKeyWithValue("user", "[REDACTED:email]"))
+
+		data, err := os.ReadFile(config.Path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).NotTo(ContainSubstring("example.com"))
+	})
+
+	It("uses the configured redaction rules", func() {
+		config.Redact = []audit.Rule{{Name: "secret", Pattern: `(?i)project \w+`, Replacement: "[PROJECT]"}}
+		logger := open()
+		req.Messages[1].Content = "Tell me about Project Falcon, mail bob@example.com"
+		logger.Log(audit.NewRecord(req))
+		Expect(logger.Close()).To(Succeed())
+
+		Expect(readRecords(config.Path)[0].Prompt[1].Content).To(Equal("Tell me about [PROJECT], mail bob@example.com"))
+	})
+
+	It("drops records rather than block when the buffer is full", func() {
+		config.BufferSize = 1
+		logger := open()
+		for i := 0; i < 1000; i++ {
+			logger.Log(audit.NewRecord(req))
+		}
+		Expect(logger.Close()).To(Succeed())
+
+		written := int64(len(readRecords(config.Path)))
+		Expect(written).To(BeNumerically(">=", 1))
+		Expect(written + logger.Dropped()).To(Equal(int64(1000)))
+
+		// Closed and nil loggers discard records
+		logger.Log(audit.NewRecord(req))
+		var none *audit.Logger
+		none.Log(audit.NewRecord(req))
+	})
+
+	It("rotates the file once it grows past its maximum size", func() {
+		config.MaxSizeMB = 1
+		config.MaxBackups = 2
+		req.Messages[1].Content = strings.Repeat("a", 300<<10)
+		logger := open()
+		for i := 0; i < 10; i++ {
+			logger.Log(audit.NewRecord(req))
+		}
+		Expect(logger.Close()).To(Succeed())
+
+		Expect(config.Path + ".1").To(BeAnExistingFile())
+		Expect(config.Path + ".2").To(BeAnExistingFile())
+		Expect(config.Path + ".3").NotTo(BeAnExistingFile())
+		for _, path := range []string{config.Path, config.Path + ".1", config.Path + ".2"} {
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Size()).To(BeNumerically("<=", 1<<20))
+		}
+	})
+})
+
+var _ = Describe("Config", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "audit.yaml")
+	})
+
+	It("is disabled without a config file", func() {
+		config, err := audit.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Enabled).To(BeFalse())
+		Expect(config.Redact).To(Equal(audit.DefaultRules()))
+	})
+
+	It("reads the file over the defaults", func() {
+		Expect(os.WriteFile(path, []byte("enabled: true\nmax_backups: 1\nredact: []\n"), 0o600)).To(Succeed())
+		config, err := audit.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Enabled).To(BeTrue())
+		Expect(config.Path).To(Equal(audit.DefaultPath))
+		Expect(config.MaxBackups).To(Equal(1))
+		Expect(config.Redact).To(BeEmpty())
+	})
+
+	It("rejects invalid patterns and sizes", func() {
+		Expect(os.WriteFile(path, []byte("redact:\n  - name: broken\n    pattern: '('\n"), 0o600)).To(Succeed())
+		_, err := audit.LoadConfig(path)
+		Expect(err).To(MatchError(ContainSubstring("broken")))
+
+		Expect(os.WriteFile(path, []byte("buffer_size: 0\n"), 0o600)).To(Succeed())
+		_, err = audit.LoadConfig(path)
+		Expect(err).To(MatchError(ContainSubstring("buffer_size")))
+	})
+})
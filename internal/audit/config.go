@@ -0,0 +1,173 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultPath is where records are written when the config names no file
+	DefaultPath = "audit.jsonl"
+
+	// DefaultMaxSizeMB is how large the log grows before it is rotated
+	DefaultMaxSizeMB = 100
+
+	// DefaultMaxBackups is how many rotated logs are kept
+	DefaultMaxBackups = 5
+
+	// DefaultBufferSize is how many records may wait to be written before new ones are dropped
+	DefaultBufferSize = 1000
+)
+
+// Config configures the audit log, as read from a file such as audit.yaml
+type Config struct {
+	// Enabled turns the audit log on. It is off by default.
+	Enabled bool `yaml:"enabled"`
+
+	// Path is the file records are appended to
+	Path string `yaml:"path"`
+
+	// MaxSizeMB is how large the file grows before it is renamed to Path.1,
+	// shifting older files up, and a new one started
+	MaxSizeMB int `yaml:"max_size_mb"`
+
+	// MaxBackups is how many rotated files are kept. Older ones are deleted.
+	MaxBackups int `yaml:"max_backups"`
+
+	// BufferSize is how many records may wait to be written. Records that
+	// arrive while it is full are dropped, so completions never wait on the log.
+	BufferSize int `yaml:"buffer_size"`
+
+	// Redact lists the patterns masked in prompts, completions and string
+	// parameters before they are written. Leaving it out uses DefaultRules.
+	Redact []Rule `yaml:"redact"`
+}
+
+// Rule masks every match of a regular expression
+type Rule struct {
+	// Name says what the rule masks, such as email
+	Name string `yaml:"name"`
+
+	// Pattern is the regular expression to mask, in Go syntax
+	Pattern string `yaml:"pattern"`
+
+	// Replacement replaces each match. Defaults to [REDACTED:<name>].
+	Replacement string `yaml:"replacement,omitempty"`
+}
+
+// DefaultRules mask email addresses, card numbers, phone numbers and API keys
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "email", Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+		{Name: "card", Pattern: `\b(?:\d[ -]?){12,18}\d\b`},
+		{Name: "phone", Pattern: `\+?\d{1,3}[ .-]?\(?\d{3}\)?[ .-]?\d{3}[ .-]?\d{4}\b`},
+		{Name: "api_key", Pattern: `\b(?:sk|gsk|sk-ant|scarlett)[-_][A-Za-z0-9_-]{16,}`},
+	}
+}
+
+// DefaultConfig returns the config used without a config file: disabled
+func DefaultConfig() *Config {
+	return &Config{
+		Path:       DefaultPath,
+		MaxSizeMB:  DefaultMaxSizeMB,
+		MaxBackups: DefaultMaxBackups,
+		BufferSize: DefaultBufferSize,
+		Redact:     DefaultRules(),
+	}
+}
+
+// LoadConfig reads the config file at path. A missing file gives DefaultConfig.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("Warning: %s not found, the audit log is disabled", path)
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultConfig()
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// validate checks the sizes and that every rule compiles
+func (c *Config) validate() error {
+	if c.Path == "" {
+		return errors.New("path must not be empty")
+	}
+	if c.MaxSizeMB <= 0 {
+		return errors.New("max_size_mb must be positive")
+	}
+	if c.MaxBackups < 0 {
+		return errors.New("max_backups must not be negative")
+	}
+	if c.BufferSize <= 0 {
+		return errors.New("buffer_size must be positive")
+	}
+	_, err := NewRedactor(c.Redact)
+	return err
+}
+
+// Redactor masks the matches of its rules
+type Redactor struct {
+	patterns     []*regexp.Regexp
+	replacements []string
+}
+
+// NewRedactor compiles rules
+func NewRedactor(rules []Rule) (*Redactor, error) {
+	r := &Redactor{}
+	for i, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact[%d] (%s): %w", i, rule.Name, err)
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED:" + rule.Name + "]"
+		}
+		r.patterns = append(r.patterns, pattern)
+		r.replacements = append(r.replacements, replacement)
+	}
+	return r, nil
+}
+
+// String masks every match in s. Replacements are literal.
+func (r *Redactor) String(s string) string {
+	for i, pattern := range r.patterns {
+		s = pattern.ReplaceAllLiteralString(s, r.replacements[i])
+	}
+	return s
+}
+
+// Value masks every string in v, a value decoded from JSON, recursing into maps and slices
+func (r *Redactor) Value(v any) any {
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case map[string]any:
+		for k, item := range v {
+			v[k] = r.Value(item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = r.Value(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+)
+
+// rotatingFile appends to a file, renaming it to path.1 and starting a new
+// one once it would grow past maxSize. Older files shift up to path.N, and
+// those past maxBackups are deleted.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+}
+
+// openRotatingFile opens path for appending, creating it if it doesn't exist
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p, rotating first if it would take the file past its maximum
+// size. A single write larger than the maximum still goes into a file of its own.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
+
+// open opens the current file and reads its size
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate shifts the backups up, moves the current file to path.1 and starts a new one
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+
+	if err := os.Remove(f.backup(f.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(f.backup(i), f.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, f.backup(1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// backup returns the path of the nth most recent rotated file
+func (f *rotatingFile) backup(n int) string {
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
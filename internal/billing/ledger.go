@@ -0,0 +1,163 @@
+package billing
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Month returns the calendar month holding t, in UTC, as budgets reset with
+// it: for example "2025-01"
+func Month(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// Ledger records what each caller has spent, by calendar month
+type Ledger interface {
+	// Spent returns what key has spent in month, in USD
+	Spent(key, month string) (float64, error)
+
+	// Charge adds cost to what key has spent in month and returns the new
+	// total. A negative cost refunds.
+	Charge(key, month string, cost float64) (float64, error)
+
+	// Reserve adds cost to what key has spent in month, unless that would
+	// take it over limit, and returns the total. The check and the addition
+	// are one step, so concurrent reservations can't overshoot the limit
+	// together. ok is false, and nothing is added, if cost doesn't fit.
+	Reserve(key, month string, cost, limit float64) (total float64, ok bool, err error)
+
+	// Close releases the ledger's resources
+	Close() error
+}
+
+// spendBucket is the bucket spend is stored in, under the caller's key and the month
+var spendBucket = []byte("spend")
+
+// BoltLedger keeps the ledger in an embedded BoltDB database, so spend
+// survives restarts. Each entry is a float64 of USD.
+type BoltLedger struct {
+	db *bolt.DB
+}
+
+// OpenBoltLedger opens the ledger database at path, creating it if it doesn't exist
+func OpenBoltLedger(path string) (*BoltLedger, error) {
+	// Fail rather than hang if another process holds the database
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(spendBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltLedger{db: db}, nil
+}
+
+func (l *BoltLedger) Spent(key, month string) (float64, error) {
+	var spent float64
+	err := l.db.View(func(tx *bolt.Tx) error {
+		spent = decodeAmount(tx.Bucket(spendBucket).Get(ledgerKey(key, month)))
+		return nil
+	})
+	return spent, err
+}
+
+func (l *BoltLedger) Charge(key, month string, cost float64) (float64, error) {
+	var total float64
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(spendBucket)
+		id := ledgerKey(key, month)
+		total = decodeAmount(bucket.Get(id)) + cost
+		return bucket.Put(id, encodeAmount(total))
+	})
+	return total, err
+}
+
+func (l *BoltLedger) Reserve(key, month string, cost, limit float64) (float64, bool, error) {
+	var (
+		total float64
+		ok    bool
+	)
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(spendBucket)
+		id := ledgerKey(key, month)
+		total = decodeAmount(bucket.Get(id))
+		if total+cost > limit {
+			return nil
+		}
+		total, ok = total+cost, true
+		return bucket.Put(id, encodeAmount(total))
+	})
+	return total, ok, err
+}
+
+func (l *BoltLedger) Close() error {
+	return l.db.Close()
+}
+
+// ledgerKey is the database key of a caller's spend in a month
+func ledgerKey(key, month string) []byte {
+	return []byte(key + "/" + month)
+}
+
+// encodeAmount stores an amount as the big-endian bits of a float64
+func encodeAmount(amount float64) []byte {
+	return binary.BigEndian.AppendUint64(nil, math.Float64bits(amount))
+}
+
+// decodeAmount reads an amount stored by encodeAmount. A missing entry is zero.
+func decodeAmount(data []byte) float64 {
+	if len(data) != 8 {
+		return 0
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(data))
+}
+
+// MemoryLedger keeps the ledger in memory, for tests and for running without a database
+type MemoryLedger struct {
+	mu    sync.Mutex
+	spent map[string]float64
+}
+
+// NewMemoryLedger creates an empty ledger
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{spent: make(map[string]float64)}
+}
+
+func (l *MemoryLedger) Spent(key, month string) (float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.spent[key+"/"+month], nil
+}
+
+func (l *MemoryLedger) Charge(key, month string, cost float64) (float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.spent[key+"/"+month] += cost
+	return l.spent[key+"/"+month], nil
+}
+
+func (l *MemoryLedger) Reserve(key, month string, cost, limit float64) (float64, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	total := l.spent[key+"/"+month]
+	if total+cost > limit {
+		return total, false, nil
+	}
+	l.spent[key+"/"+month] = total + cost
+	return total + cost, true, nil
+}
+
+func (l *MemoryLedger) Close() error {
+	return nil
+}
@@ -0,0 +1,88 @@
+package billing_test
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-api/internal/billing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BoltLedger", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "ledger.db")
+	})
+
+	open := func() *billing.BoltLedger {
+		ledger, err := billing.OpenBoltLedger(path)
+		Expect(err).NotTo(HaveOccurred())
+		return ledger
+	}
+
+	It("adds up spend by key and month", func() {
+		ledger := open()
+		defer ledger.Close()
+
+		Expect(ledger.Spent("key_alice", "2025-01")).To(BeZero())
+
+		Expect(ledger.Charge("key_alice", "2025-01", 0.25)).To(Equal(0.25))
+		Expect(ledger.Charge("key_alice", "2025-01", 0.5)).To(Equal(0.75))
+		Expect(ledger.Charge("key_alice", "2025-02", 1)).To(Equal(1.0))
+		Expect(ledger.Charge("key_bob", "2025-01", 2)).To(Equal(2.0))
+
+		Expect(ledger.Spent("key_alice", "2025-01")).To(Equal(0.75))
+		Expect(ledger.Spent("key_alice", "2025-02")).To(Equal(1.0))
+		Expect(ledger.Spent("key_bob", "2025-01")).To(Equal(2.0))
+	})
+
+	It("reserves spend only within the limit, however many callers race for it", func() {
+		ledger := open()
+		defer ledger.Close()
+
+		var (
+			wg       sync.WaitGroup
+			reserved atomic.Int32
+		)
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, ok, err := ledger.Reserve("key_alice", "2025-01", 0.25, 1); err == nil && ok {
+					reserved.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		Expect(reserved.Load()).To(BeEquivalentTo(4))
+
+		total, ok, err := ledger.Reserve("key_alice", "2025-01", 0.25, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+		Expect(total).To(Equal(1.0))
+
+		// Settling refunds what wasn't used
+		Expect(ledger.Charge("key_alice", "2025-01", -0.5)).To(Equal(0.5))
+	})
+
+	It("keeps spend across restarts", func() {
+		ledger := open()
+		_, err := ledger.Charge("key_alice", "2025-01", 1.5)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ledger.Close()).To(Succeed())
+
+		ledger = open()
+		defer ledger.Close()
+		Expect(ledger.Spent("key_alice", "2025-01")).To(Equal(1.5))
+	})
+
+	It("groups spend by calendar month in UTC", func() {
+		newYork := time.FixedZone("EST", -5*60*60)
+		Expect(billing.Month(time.Date(2025, 1, 31, 22, 0, 0, 0, newYork))).To(Equal("2025-02"))
+	})
+})
@@ -0,0 +1,112 @@
+// Package billing prices completions, keeps a ledger of what each caller has
+// spent, and holds callers to their monthly budgets.
+package billing
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// CostContextKey is the echo context key holding the cost in USD of the completion served
+const CostContextKey = "cost_usd"
+
+// perMillion converts prices per million tokens to prices per token
+const perMillion = 1_000_000
+
+// Price is what a model costs, in USD per million tokens
+type Price struct {
+	// Input is the price of prompt tokens
+	Input float64 `yaml:"input"`
+
+	// Output is the price of completion tokens
+	Output float64 `yaml:"output"`
+}
+
+// Cost returns what usage costs at this price, in USD
+func (p Price) Cost(u types.Usage) float64 {
+	return (float64(u.PromptTokens)*p.Input + float64(u.CompletionTokens)*p.Output) / perMillion
+}
+
+// Pricing is the price of each model, as read from a file such as pricing.yaml
+type Pricing struct {
+	// Default prices models that aren't listed. Without it they're free.
+	Default *Price `yaml:"default,omitempty"`
+
+	// Models holds prices by model. Names ending in * match every model with
+	// that prefix; an exact name wins over a prefix, and a longer prefix over
+	// a shorter one.
+	Models map[string]Price `yaml:"models"`
+}
+
+// LoadPricing reads the pricing file at path. A missing file prices every model at zero.
+func LoadPricing(path string) (*Pricing, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("Warning: %s not found, completions will not be costed", path)
+		return &Pricing{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pricing Pricing
+	if err := yaml.Unmarshal(data, &pricing); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for model, price := range pricing.Models {
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("%s: models.%s: prices must not be negative", path, model)
+		}
+	}
+	if pricing.Default != nil && (pricing.Default.Input < 0 || pricing.Default.Output < 0) {
+		return nil, fmt.Errorf("%s: default: prices must not be negative", path)
+	}
+	return &pricing, nil
+}
+
+// Price returns the price of model, and whether it has one
+func (p *Pricing) Price(model string) (Price, bool) {
+	if price, ok := p.Models[model]; ok {
+		return price, true
+	}
+
+	match := ""
+	var price Price
+	for pattern, candidate := range p.Models {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(model, prefix) && len(pattern) > len(match) {
+			match, price = pattern, candidate
+		}
+	}
+	if match != "" {
+		return price, true
+	}
+	if p.Default != nil {
+		return *p.Default, true
+	}
+	return Price{}, false
+}
+
+// Cost returns what usage of model costs, in USD. Models without a price are free.
+func (p *Pricing) Cost(model string, u types.Usage) float64 {
+	price, _ := p.Price(model)
+	return price.Cost(u)
+}
+
+// SetCost records the cost of the completion served for this request, for metrics
+func SetCost(c echo.Context, cost float64) {
+	c.Set(CostContextKey, cost)
+}
+
+// CostFromContext returns the cost recorded for this request, if any
+func CostFromContext(c echo.Context) (float64, bool) {
+	cost, ok := c.Get(CostContextKey).(float64)
+	return cost, ok
+}
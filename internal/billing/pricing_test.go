@@ -0,0 +1,77 @@
+package billing_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"go-api/internal/billing"
+	"go-api/internal/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pricing", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "pricing.yaml")
+	})
+
+	write := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+	}
+
+	It("costs usage at the model's price per million tokens", func() {
+		write(`
+models:
+  llama-3.3-70b-versatile:
+    input: 0.59
+    output: 0.79
+`)
+		pricing, err := billing.LoadPricing(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		cost := pricing.Cost("llama-3.3-70b-versatile", types.Usage{PromptTokens: 1_000_000, CompletionTokens: 500_000, TotalTokens: 1_500_000})
+		Expect(cost).To(BeNumerically("~", 0.59+0.395, 1e-9))
+	})
+
+	It("matches models exactly, by the longest prefix, or by the default", func() {
+		pricing := &billing.Pricing{
+			Default: &billing.Price{Input: 9, Output: 9},
+			Models: map[string]billing.Price{
+				"llama*":                  {Input: 1, Output: 1},
+				"llama-3.3*":              {Input: 2, Output: 2},
+				"llama-3.3-70b-versatile": {Input: 3, Output: 3},
+			},
+		}
+
+		price, ok := pricing.Price("llama-3.3-70b-versatile")
+		Expect(ok).To(BeTrue())
+		Expect(price.Input).To(Equal(3.0))
+
+		price, _ = pricing.Price("llama-3.3-8b")
+		Expect(price.Input).To(Equal(2.0))
+
+		price, _ = pricing.Price("llama3-8b-8192")
+		Expect(price.Input).To(Equal(1.0))
+
+		price, _ = pricing.Price("gemma2-9b-it")
+		Expect(price.Input).To(Equal(9.0))
+	})
+
+	It("prices unlisted models at zero without a default", func() {
+		pricing, err := billing.LoadPricing(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, ok := pricing.Price("llama-3.3-70b-versatile")
+		Expect(ok).To(BeFalse())
+		Expect(pricing.Cost("llama-3.3-70b-versatile", types.Usage{PromptTokens: 1000})).To(BeZero())
+	})
+
+	It("rejects negative prices", func() {
+		write("models:\n  gemma*:\n    input: -1\n")
+		_, err := billing.LoadPricing(path)
+		Expect(err).To(MatchError(ContainSubstring("models.gemma*")))
+	})
+})
@@ -0,0 +1,113 @@
+package identity
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ContextKey is the echo context key holding the *Identity of the authenticated caller
+const ContextKey = "identity"
+
+// Features a credential can be limited to
+const (
+	// FeatureStreaming allows streamed chat completions
+	FeatureStreaming = "streaming"
+
+	// FeatureTools allows requests that offer the model tools to call
+	FeatureTools = "tools"
+)
+
+// Features lists every feature a credential can be limited to
+var Features = []string{FeatureStreaming, FeatureTools}
+
+// Identity is who a request was authenticated as, and what they're entitled to
+type Identity struct {
+	// KeyID identifies the credential without revealing it
+	KeyID string
+
+	// Owner is the person or service the credential was issued to
+	Owner string
+
+	// Team is the team the owner belongs to
+	Team string
+
+	// Label describes what the credential is used for
+	Label string
+
+	// Groups are the groups the caller belongs to, for callers authenticated with a JWT
+	Groups []string
+
+	// AllowedModels lists the models the caller may use. Empty allows every model.
+	AllowedModels []string
+
+	// MaxTokens caps the tokens a single request may generate. Zero means no cap.
+	MaxTokens int
+
+	// AllowedFeatures lists the features the caller may use. Empty allows every feature.
+	AllowedFeatures []string
+
+	// RateLimitTier names the rate limits that apply to the caller
+	RateLimitTier string
+
+	// RequestsPerSecond and Burst override the request rate limits of the
+	// caller's tier. Zero uses the limits of the tier.
+	RequestsPerSecond float64
+	Burst             int
+
+	// TokensPerMinute and TokensPerDay override the default token budgets of
+	// the caller. Zero uses the default.
+	TokensPerMinute int64
+	TokensPerDay    int64
+
+	// MaxConcurrent overrides how many requests the caller may have in flight
+	// at once. Zero uses the limit of its tier.
+	MaxConcurrent int
+
+	// MonthlyBudget is how much the caller may spend in a calendar month, in
+	// USD, and SoftBudget how much before it is warned. Zero means no budget.
+	MonthlyBudget float64
+	SoftBudget    float64
+
+	// AuditOptOut keeps the caller's requests out of the audit log
+	AuditOptOut bool
+
+	// ExpiresAt is when the credential stops working. Zero means never.
+	ExpiresAt time.Time
+}
+
+// Set records the authenticated identity for this request
+func Set(c echo.Context, id *Identity) {
+	c.Set(ContextKey, id)
+}
+
+// FromContext returns the identity the request was authenticated as, if any
+func FromContext(c echo.Context) (*Identity, bool) {
+	id, ok := c.Get(ContextKey).(*Identity)
+	return id, ok && id != nil
+}
+
+// AllowsModel reports whether the caller may use model. An entry ending in *
+// allows every model starting with the rest of it.
+func (id *Identity) AllowsModel(model string) bool {
+	if len(id.AllowedModels) == 0 {
+		return true
+	}
+	for _, allowed := range id.AllowedModels {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(model, prefix) {
+				return true
+			}
+		} else if model == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsFeature reports whether the caller may use feature
+func (id *Identity) AllowsFeature(feature string) bool {
+	return len(id.AllowedFeatures) == 0 || slices.Contains(id.AllowedFeatures, feature)
+}
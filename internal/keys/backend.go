@@ -0,0 +1,135 @@
+package keys
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Backend kinds accepted by OpenBackend
+const (
+	BackendFile = "file"
+	BackendBolt = "bolt"
+)
+
+// Backend persists API keys. Implementations must be safe for concurrent use.
+type Backend interface {
+	// Load returns every stored key
+	Load() ([]Key, error)
+
+	// Save stores key, replacing any stored key with the same ID
+	Save(key Key) error
+
+	// Delete removes the key with the given ID, or returns ErrKeyNotFound
+	Delete(id string) error
+
+	// Close releases the backend's resources
+	Close() error
+}
+
+// ChangeDetector is implemented by backends that can be edited outside the
+// server, such as a key file, so the store knows when to reload them
+type ChangeDetector interface {
+	// Changed reports whether the stored keys may differ from the last Load
+	Changed() bool
+}
+
+// OpenBackend opens the backend of the given kind, stored at path
+func OpenBackend(kind, path string) (Backend, error) {
+	switch kind {
+	case BackendFile, "":
+		return NewFileBackend(path), nil
+	case BackendBolt:
+		return OpenBoltBackend(path)
+	default:
+		return nil, fmt.Errorf("unsupported key store backend %q, expected %s or %s", kind, BackendFile, BackendBolt)
+	}
+}
+
+// MemoryBackend keeps keys in memory only. It is meant for tests.
+type MemoryBackend struct {
+	mu   sync.Mutex
+	keys []Key
+}
+
+// NewMemoryBackend creates a memory backend holding keys
+func NewMemoryBackend(keys ...Key) *MemoryBackend {
+	b := &MemoryBackend{keys: append([]Key(nil), keys...)}
+	for i := range b.keys {
+		// Give keys without an ID their derived one, so they can be found by it.
+		// Invalid keys are reported when the store loads them.
+		b.keys[i].validate()
+	}
+	return b
+}
+
+func (b *MemoryBackend) Load() ([]Key, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Key(nil), b.keys...), nil
+}
+
+func (b *MemoryBackend) Save(key Key) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range b.keys {
+		if b.keys[i].ID == key.ID {
+			b.keys[i] = key
+			return nil
+		}
+	}
+	b.keys = append(b.keys, key)
+	return nil
+}
+
+func (b *MemoryBackend) Delete(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range b.keys {
+		if b.keys[i].ID == id {
+			b.keys = append(b.keys[:i], b.keys[i+1:]...)
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+func (b *MemoryBackend) Close() error {
+	return nil
+}
+
+// Import copies the keys in src that dst doesn't hold yet, by ID, into dst and
+// returns how many it copied. The keys of src are validated first, so a
+// broken key file imports nothing.
+func Import(dst, src Backend) (int, error) {
+	incoming, err := src.Load()
+	if err != nil {
+		return 0, err
+	}
+	idx, err := index(incoming)
+	if err != nil {
+		return 0, err
+	}
+
+	existing, err := dst.Load()
+	if err != nil {
+		return 0, err
+	}
+	held := make(map[string]bool, len(existing))
+	for _, key := range existing {
+		held[key.ID] = true
+	}
+
+	imported := 0
+	for _, key := range idx.ordered {
+		if held[key.ID] {
+			continue
+		}
+		if err := dst.Save(*key); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, nil
+}
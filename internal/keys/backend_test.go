@@ -0,0 +1,179 @@
+package keys_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-api/internal/keys"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// storeBackends describes the backends every store spec runs against. open is
+// called again with the same directory to check that changes persist.
+var storeBackends = []struct {
+	name       string
+	persistent bool
+	open       func(dir string) keys.Backend
+}{
+	{"memory", false, func(string) keys.Backend { return keys.NewMemoryBackend() }},
+	{"file", true, func(dir string) keys.Backend {
+		return keys.NewFileBackend(filepath.Join(dir, "api-keys.yaml"))
+	}},
+	{"bolt", true, func(dir string) keys.Backend {
+		backend, err := keys.OpenBoltBackend(filepath.Join(dir, "api-keys.db"))
+		Expect(err).NotTo(HaveOccurred())
+		return backend
+	}},
+}
+
+var _ = Describe("Store administration", func() {
+	for _, backend := range storeBackends {
+		Context("with the "+backend.name+" backend", func() {
+			var (
+				dir   string
+				store *keys.Store
+			)
+
+			BeforeEach(func() {
+				dir = GinkgoT().TempDir()
+				var err error
+				store, err = keys.NewStoreWithBackend(backend.open(dir))
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(func() { store.Close() })
+			})
+
+			// reopen closes the store and loads it again from the same place
+			reopen := func() *keys.Store {
+				Expect(store.Close()).To(Succeed())
+				reopened, err := keys.NewStoreWithBackend(backend.open(dir))
+				Expect(err).NotTo(HaveOccurred())
+				store = reopened
+				return reopened
+			}
+
+			It("creates keys that work immediately", func() {
+				key, secret, err := store.Create(keys.Key{Owner: "erin", Quota: keys.Quota{RequestsPerSecond: 2}})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(key.ID).To(HavePrefix("key_"))
+				Expect(key.Hashed()).To(BeTrue())
+				Expect(secret).To(HavePrefix(keys.KeyPrefix))
+
+				found, err := store.Lookup(secret)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(found.ID).To(Equal(key.ID))
+				Expect(found.Owner).To(Equal("erin"))
+
+				listed := store.List()
+				Expect(listed).To(HaveLen(1))
+				Expect(listed[0].Quota.RequestsPerSecond).To(Equal(2.0))
+			})
+
+			It("rotates, updates and deletes keys by ID", func() {
+				key, oldSecret, err := store.Create(keys.Key{Label: "ci"})
+				Expect(err).NotTo(HaveOccurred())
+
+				rotated, newSecret, err := store.Rotate(key.ID)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(rotated.ID).To(Equal(key.ID))
+				Expect(rotated.Label).To(Equal("ci"))
+				_, err = store.Lookup(oldSecret)
+				Expect(err).To(MatchError(keys.ErrUnknownKey))
+				_, err = store.Lookup(newSecret)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = store.Update(key.ID, func(k *keys.Key) error {
+					k.Disabled = true
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = store.Lookup(newSecret)
+				Expect(err).To(MatchError(keys.ErrKeyDisabled))
+
+				Expect(store.Delete(key.ID)).To(Succeed())
+				Expect(store.Len()).To(BeZero())
+				Expect(store.Delete(key.ID)).To(MatchError(keys.ErrKeyNotFound))
+				_, _, err = store.Rotate(key.ID)
+				Expect(err).To(MatchError(keys.ErrKeyNotFound))
+			})
+
+			if backend.persistent {
+				It("keeps changes across restarts", func() {
+					kept, secret, err := store.Create(keys.Key{Owner: "frank", ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Second)})
+					Expect(err).NotTo(HaveOccurred())
+					removed, _, err := store.Create(keys.Key{Owner: "grace"})
+					Expect(err).NotTo(HaveOccurred())
+					_, err = store.Update(kept.ID, func(k *keys.Key) error {
+						k.Quota = keys.Quota{RequestsPerSecond: 1, Burst: 3}
+						return nil
+					})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(store.Delete(removed.ID)).To(Succeed())
+
+					reopened := reopen()
+					Expect(reopened.Len()).To(Equal(1))
+					found, err := reopened.Lookup(secret)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(found.ID).To(Equal(kept.ID))
+					Expect(found.ExpiresAt).To(BeTemporally("==", kept.ExpiresAt))
+					Expect(found.Quota).To(Equal(keys.Quota{RequestsPerSecond: 1, Burst: 3}))
+				})
+			}
+		})
+	}
+
+	It("edits the key file in place, keeping entries added by hand", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "api-keys.yaml")
+		Expect(os.WriteFile(path, []byte("# managed keys\napi_keys:\n  # legacy client\n  - \"scarlett-legacy-000001\"\n"), 0o600)).To(Succeed())
+
+		store, err := keys.NewStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		legacy := store.List()[0]
+
+		_, err = store.Update(legacy.ID, func(k *keys.Key) error {
+			k.Owner = "heidi"
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = store.Create(keys.Key{Owner: "ivan"})
+		Expect(err).NotTo(HaveOccurred())
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(HavePrefix("# managed keys"))
+		Expect(string(data)).To(ContainSubstring("# legacy client"))
+
+		reloaded, err := keys.NewStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded.Len()).To(Equal(2))
+		key, err := reloaded.Lookup("scarlett-legacy-000001")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.ID).To(Equal(legacy.ID))
+		Expect(key.Owner).To(Equal("heidi"))
+	})
+
+	It("imports the keys of a key file into an empty database once", func() {
+		dir := GinkgoT().TempDir()
+		path := filepath.Join(dir, "api-keys.yaml")
+		Expect(os.WriteFile(path, []byte("api_keys:\n  - \"scarlett-legacy-000001\"\n  - key: \"scarlett-legacy-000002\"\n    owner: judy\n"), 0o600)).To(Succeed())
+		db, err := keys.OpenBoltBackend(filepath.Join(dir, "api-keys.db"))
+		Expect(err).NotTo(HaveOccurred())
+		defer db.Close()
+
+		Expect(keys.Import(db, keys.NewFileBackend(path))).To(Equal(2))
+		Expect(keys.Import(db, keys.NewFileBackend(path))).To(BeZero(), "keys already held are skipped")
+
+		store, err := keys.NewStoreWithBackend(db)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Len()).To(Equal(2))
+		key, err := store.Lookup("scarlett-legacy-000002")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.Owner).To(Equal("judy"))
+
+		Expect(os.WriteFile(path, []byte("api_keys:\n  - \"scarlett-legacy-000001\"\n  - \"scarlett-legacy-000001\"\n"), 0o600)).To(Succeed())
+		_, err = keys.Import(db, keys.NewFileBackend(path))
+		Expect(err).To(MatchError(ContainSubstring("more than once")))
+	})
+})
@@ -0,0 +1,79 @@
+package keys
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/yaml.v3"
+)
+
+// boltBucket is the bucket keys are stored in, by ID
+var boltBucket = []byte("api_keys")
+
+// BoltBackend stores keys in an embedded BoltDB database. Each key is stored
+// under its ID in the same YAML layout as an entry of the key file.
+type BoltBackend struct {
+	db *bolt.DB
+}
+
+// OpenBoltBackend opens the database at path, creating it if it doesn't exist
+func OpenBoltBackend(path string) (*BoltBackend, error) {
+	// Fail rather than hang if another process holds the database
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltBackend{db: db}, nil
+}
+
+func (b *BoltBackend) Load() ([]Key, error) {
+	var keys []Key
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(id, data []byte) error {
+			var key Key
+			if err := yaml.Unmarshal(data, &key); err != nil {
+				return fmt.Errorf("key %s: %w", id, err)
+			}
+			keys = append(keys, key)
+			return nil
+		})
+	})
+	return keys, err
+}
+
+func (b *BoltBackend) Save(key Key) error {
+	if key.ID == "" {
+		return fmt.Errorf("key has no id")
+	}
+	data, err := yaml.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key.ID), data)
+	})
+}
+
+func (b *BoltBackend) Delete(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrKeyNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+func (b *BoltBackend) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,287 @@
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileBackend stores keys in a YAML key file. Edits made through the backend
+// leave the rest of the file, comments included, as it was, and the file can
+// also be edited by hand while the server runs.
+type FileBackend struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewFileBackend creates a backend for the key file at path. A missing file is
+// treated as empty and created on the first save.
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{path: path}
+}
+
+// Path returns the path of the key file
+func (b *FileBackend) Path() string {
+	return b.path
+}
+
+func (b *FileBackend) Load() ([]Key, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, err := os.Stat(b.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remember this version of the file even if it is broken, so it is
+	// only reported once rather than on every check
+	b.modTime = info.ModTime()
+	b.size = info.Size()
+
+	keys, err := parseFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", b.path, err)
+	}
+	return keys, nil
+}
+
+// Changed reports whether the file looks different from when it was last loaded or written
+func (b *FileBackend) Changed() bool {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !info.ModTime().Equal(b.modTime) || info.Size() != b.size
+}
+
+func (b *FileBackend) Save(key Key) error {
+	return b.edit(func(keys *yaml.Node) error {
+		var entry yaml.Node
+		if err := entry.Encode(key); err != nil {
+			return err
+		}
+
+		i, err := findEntry(keys, key.ID)
+		if err != nil {
+			return err
+		}
+		if i < 0 {
+			keys.Content = append(keys.Content, &entry)
+			return nil
+		}
+		entry.HeadComment = keys.Content[i].HeadComment
+		keys.Content[i] = &entry
+		return nil
+	})
+}
+
+func (b *FileBackend) Delete(id string) error {
+	return b.edit(func(keys *yaml.Node) error {
+		i, err := findEntry(keys, id)
+		if err != nil {
+			return err
+		}
+		if i < 0 {
+			return ErrKeyNotFound
+		}
+		keys.Content = append(keys.Content[:i], keys.Content[i+1:]...)
+		return nil
+	})
+}
+
+func (b *FileBackend) Close() error {
+	return nil
+}
+
+// edit applies fn to the api_keys list of the file and writes the result back
+func (b *FileBackend) edit(fn func(keys *yaml.Node) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	doc, err := readDocument(b.path)
+	if err != nil {
+		return err
+	}
+	keys, err := keyList(doc)
+	if err != nil {
+		return fmt.Errorf("%s: %w", b.path, err)
+	}
+
+	if err := fn(keys); err != nil {
+		return err
+	}
+	keys.Style = 0
+
+	if err := writeDocument(b.path, doc); err != nil {
+		return err
+	}
+
+	// Our own write doesn't need reloading from disk
+	if info, err := os.Stat(b.path); err == nil {
+		b.modTime = info.ModTime()
+		b.size = info.Size()
+	}
+	return nil
+}
+
+// findEntry returns the index of the entry with the given ID in the api_keys list, or -1
+func findEntry(keys *yaml.Node, id string) (int, error) {
+	for i, node := range keys.Content {
+		var key Key
+		if err := node.Decode(&key); err != nil {
+			return 0, fmt.Errorf("api_keys[%d]: %w", i, err)
+		}
+		// Entries without an ID are matched by the ID derived when they were loaded
+		if err := key.validate(); err != nil {
+			continue
+		}
+		if key.ID == id {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// HashFile replaces every plain text key in the key file at path with its
+// prefix and salted hash, and returns how many keys it hashed
+func HashFile(path string) (int, error) {
+	doc, err := readDocument(path)
+	if err != nil {
+		return 0, err
+	}
+
+	keys, err := keyList(doc)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	hashed := 0
+	for i, node := range keys.Content {
+		var key Key
+		if err := node.Decode(&key); err != nil {
+			return 0, fmt.Errorf("%s: api_keys[%d]: %w", path, i, err)
+		}
+		if key.Hashed() || key.Key == "" {
+			continue
+		}
+		// Persist the ID derived from the plain text key, so it stays the same once hashed
+		if err := key.validate(); err != nil {
+			return 0, fmt.Errorf("%s: api_keys[%d] %w", path, i, err)
+		}
+
+		hashedKey, err := NewHashedKey(key.Key)
+		if err != nil {
+			return 0, err
+		}
+		key.Key = ""
+		key.Prefix = hashedKey.Prefix
+		key.Salt = hashedKey.Salt
+		key.Hash = hashedKey.Hash
+
+		var entry yaml.Node
+		if err := entry.Encode(key); err != nil {
+			return 0, err
+		}
+		// A hashed entry spans several lines, so comments move above it
+		entry.HeadComment = strings.TrimSpace(node.HeadComment + "\n" + node.LineComment)
+		keys.Content[i] = &entry
+		hashed++
+	}
+
+	if hashed == 0 {
+		return 0, nil
+	}
+	keys.Style = 0
+	return hashed, writeDocument(path, doc)
+}
+
+// readDocument parses the key file at path, or returns an empty document if it doesn't exist
+func readDocument(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		data = []byte("api_keys: []\n")
+	} else if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		if err := yaml.Unmarshal([]byte("api_keys: []\n"), &doc); err != nil {
+			return nil, err
+		}
+	}
+	return &doc, nil
+}
+
+// keyList returns the api_keys sequence of a key file document
+func keyList(doc *yaml.Node) (*yaml.Node, error) {
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a mapping at the top level")
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "api_keys" {
+			list := root.Content[i+1]
+			// api_keys with no entries parses as null
+			if list.Kind == yaml.ScalarNode && list.Tag == "!!null" {
+				*list = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			}
+			if list.Kind != yaml.SequenceNode {
+				return nil, fmt.Errorf("api_keys is not a list")
+			}
+			return list, nil
+		}
+	}
+
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "api_keys"}, list)
+	return list, nil
+}
+
+// writeDocument encodes doc and replaces the file at path with it in one step,
+// so the key store never reloads a half-written file
+func writeDocument(path string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0o600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,160 @@
+package keys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"go-api/internal/identity"
+)
+
+const (
+	// KeyPrefix starts every generated key
+	KeyPrefix = "scarlett-"
+
+	// PrefixLength is how many leading characters of a key are stored in
+	// clear to find its entry. It covers KeyPrefix and 8 random characters.
+	PrefixLength = len(KeyPrefix) + 8
+
+	// secretLength is the number of random characters in a generated key
+	secretLength = 40
+
+	// saltLength is the number of random bytes hashed with each key
+	saltLength = 16
+
+	// keyAlphabet is the character set of generated keys
+	keyAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// Generate returns a new random key
+func Generate() (string, error) {
+	secret := make([]byte, secretLength)
+	max := big.NewInt(int64(len(keyAlphabet)))
+	for i := range secret {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		secret[i] = keyAlphabet[n.Int64()]
+	}
+	return KeyPrefix + string(secret), nil
+}
+
+// PrefixOf returns the part of key stored in clear for lookup. Short keys
+// from older key files only reveal their first half.
+func PrefixOf(key string) string {
+	return key[:min(PrefixLength, len(key)/2)]
+}
+
+// Hash returns the hex SHA-256 of salt followed by key
+func Hash(salt []byte, key string) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(key))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewHashedKey returns a Key that stores only the prefix and salted hash of secret
+func NewHashedKey(secret string) (Key, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return Key{}, err
+	}
+
+	id, err := NewID()
+	if err != nil {
+		return Key{}, err
+	}
+
+	return Key{
+		ID:        id,
+		Prefix:    PrefixOf(secret),
+		Salt:      hex.EncodeToString(salt),
+		Hash:      Hash(salt, secret),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}, nil
+}
+
+// Hashed reports whether the key is stored as a salted hash rather than in plain text
+func (k *Key) Hashed() bool {
+	return k.Hash != ""
+}
+
+// Matches reports, in constant time, whether secret is this key
+func (k *Key) Matches(secret string) bool {
+	if !k.Hashed() {
+		return subtle.ConstantTimeCompare([]byte(k.Key), []byte(secret)) == 1
+	}
+
+	salt, err := hex.DecodeString(k.Salt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(Hash(salt, secret)), []byte(k.Hash)) == 1
+}
+
+// validate checks that the key has either a plain text secret or a complete hash
+func (k *Key) validate() error {
+	switch {
+	case k.Hashed():
+		if k.Prefix == "" || k.Salt == "" {
+			return fmt.Errorf("is hashed but has no prefix or salt")
+		}
+		if _, err := hex.DecodeString(k.Salt); err != nil {
+			return fmt.Errorf("has a salt that is not hex: %w", err)
+		}
+	case k.Key == "":
+		return fmt.Errorf("has neither a key nor a hash")
+	default:
+		k.Prefix = PrefixOf(k.Key)
+	}
+
+	if k.MaxTokens < 0 {
+		return fmt.Errorf("has a negative max_tokens")
+	}
+	for _, feature := range k.AllowedFeatures {
+		if !slices.Contains(identity.Features, feature) {
+			return fmt.Errorf("has unknown feature %q, expected one of %s", feature, strings.Join(identity.Features, ", "))
+		}
+	}
+
+	if k.ID == "" {
+		// Derived from the stored secret, which is unique, without revealing it
+		sum := sha256.Sum256([]byte(k.Key + k.Hash))
+		k.ID = "key_" + hex.EncodeToString(sum[:6])
+	}
+	return nil
+}
+
+// NewID returns a random key ID
+func NewID() (string, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return "key_" + hex.EncodeToString(id), nil
+}
+
+// Rotate gives the key a new secret, keeping its ID and metadata, and returns the secret
+func (k *Key) Rotate() (string, error) {
+	secret, err := Generate()
+	if err != nil {
+		return "", err
+	}
+	hashed, err := NewHashedKey(secret)
+	if err != nil {
+		return "", err
+	}
+
+	k.Key = ""
+	k.Prefix = hashed.Prefix
+	k.Salt = hashed.Salt
+	k.Hash = hashed.Hash
+	return secret, nil
+}
@@ -0,0 +1,127 @@
+package keys_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-api/internal/keys"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hashed keys", func() {
+	It("generates distinct keys with the scarlett prefix", func() {
+		first, err := keys.Generate()
+		Expect(err).NotTo(HaveOccurred())
+		second, err := keys.Generate()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(first).To(HavePrefix(keys.KeyPrefix))
+		Expect(first).To(HaveLen(len(keys.KeyPrefix) + 40))
+		Expect(first).NotTo(Equal(second))
+		Expect(keys.PrefixOf(first)).To(HaveLen(keys.PrefixLength))
+	})
+
+	It("stores only the prefix and a salted hash", func() {
+		secret, err := keys.Generate()
+		Expect(err).NotTo(HaveOccurred())
+
+		key, err := keys.NewHashedKey(secret)
+		Expect(err).NotTo(HaveOccurred())
+		again, err := keys.NewHashedKey(secret)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(key.Key).To(BeEmpty())
+		Expect(key.Hash).NotTo(ContainSubstring(secret))
+		Expect(key.Hash).NotTo(Equal(again.Hash), "salts should differ")
+		Expect(key.Matches(secret)).To(BeTrue())
+		Expect(key.Matches(secret + "x")).To(BeFalse())
+		Expect(key.Matches(keys.PrefixOf(secret))).To(BeFalse())
+	})
+
+	It("finds hashed keys by prefix even when prefixes collide", func() {
+		first, err := keys.NewHashedKey("scarlett-samepref-one-aaaaaaaaaaaaaaaaaaaa")
+		Expect(err).NotTo(HaveOccurred())
+		second, err := keys.NewHashedKey("scarlett-samepref-two-bbbbbbbbbbbbbbbbbbbb")
+		Expect(err).NotTo(HaveOccurred())
+		second.Owner = "bob"
+
+		store, err := keys.NewStoreFromKeys(first, second)
+		Expect(err).NotTo(HaveOccurred())
+
+		key, err := store.Lookup("scarlett-samepref-two-bbbbbbbbbbbbbbbbbbbb")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.Owner).To(Equal("bob"))
+
+		_, err = store.Lookup("scarlett-samepref-three-cccccccccccccccccc")
+		Expect(err).To(MatchError(keys.ErrUnknownKey))
+	})
+
+	It("rejects incomplete hashed entries", func() {
+		_, err := keys.NewStoreFromKeys(keys.Key{Hash: "abc"})
+		Expect(err).To(MatchError(ContainSubstring("no prefix or salt")))
+	})
+
+	Describe("key files", func() {
+		var path string
+
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "api-keys.yaml")
+		})
+
+		It("stores generated keys without the secret", func() {
+			secret, err := keys.Generate()
+			Expect(err).NotTo(HaveOccurred())
+			key, err := keys.NewHashedKey(secret)
+			Expect(err).NotTo(HaveOccurred())
+			key.Owner = "carol"
+
+			Expect(keys.NewFileBackend(path).Save(key)).To(Succeed())
+
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).NotTo(ContainSubstring(secret))
+
+			store, err := keys.NewStore(path)
+			Expect(err).NotTo(HaveOccurred())
+			found, err := store.Lookup(secret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found.Owner).To(Equal("carol"))
+		})
+
+		It("hashes plain text keys in place, keeping metadata and comments", func() {
+			Expect(os.WriteFile(path, []byte(strings.Join([]string{
+				"# production keys",
+				"api_keys:",
+				`  - "scarlett-plain-0001-aaaaaaaaaa"`,
+				`  - key: "scarlett-plain-0002-bbbbbbbbbb"`,
+				"    owner: dave",
+				"",
+			}, "\n")), 0o600)).To(Succeed())
+
+			n, err := keys.HashFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(Equal(2))
+
+			data, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).To(HavePrefix("# production keys"))
+			Expect(string(data)).NotTo(ContainSubstring("scarlett-plain-0001-aaaaaaaaaa"))
+
+			store, err := keys.NewStore(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.PlainTextKeys()).To(BeZero())
+			_, err = store.Lookup("scarlett-plain-0001-aaaaaaaaaa")
+			Expect(err).NotTo(HaveOccurred())
+			key, err := store.Lookup("scarlett-plain-0002-bbbbbbbbbb")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key.Owner).To(Equal("dave"))
+
+			n, err = keys.HashFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(n).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,211 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go-api/internal/identity"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrUnknownKey is returned for a key that isn't in the store
+	ErrUnknownKey = errors.New("unknown API key")
+
+	// ErrKeyDisabled is returned for a key that has been disabled
+	ErrKeyDisabled = errors.New("API key is disabled")
+
+	// ErrKeyExpired is returned for a key past its expiry time
+	ErrKeyExpired = errors.New("API key has expired")
+
+	// ErrKeyNotFound is returned by admin operations for an ID that isn't in the store
+	ErrKeyNotFound = errors.New("API key not found")
+)
+
+// Key is an API key and its metadata. Keys are normally stored as a
+// salted hash; plain text keys from older key files still work.
+type Key struct {
+	// ID identifies the key in the admin API. It survives rotation.
+	// Keys without one get an ID derived from their hash when loaded.
+	ID string `yaml:"id,omitempty"`
+
+	// Key is the secret clients send as a Bearer token, for keys stored in plain text
+	Key string `yaml:"key,omitempty"`
+
+	// Prefix is the start of the secret, kept in clear to find the key and to identify it in logs
+	Prefix string `yaml:"prefix,omitempty"`
+
+	// Salt is the hex random salt hashed with the secret
+	Salt string `yaml:"salt,omitempty"`
+
+	// Hash is the hex SHA-256 of the salt followed by the secret
+	Hash string `yaml:"hash,omitempty"`
+
+	// Owner is the person or service the key was issued to
+	Owner string `yaml:"owner,omitempty"`
+
+	// Team is the team the owner belongs to
+	Team string `yaml:"team,omitempty"`
+
+	// Label describes what the key is used for
+	Label string `yaml:"label,omitempty"`
+
+	// CreatedAt is when the key was issued
+	CreatedAt time.Time `yaml:"created_at,omitempty"`
+
+	// ExpiresAt is when the key stops working. Zero means never.
+	ExpiresAt time.Time `yaml:"expires_at,omitempty"`
+
+	// Disabled keys are rejected without being removed
+	Disabled bool `yaml:"disabled,omitempty"`
+
+	// AllowedModels lists the models the key may use. Empty allows every model.
+	// An entry ending in * allows every model starting with the rest of it.
+	AllowedModels []string `yaml:"allowed_models,omitempty"`
+
+	// MaxTokens caps max_tokens for each request made with the key. Zero means no cap.
+	MaxTokens int `yaml:"max_tokens,omitempty"`
+
+	// AllowedFeatures lists the features, such as streaming and tools, the key
+	// may use. Empty allows every feature.
+	AllowedFeatures []string `yaml:"allowed_features,omitempty"`
+
+	// RateLimitTier names the rate limits that apply to the key
+	RateLimitTier string `yaml:"rate_limit_tier,omitempty"`
+
+	// Quota overrides the limits of the key's rate limit tier
+	Quota Quota `yaml:"quota,omitempty"`
+
+	// AuditOptOut keeps the key's requests out of the audit log
+	AuditOptOut bool `yaml:"audit_opt_out,omitempty"`
+}
+
+// Quota holds per-key limits. Zero fields fall back to the key's tier.
+type Quota struct {
+	// RequestsPerSecond is the sustained request rate
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty" json:"requests_per_second,omitempty"`
+
+	// Burst is how many requests may be made at once
+	Burst int `yaml:"burst,omitempty" json:"burst,omitempty"`
+
+	// TokensPerMinute is how many prompt and completion tokens may be used in any minute
+	TokensPerMinute int64 `yaml:"tokens_per_minute,omitempty" json:"tokens_per_minute,omitempty"`
+
+	// TokensPerDay is how many prompt and completion tokens may be used in any day
+	TokensPerDay int64 `yaml:"tokens_per_day,omitempty" json:"tokens_per_day,omitempty"`
+
+	// MaxConcurrentRequests is how many requests may be in flight at once
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests,omitempty" json:"max_concurrent_requests,omitempty"`
+
+	// MonthlyBudgetUSD is how much the key may spend in a calendar month.
+	// Requests that would go over it are rejected.
+	MonthlyBudgetUSD float64 `yaml:"monthly_budget_usd,omitempty" json:"monthly_budget_usd,omitempty"`
+
+	// MonthlySoftBudgetUSD is how much the key may spend in a calendar month
+	// before requests carry a warning
+	MonthlySoftBudgetUSD float64 `yaml:"monthly_soft_budget_usd,omitempty" json:"monthly_soft_budget_usd,omitempty"`
+}
+
+// IsZero reports whether no quota is set
+func (q Quota) IsZero() bool {
+	return q == Quota{}
+}
+
+// UnmarshalYAML accepts a bare key string, as older key files list them,
+// as well as a mapping with metadata
+func (k *Key) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*k = Key{}
+		return node.Decode(&k.Key)
+	}
+
+	type plain Key
+	return node.Decode((*plain)(k))
+}
+
+// Check returns an error if the key can't be used at now
+func (k *Key) Check(now time.Time) error {
+	if k.Disabled {
+		return ErrKeyDisabled
+	}
+	if !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt) {
+		return ErrKeyExpired
+	}
+	return nil
+}
+
+// Identity returns the identity requests authenticated with the key act as
+func (k *Key) Identity() *identity.Identity {
+	return &identity.Identity{
+		KeyID:             k.ID,
+		Owner:             k.Owner,
+		Team:              k.Team,
+		Label:             k.Label,
+		AllowedModels:     k.AllowedModels,
+		MaxTokens:         k.MaxTokens,
+		AllowedFeatures:   k.AllowedFeatures,
+		RateLimitTier:     k.RateLimitTier,
+		RequestsPerSecond: k.Quota.RequestsPerSecond,
+		Burst:             k.Quota.Burst,
+		TokensPerMinute:   k.Quota.TokensPerMinute,
+		TokensPerDay:      k.Quota.TokensPerDay,
+		MaxConcurrent:     k.Quota.MaxConcurrentRequests,
+		MonthlyBudget:     k.Quota.MonthlyBudgetUSD,
+		SoftBudget:        k.Quota.MonthlySoftBudgetUSD,
+		AuditOptOut:       k.AuditOptOut,
+		ExpiresAt:         k.ExpiresAt,
+	}
+}
+
+// File is the layout of the key file
+type File struct {
+	Keys []Key `yaml:"api_keys"`
+}
+
+// parseFile decodes a key file
+func parseFile(data []byte) ([]Key, error) {
+	var file File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	return file.Keys, nil
+}
+
+// keyIndex holds a set of keys, by prefix for authentication and by ID for administration
+type keyIndex struct {
+	byPrefix map[string][]*Key
+	byID     map[string]*Key
+	ordered  []*Key
+}
+
+// index validates keys and indexes them, rejecting keys or IDs listed twice
+func index(keys []Key) (*keyIndex, error) {
+	idx := &keyIndex{
+		byPrefix: make(map[string][]*Key, len(keys)),
+		byID:     make(map[string]*Key, len(keys)),
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for i := range keys {
+		key := keys[i]
+		if err := key.validate(); err != nil {
+			return nil, fmt.Errorf("api_keys[%d] %w", i, err)
+		}
+
+		secret := key.Key + key.Hash
+		if seen[secret] {
+			return nil, fmt.Errorf("api_keys[%d] (%s) is listed more than once", i, key.Prefix)
+		}
+		seen[secret] = true
+		if _, ok := idx.byID[key.ID]; ok {
+			return nil, fmt.Errorf("api_keys[%d] reuses id %s", i, key.ID)
+		}
+
+		idx.byPrefix[key.Prefix] = append(idx.byPrefix[key.Prefix], &key)
+		idx.byID[key.ID] = &key
+		idx.ordered = append(idx.ordered, &key)
+	}
+	return idx, nil
+}
@@ -0,0 +1,182 @@
+package keys_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"go-api/internal/keys"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		path    string
+		modTime time.Time
+	)
+
+	// writeKeys replaces the key file, moving its modification time forward so
+	// the change is noticed even on filesystems with coarse timestamps
+	writeKeys := func(content string) {
+		modTime = modTime.Add(time.Second)
+		ExpectWithOffset(1, os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		ExpectWithOffset(1, os.Chtimes(path, modTime, modTime)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "api-keys.yaml")
+		modTime = time.Now()
+	})
+
+	It("loads bare keys and keys with metadata", func() {
+		writeKeys(`
+api_keys:
+  - "scarlett-plain-key-0001"
+  - key: "scarlett-team-key-0002"
+    owner: alice
+    team: search
+    label: staging
+    created_at: 2025-01-01T00:00:00Z
+    allowed_models: [llama-3.3-70b]
+    rate_limit_tier: free
+`)
+		store, err := keys.NewStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Len()).To(Equal(2))
+
+		_, err = store.Lookup("scarlett-plain-key-0001")
+		Expect(err).NotTo(HaveOccurred())
+
+		key, err := store.Lookup("scarlett-team-key-0002")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.CreatedAt).To(Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+		id := key.Identity()
+		Expect(id.KeyID).To(Equal(key.ID))
+		Expect(id.KeyID).To(HavePrefix("key_"))
+		Expect(id.Owner).To(Equal("alice"))
+		Expect(id.Team).To(Equal("search"))
+		Expect(id.Label).To(Equal("staging"))
+		Expect(id.AllowedModels).To(Equal([]string{"llama-3.3-70b"}))
+		Expect(id.RateLimitTier).To(Equal("free"))
+	})
+
+	It("loads access policies and rejects unknown features", func() {
+		writeKeys(`
+api_keys:
+  - key: "scarlett-intern-key-0003"
+    allowed_models: ["llama-3.1-8b-instant"]
+    max_tokens: 512
+    allowed_features: [streaming]
+`)
+		store, err := keys.NewStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		key, err := store.Lookup("scarlett-intern-key-0003")
+		Expect(err).NotTo(HaveOccurred())
+
+		id := key.Identity()
+		Expect(id.MaxTokens).To(Equal(512))
+		Expect(id.AllowedFeatures).To(Equal([]string{"streaming"}))
+		Expect(id.AllowsModel("llama-3.1-8b-instant")).To(BeTrue())
+		Expect(id.AllowsModel("llama-3.3-70b-versatile")).To(BeFalse())
+		Expect(id.AllowsFeature("tools")).To(BeFalse())
+
+		writeKeys(`api_keys: [{key: "scarlett-intern-key-0003", allowed_features: [telepathy]}]`)
+		_, err = keys.NewStore(path)
+		Expect(err).To(MatchError(ContainSubstring(`unknown feature "telepathy"`)))
+	})
+
+	It("rejects unknown, disabled and expired keys", func() {
+		store, err := keys.NewStoreFromKeys(
+			keys.Key{Key: "disabled-key-0001", Disabled: true},
+			keys.Key{Key: "expired-key-00002", ExpiresAt: time.Now().Add(-time.Minute)},
+			keys.Key{Key: "current-key-00003", ExpiresAt: time.Now().Add(time.Hour)},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = store.Lookup("nope")
+		Expect(err).To(MatchError(keys.ErrUnknownKey))
+		_, err = store.Lookup("disabled-key-0001")
+		Expect(err).To(MatchError(keys.ErrKeyDisabled))
+		_, err = store.Lookup("expired-key-00002")
+		Expect(err).To(MatchError(keys.ErrKeyExpired))
+		_, err = store.Lookup("current-key-00003")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("starts empty without a key file and refuses a malformed one", func() {
+		store, err := keys.NewStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Len()).To(BeZero())
+
+		writeKeys("api_keys: [{key: ")
+		_, err = keys.NewStore(path)
+		Expect(err).To(HaveOccurred())
+
+		writeKeys("api_keys: [dup-key-000001, dup-key-000001]")
+		_, err = keys.NewStore(path)
+		Expect(err).To(MatchError(ContainSubstring("more than once")))
+	})
+
+	Context("when watching the key file", func() {
+		var (
+			store *keys.Store
+			stop  func()
+		)
+
+		BeforeEach(func() {
+			writeKeys("api_keys: [first-key-000001]")
+			var err error
+			store, err = keys.NewStore(path)
+			Expect(err).NotTo(HaveOccurred())
+			stop = store.Watch(10 * time.Millisecond)
+			DeferCleanup(func() { stop() })
+		})
+
+		It("picks up changes without a restart", func() {
+			writeKeys("api_keys: [second-key-00002]")
+
+			Eventually(func() error {
+				_, err := store.Lookup("second-key-00002")
+				return err
+			}).Should(Succeed())
+			_, err := store.Lookup("first-key-000001")
+			Expect(err).To(MatchError(keys.ErrUnknownKey))
+		})
+
+		It("keeps the previous keys if the new file is broken", func() {
+			writeKeys("api_keys: [{key: ")
+
+			Consistently(func() error {
+				_, err := store.Lookup("first-key-000001")
+				return err
+			}, 100*time.Millisecond).Should(Succeed())
+		})
+
+		It("reloads on SIGHUP", func() {
+			stop()
+			stop = store.Watch(time.Hour)
+
+			// Rewrite the file without changing its size or time, so only the signal can notice
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(path, []byte("api_keys: [third-key-000003]"), 0o600)).To(Succeed())
+			Expect(os.Chtimes(path, info.ModTime(), info.ModTime())).To(Succeed())
+
+			Expect(syscall.Kill(os.Getpid(), syscall.SIGHUP)).To(Succeed())
+			Eventually(func() error {
+				_, err := store.Lookup("third-key-000003")
+				return err
+			}).Should(Succeed())
+		})
+	})
+})
+
+func TestKeys(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Keys Suite")
+}
@@ -0,0 +1,294 @@
+package keys
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultReloadInterval is how often the key file is checked for changes
+const DefaultReloadInterval = 5 * time.Second
+
+// Store holds the API keys of a backend in memory for authentication, and
+// writes changes made through the admin API back to the backend. Changes take
+// effect for the next request without a restart.
+type Store struct {
+	backend Backend
+
+	mu   sync.RWMutex
+	keys *keyIndex
+
+	// writeMu serializes changes, so each one starts from the latest keys
+	writeMu sync.Mutex
+}
+
+// NewStore loads the keys in the key file at path. A missing file leaves the store
+// empty, so every request is rejected until keys are added; a malformed one is an error.
+func NewStore(path string) (*Store, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		log.Printf("Warning: %s not found, all API keys will be rejected until keys are added", path)
+	}
+	return NewStoreWithBackend(NewFileBackend(path))
+}
+
+// NewStoreWithBackend loads the keys in backend
+func NewStoreWithBackend(backend Backend) (*Store, error) {
+	s := &Store{backend: backend, keys: &keyIndex{}}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	if n := s.PlainTextKeys(); n > 0 {
+		log.Printf("Warning: %d API keys are stored in plain text, run `api-server keys hash` to hash them", n)
+	}
+	return s, nil
+}
+
+// NewStoreFromKeys creates a store holding keys in memory only
+func NewStoreFromKeys(keys ...Key) (*Store, error) {
+	return NewStoreWithBackend(NewMemoryBackend(keys...))
+}
+
+// Lookup returns the metadata of key, or an error if it is unknown, disabled or expired.
+// Keys are found by prefix and then compared in constant time.
+func (s *Store) Lookup(key string) (*Key, error) {
+	s.mu.RLock()
+	candidates := s.keys.byPrefix[PrefixOf(key)]
+	s.mu.RUnlock()
+
+	var match *Key
+	for _, candidate := range candidates {
+		if candidate.Matches(key) {
+			match = candidate
+		}
+	}
+
+	if match == nil {
+		return nil, ErrUnknownKey
+	}
+	if err := match.Check(time.Now()); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// Len returns the number of keys in the store
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys.ordered)
+}
+
+// PlainTextKeys returns the number of keys stored in plain text rather than hashed
+func (s *Store) PlainTextKeys() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, key := range s.keys.ordered {
+		if !key.Hashed() {
+			n++
+		}
+	}
+	return n
+}
+
+// List returns a copy of every key, in the order they are stored
+func (s *Store) List() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]Key, 0, len(s.keys.ordered))
+	for _, key := range s.keys.ordered {
+		keys = append(keys, *key)
+	}
+	return keys
+}
+
+// Get returns a copy of the key with the given ID, or ErrKeyNotFound
+func (s *Store) Get(id string) (Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys.byID[id]
+	if !ok {
+		return Key{}, ErrKeyNotFound
+	}
+	return *key, nil
+}
+
+// Create generates a new key with the metadata of template, stores its hash and
+// returns the stored key along with its secret, which isn't kept anywhere
+func (s *Store) Create(template Key) (Key, string, error) {
+	secret, err := Generate()
+	if err != nil {
+		return Key{}, "", err
+	}
+	hashed, err := NewHashedKey(secret)
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	key := template
+	key.ID = hashed.ID
+	key.Key = ""
+	key.Prefix = hashed.Prefix
+	key.Salt = hashed.Salt
+	key.Hash = hashed.Hash
+	key.CreatedAt = hashed.CreatedAt
+
+	if err := s.save(key); err != nil {
+		return Key{}, "", err
+	}
+	return key, secret, nil
+}
+
+// Update applies fn to a copy of the key with the given ID and stores the result
+func (s *Store) Update(id string, fn func(key *Key) error) (Key, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	key, err := s.Get(id)
+	if err != nil {
+		return Key{}, err
+	}
+	if err := fn(&key); err != nil {
+		return Key{}, err
+	}
+	// The ID is what the backend stores the key under
+	key.ID = id
+
+	if err := s.backend.Save(key); err != nil {
+		return Key{}, err
+	}
+	return key, s.reload()
+}
+
+// Rotate replaces the secret of the key with the given ID, keeping its ID and
+// metadata, and returns the updated key and its new secret. The old secret stops
+// working immediately.
+func (s *Store) Rotate(id string) (Key, string, error) {
+	var secret string
+	key, err := s.Update(id, func(key *Key) error {
+		var err error
+		secret, err = key.Rotate()
+		return err
+	})
+	if err != nil {
+		return Key{}, "", err
+	}
+	return key, secret, nil
+}
+
+// Delete removes the key with the given ID
+func (s *Store) Delete(id string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	if err := s.backend.Delete(id); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+// save stores a new key
+func (s *Store) save(key Key) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.backend.Save(key); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+// Reload reads the keys from the backend again. If they can't be read or are
+// invalid, the keys already loaded are kept and the error is returned.
+func (s *Store) Reload() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.reload()
+}
+
+// reload is Reload for callers holding writeMu
+func (s *Store) reload() error {
+	keys, err := s.backend.Load()
+	if err != nil {
+		return err
+	}
+	idx, err := index(keys)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = idx
+	s.mu.Unlock()
+	return nil
+}
+
+// Close releases the backend
+func (s *Store) Close() error {
+	return s.backend.Close()
+}
+
+// Watch reloads the keys whenever the backend reports that they changed outside
+// the server, checking every interval, and whenever the process receives SIGHUP.
+// Call the returned function to stop.
+//
+// A key file is polled rather than watched with inotify so that edits through
+// Docker bind mounts and editors that replace the file are both noticed.
+func (s *Store) Watch(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	detector, _ := s.backend.(ChangeDetector)
+
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-done:
+				return
+			case <-hangup:
+				s.reloadAndLog("SIGHUP")
+			case <-ticker.C:
+				if detector != nil && detector.Changed() {
+					s.reloadAndLog("file change")
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(hangup)
+			ticker.Stop()
+			close(done)
+			<-exited
+		})
+	}
+}
+
+// reloadAndLog reloads the keys and logs the outcome
+func (s *Store) reloadAndLog(reason string) {
+	if err := s.Reload(); err != nil {
+		log.Printf("Failed to reload API keys after %s, keeping the previous keys: %v", reason, err)
+		return
+	}
+	log.Printf("Reloaded %d API keys after %s", s.Len(), reason)
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"go-api/internal/apierror"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminAuth middleware only lets through requests carrying the admin token as
+// a Bearer token. API keys are never accepted for admin routes.
+func AdminAuth(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get("Authorization")
+			if auth == "" {
+				return apierror.Unauthorized("Missing admin token").WithCode("missing_api_key")
+			}
+
+			provided, ok := strings.CutPrefix(auth, "Bearer ")
+			if !ok {
+				return apierror.Unauthorized("Invalid Authorization header format").WithCode("invalid_authorization_header")
+			}
+
+			// Compared in constant time so the token can't be guessed byte by byte
+			if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				return apierror.Unauthorized("Invalid admin token").WithCode("invalid_admin_token")
+			}
+			return next(c)
+		}
+	}
+}
@@ -1,94 +1,82 @@
 package middleware
 
 import (
-	"net/http"
-	"os"
+	"context"
+	"errors"
+	"log"
 	"strings"
 
-	"go-api/internal/types"
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/keys"
+	"go-api/internal/oidc"
+	"go-api/internal/tracing"
 
 	"github.com/labstack/echo/v4"
-	"gopkg.in/yaml.v3"
+	"go.opentelemetry.io/otel/codes"
 )
 
-type APIKeys struct {
-	Keys []string `yaml:"api_keys"`
-}
-
-// APIKeyAuth middleware validates the API key in request headers
-func APIKeyAuth() echo.MiddlewareFunc {
-	// Load API keys from yaml file
-	data, err := os.ReadFile("api-keys.yaml")
-	if err != nil {
-		panic("Failed to read api-keys.yaml")
-	}
-
-	var apiKeys APIKeys
-	if err := yaml.Unmarshal(data, &apiKeys); err != nil {
-		panic("Failed to parse api-keys.yaml")
-	}
-
+// APIKeyAuth middleware validates the API key in request headers against store
+// and records the key's identity on the context. If verifier is not nil, JWT
+// bearer tokens are accepted too and verified by it. Authentication is traced
+// in an auth span.
+func APIKeyAuth(store *keys.Store, verifier *oidc.Verifier) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			// Get API key from Authorization header
-			auth := c.Request().Header.Get("Authorization")
-			if auth == "" {
-				return c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-					Error: struct {
-						Message string      `json:"message"`
-						Type    string      `json:"type"`
-						Param   string      `json:"param,omitempty"`
-						Code    interface{} `json:"code,omitempty"`
-					}{
-						Message: "Missing API key",
-						Type:    "unauthorized",
-					},
-				})
+			ctx, span := tracing.Start(c.Request().Context(), "auth")
+			id, err := authenticate(ctx, c, store, verifier)
+			if err != nil {
+				span.SetStatus(codes.Error, apierror.From(err).Message)
+				span.End()
+				return err
 			}
+			span.SetAttributes(tracing.KeyIDKey.String(id.KeyID))
+			span.End()
 
-			// Extract token from "Bearer <token>"
-			parts := strings.Split(auth, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				return c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-					Error: struct {
-						Message string      `json:"message"`
-						Type    string      `json:"type"`
-						Param   string      `json:"param,omitempty"`
-						Code    interface{} `json:"code,omitempty"`
-					}{
-						Message: "Invalid Authorization header format",
-						Type:    "unauthorized",
-					},
-				})
-			}
+			identity.Set(c, id)
+			return next(c)
+		}
+	}
+}
 
-			apiKey := parts[1]
+// authenticate returns the identity of the credential in the Authorization header
+func authenticate(ctx context.Context, c echo.Context, store *keys.Store, verifier *oidc.Verifier) (*identity.Identity, error) {
+	// Get API key from Authorization header
+	auth := c.Request().Header.Get("Authorization")
+	if auth == "" {
+		return nil, apierror.Unauthorized("Missing API key").WithCode("missing_api_key")
+	}
 
-			// Check if API key is valid
-			isValid := false
-			for _, validKey := range apiKeys.Keys {
-				if apiKey == validKey {
-					isValid = true
-					break
-				}
-			}
+	// Extract token from "Bearer <token>"
+	parts := strings.Split(auth, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return nil, apierror.Unauthorized("Invalid Authorization header format").WithCode("invalid_authorization_header")
+	}
 
-			if !isValid {
-				return c.JSON(http.StatusUnauthorized, types.ErrorResponse{
-					Error: struct {
-						Message string      `json:"message"`
-						Type    string      `json:"type"`
-						Param   string      `json:"param,omitempty"`
-						Code    interface{} `json:"code,omitempty"`
-					}{
-						Message: "Invalid API key",
-						Type:    "unauthorized",
-					},
-				})
-			}
+	apiKey := parts[1]
 
-			// Valid API key, proceed to the next handler
-			return next(c)
+	// Static keys never contain dots, so anything shaped like a JWT is one
+	if verifier != nil && oidc.IsJWT(apiKey) {
+		id, err := verifier.Verify(ctx, apiKey)
+		switch {
+		case errors.Is(err, oidc.ErrTokenExpired):
+			return nil, apierror.Unauthorized("Token has expired").WithCode("token_expired")
+		case err != nil:
+			log.Printf("Rejected JWT: %v", err)
+			return nil, apierror.Unauthorized("Invalid token").WithCode("invalid_token")
 		}
+		return id, nil
+	}
+
+	// Check if API key is valid
+	key, err := store.Lookup(apiKey)
+	switch {
+	case errors.Is(err, keys.ErrKeyDisabled):
+		return nil, apierror.Unauthorized("API key is disabled").WithCode("api_key_disabled")
+	case errors.Is(err, keys.ErrKeyExpired):
+		return nil, apierror.Unauthorized("API key has expired").WithCode("api_key_expired")
+	case err != nil:
+		return nil, apierror.Unauthorized("Invalid API key").WithCode("invalid_api_key")
 	}
+	return key.Identity(), nil
 }
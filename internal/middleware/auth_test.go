@@ -0,0 +1,173 @@
+package middleware_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/keys"
+	"go-api/internal/middleware"
+	"go-api/internal/oidc"
+	"go-api/internal/types"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("APIKeyAuth", func() {
+	var (
+		e        *echo.Echo
+		seen     *identity.Identity
+		validKey string
+		validID  string
+	)
+
+	BeforeEach(func() {
+		secret, err := keys.Generate()
+		Expect(err).NotTo(HaveOccurred())
+		valid, err := keys.NewHashedKey(secret)
+		Expect(err).NotTo(HaveOccurred())
+		valid.Owner = "alice"
+		valid.RateLimitTier = "pro"
+		validKey = secret
+		validID = valid.ID
+
+		store, err := keys.NewStoreFromKeys(valid, keys.Key{Key: "scarlett-disabled-0002", Disabled: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		seen = nil
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		e.GET("/", func(c echo.Context) error {
+			seen, _ = identity.FromContext(c)
+			return c.NoContent(http.StatusNoContent)
+		}, middleware.APIKeyAuth(store, nil))
+	})
+
+	// get sends a request with the given Authorization header
+	get := func(auth string) (*httptest.ResponseRecorder, types.ErrorResponse) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var errResp types.ErrorResponse
+		if rec.Code != http.StatusNoContent {
+			ExpectWithOffset(1, json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+		}
+		return rec, errResp
+	}
+
+	It("puts the key's identity on the context", func() {
+		rec, _ := get("Bearer " + validKey)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(seen).NotTo(BeNil())
+		Expect(seen.KeyID).To(Equal(validID))
+		Expect(seen.Owner).To(Equal("alice"))
+		Expect(seen.RateLimitTier).To(Equal("pro"))
+	})
+
+	Context("with JWT authentication", func() {
+		var signingKey *rsa.PrivateKey
+
+		BeforeEach(func() {
+			var err error
+			signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+			Expect(err).NotTo(HaveOccurred())
+
+			jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "idp-1",
+				"n":   base64.RawURLEncoding.EncodeToString(signingKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(signingKey.E)).Bytes()),
+			}}})
+			Expect(err).NotTo(HaveOccurred())
+			path := filepath.Join(GinkgoT().TempDir(), "jwks.json")
+			Expect(os.WriteFile(path, jwks, 0o600)).To(Succeed())
+
+			verifier, err := oidc.NewVerifier(oidc.Config{Issuer: "https://id.example.com", Audience: "scarlett-api", JWKS: path})
+			Expect(err).NotTo(HaveOccurred())
+			store, err := keys.NewStoreFromKeys()
+			Expect(err).NotTo(HaveOccurred())
+			e.GET("/jwt", func(c echo.Context) error {
+				seen, _ = identity.FromContext(c)
+				return c.NoContent(http.StatusNoContent)
+			}, middleware.APIKeyAuth(store, verifier))
+		})
+
+		// token signs a token expiring at exp
+		token := func(exp time.Time) string {
+			t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+				"iss": "https://id.example.com", "aud": "scarlett-api", "sub": "svc-search",
+				"tier": "pro", "exp": exp.Unix(),
+			})
+			t.Header["kid"] = "idp-1"
+			signed, err := t.SignedString(signingKey)
+			Expect(err).NotTo(HaveOccurred())
+			return signed
+		}
+
+		// getJWT sends a request to the JWT-enabled route
+		getJWT := func(tok string) (*httptest.ResponseRecorder, types.ErrorResponse) {
+			req := httptest.NewRequest(http.MethodGet, "/jwt", nil)
+			req.Header.Set("Authorization", "Bearer "+tok)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			var errResp types.ErrorResponse
+			if rec.Code != http.StatusNoContent {
+				ExpectWithOffset(1, json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+			}
+			return rec, errResp
+		}
+
+		It("puts the token's identity on the context", func() {
+			rec, _ := getJWT(token(time.Now().Add(time.Hour)))
+
+			Expect(rec.Code).To(Equal(http.StatusNoContent))
+			Expect(seen.KeyID).To(Equal("jwt:svc-search"))
+			Expect(seen.RateLimitTier).To(Equal("pro"))
+		})
+
+		It("rejects expired and forged tokens", func() {
+			rec, errResp := getJWT(token(time.Now().Add(-time.Hour)))
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+			Expect(errResp.Error.Code).To(Equal("token_expired"))
+
+			forged := token(time.Now().Add(time.Hour))
+			rec, errResp = getJWT(forged[:len(forged)-4] + "AAAA")
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+			Expect(errResp.Error.Code).To(Equal("invalid_token"))
+			Expect(seen).To(BeNil())
+		})
+	})
+
+	DescribeTable("rejects requests it can't authenticate",
+		func(auth, code string) {
+			rec, errResp := get(auth)
+
+			Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+			Expect(errResp.Error.Type).To(Equal("unauthorized"))
+			Expect(errResp.Error.Code).To(Equal(code))
+			Expect(seen).To(BeNil())
+		},
+		Entry("missing header", "", "missing_api_key"),
+		Entry("not a Bearer token", "Basic abc", "invalid_authorization_header"),
+		Entry("unknown key", "Bearer scarlett-nope", "invalid_api_key"),
+		Entry("disabled key", "Bearer scarlett-disabled-0002", "api_key_disabled"),
+	)
+})
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"fmt"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AuthorizeChat middleware checks a chat request against the policy of the
+// caller's identity: the models, max_tokens and features it may use. It must
+// run after APIKeyAuth; requests without an identity pass through unchecked.
+//
+// A request that doesn't set max_tokens gets the identity's cap, so a capped
+// key can't lift the limit by leaving it out.
+func AuthorizeChat() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id, ok := identity.FromContext(c)
+			if !ok {
+				return next(c)
+			}
+
+			// A body that doesn't decode is left for the handler to reject
+			req, err := chatRequest(c)
+			if err != nil {
+				return next(c)
+			}
+
+			if err := checkChatPolicy(id, req); err != nil {
+				return err
+			}
+
+			if id.MaxTokens > 0 && req.MaxTokens == 0 && req.MaxCompletionTokens == 0 {
+				req.MaxTokens = id.MaxTokens
+				if err := setChatRequest(c, req); err != nil {
+					return apierror.Internal("Failed to apply max_tokens").WithCause(err)
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// checkChatPolicy returns a permission_denied error for the first part of req id may not use
+func checkChatPolicy(id *identity.Identity, req *types.ChatRequest) error {
+	if req.Model != "" && !id.AllowsModel(req.Model) {
+		return apierror.PermissionDenied(fmt.Sprintf("This API key is not allowed to use model '%s'", req.Model)).WithParam("model")
+	}
+
+	if id.MaxTokens > 0 {
+		if req.MaxTokens > id.MaxTokens {
+			return apierror.PermissionDenied(fmt.Sprintf("max_tokens may be at most %d for this API key", id.MaxTokens)).WithParam("max_tokens")
+		}
+		if req.MaxCompletionTokens > id.MaxTokens {
+			return apierror.PermissionDenied(fmt.Sprintf("max_completion_tokens may be at most %d for this API key", id.MaxTokens)).WithParam("max_completion_tokens")
+		}
+	}
+
+	if req.Stream && !id.AllowsFeature(identity.FeatureStreaming) {
+		return apierror.PermissionDenied("This API key is not allowed to stream responses").WithParam("stream")
+	}
+	if (len(req.Tools) > 0 || req.ToolChoice != nil) && !id.AllowsFeature(identity.FeatureTools) {
+		return apierror.PermissionDenied("This API key is not allowed to use tools").WithParam("tools")
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/middleware"
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AuthorizeChat", func() {
+	var (
+		e      *echo.Echo
+		caller *identity.Identity
+		body   string
+	)
+
+	BeforeEach(func() {
+		caller = &identity.Identity{
+			KeyID:           "scarlett-intern",
+			AllowedModels:   []string{"llama-3.1-8b-instant", "gemma-*"},
+			MaxTokens:       256,
+			AllowedFeatures: []string{identity.FeatureStreaming},
+		}
+		body = ""
+
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		setIdentity := func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				identity.Set(c, caller)
+				return next(c)
+			}
+		}
+		e.POST("/chat/completions", func(c echo.Context) error {
+			data, err := io.ReadAll(c.Request().Body)
+			Expect(err).NotTo(HaveOccurred())
+			body = string(data)
+			return c.NoContent(http.StatusNoContent)
+		}, setIdentity, middleware.AuthorizeChat())
+	})
+
+	// post sends a chat request
+	post := func(request string) (*httptest.ResponseRecorder, types.ErrorResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(request))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var errResp types.ErrorResponse
+		if rec.Code != http.StatusNoContent {
+			ExpectWithOffset(1, json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+		}
+		return rec, errResp
+	}
+
+	It("passes allowed requests through unchanged", func() {
+		request := `{"model":"gemma-7b-it","messages":[{"role":"user","content":"hi"}],"max_tokens":100,"stream":true}`
+		rec, _ := post(request)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(body).To(Equal(request))
+	})
+
+	It("caps requests that don't set max_tokens", func() {
+		rec, _ := post(`{"model":"llama-3.1-8b-instant","messages":[{"role":"user","content":"hi"}],"seed":7}`)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		var forwarded map[string]interface{}
+		Expect(json.Unmarshal([]byte(body), &forwarded)).To(Succeed())
+		Expect(forwarded).To(HaveKeyWithValue("max_tokens", 256.0))
+		Expect(forwarded).To(HaveKeyWithValue("seed", 7.0))
+	})
+
+	DescribeTable("rejects what the key isn't allowed to do",
+		func(request, param string) {
+			rec, errResp := post(request)
+
+			Expect(rec.Code).To(Equal(http.StatusForbidden))
+			Expect(errResp.Error.Type).To(Equal(apierror.TypePermission))
+			Expect(errResp.Error.Code).To(Equal("permission_denied"))
+			Expect(errResp.Error.Param).To(Equal(param))
+			Expect(body).To(BeEmpty())
+		},
+		Entry("another model", `{"model":"llama-3.3-70b-versatile","messages":[]}`, "model"),
+		Entry("too many tokens", `{"model":"llama-3.1-8b-instant","messages":[],"max_tokens":1000}`, "max_tokens"),
+		Entry("too many completion tokens", `{"model":"llama-3.1-8b-instant","messages":[],"max_completion_tokens":1000}`, "max_completion_tokens"),
+		Entry("tools", `{"model":"llama-3.1-8b-instant","messages":[],"tools":[{"type":"function","function":{"name":"f"}}]}`, "tools"),
+	)
+
+	It("allows everything for identities without a policy", func() {
+		caller = &identity.Identity{KeyID: "scarlett-prod"}
+		request := `{"model":"llama-3.3-70b-versatile","messages":[],"max_tokens":4096,"tools":[{"type":"function","function":{"name":"f"}}]}`
+		rec, _ := post(request)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(body).To(Equal(request))
+	})
+
+	It("rejects streaming when only tools are allowed", func() {
+		caller.AllowedFeatures = []string{identity.FeatureTools}
+		rec, errResp := post(`{"model":"llama-3.1-8b-instant","messages":[],"stream":true}`)
+
+		Expect(rec.Code).To(Equal(http.StatusForbidden))
+		Expect(errResp.Error.Param).To(Equal("stream"))
+	})
+
+	It("leaves malformed bodies to the handler", func() {
+		rec, _ := post(`{"model":`)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(body).To(Equal(`{"model":`))
+	})
+})
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"go-api/internal/apierror"
+	"go-api/internal/billing"
+	"go-api/internal/identity"
+	"go-api/internal/requestid"
+	"go-api/internal/types"
+	"go-api/internal/usage"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderBudgetWarning is set on responses to callers past their soft monthly budget
+const HeaderBudgetWarning = "x-budget-warning"
+
+// BudgetEnforcer middleware costs every completion at the prices in pricing,
+// charges it to the caller in ledger, and holds callers to their monthly
+// budgets. It must run after APIKeyAuth.
+//
+// A request is rejected when what the caller has spent this month, plus the
+// most its prompt and max_tokens could cost, is over the caller's hard budget.
+// That most is reserved in the ledger before the request goes upstream, and
+// replaced by the real cost once it is done, so concurrent requests can't
+// together spend past the budget. Past the soft budget, requests still go
+// through but carry a warning header. Budgets reset at the start of each
+// calendar month, in UTC.
+func BudgetEnforcer(ledger billing.Ledger, pricing *billing.Pricing) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id, ok := identity.FromContext(c)
+			if !ok {
+				return next(c)
+			}
+
+			// A body that doesn't decode is left for the handler to reject
+			req, err := chatRequest(c)
+			if err != nil {
+				return next(c)
+			}
+
+			month := billing.Month(time.Now())
+
+			// spent is what the caller had spent, and reserved for requests
+			// in flight, before this request
+			var reserved, spent float64
+			if id.MonthlyBudget > 0 || id.SoftBudget > 0 {
+				estimate := pricing.Cost(req.Model, types.Usage{
+					PromptTokens:     usage.EstimatePrompt(req),
+					CompletionTokens: completionTokens(req),
+				})
+
+				if id.MonthlyBudget > 0 {
+					total, ok, err := ledger.Reserve(id.KeyID, month, estimate, id.MonthlyBudget)
+					switch {
+					case err != nil:
+						// The budget can't be checked; the request is still costed below
+						log.Printf("Request %s: failed to reserve $%.6f of the budget of key %s: %v", requestid.FromEcho(c), estimate, id.KeyID, err)
+					case !ok:
+						return apierror.InsufficientQuota(fmt.Sprintf("This request could cost up to $%.4f, more than is left of the monthly budget of this API key ($%.2f of $%.2f spent). Reduce max_tokens or wait until next month.", estimate, total, id.MonthlyBudget))
+					default:
+						reserved, spent = estimate, total-estimate
+					}
+				} else {
+					var err error
+					if spent, err = ledger.Spent(id.KeyID, month); err != nil {
+						log.Printf("Request %s: failed to read the spend of key %s: %v", requestid.FromEcho(c), id.KeyID, err)
+					}
+				}
+				if id.SoftBudget > 0 && spent >= id.SoftBudget {
+					c.Response().Header().Set(HeaderBudgetWarning, fmt.Sprintf("$%.2f of the soft monthly budget of $%.2f spent", spent, id.SoftBudget))
+				}
+			}
+
+			err = next(c)
+
+			// Charge what the completion really used in place of what was
+			// reserved. Requests that never reached a model cost nothing.
+			var cost float64
+			if u, ok := usage.FromContext(c); ok {
+				cost = pricing.Cost(req.Model, u)
+				billing.SetCost(c, cost)
+			}
+			if cost == 0 && reserved == 0 {
+				return err
+			}
+
+			total, chargeErr := ledger.Charge(id.KeyID, month, cost-reserved)
+			if chargeErr != nil {
+				log.Printf("Request %s: failed to charge $%.6f to key %s: %v", requestid.FromEcho(c), cost-reserved, id.KeyID, chargeErr)
+				return err
+			}
+			// The spend crosses the soft budget when the reservation is
+			// settled, or already when it was made
+			before := total - (cost - reserved)
+			if reserved > 0 && spent < before {
+				before = spent
+			}
+			if id.SoftBudget > 0 && total >= id.SoftBudget && before < id.SoftBudget {
+				log.Printf("Key %s has spent $%.2f this month, past its soft budget of $%.2f", id.KeyID, total, id.SoftBudget)
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"go-api/internal/apierror"
+	"go-api/internal/billing"
+	"go-api/internal/identity"
+	"go-api/internal/middleware"
+	"go-api/internal/types"
+	"go-api/internal/usage"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BudgetEnforcer", func() {
+	// At $1 per million tokens each way, this request may cost up to about $0.001
+	const request = `{"model":"llama-3.1-8b-instant","messages":[{"role":"user","content":"hi"}],"max_tokens":1000}`
+
+	var (
+		e      *echo.Echo
+		caller *identity.Identity
+		ledger *billing.MemoryLedger
+		used   types.Usage
+		cost   float64
+		served int
+		gate   chan struct{}
+	)
+
+	BeforeEach(func() {
+		caller = &identity.Identity{KeyID: "key_budget"}
+		ledger = billing.NewMemoryLedger()
+		used = types.Usage{PromptTokens: 100_000, CompletionTokens: 200_000, TotalTokens: 300_000}
+		cost = 0
+		served = 0
+		gate = nil
+		pricing := &billing.Pricing{Models: map[string]billing.Price{"llama*": {Input: 1, Output: 1}}}
+
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		setIdentity := func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				identity.Set(c, caller)
+				return next(c)
+			}
+		}
+		// Reads the cost the middleware recorded, as PrometheusMiddleware does
+		recordCost := func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				err := next(c)
+				cost, _ = billing.CostFromContext(c)
+				return err
+			}
+		}
+		e.POST("/chat/completions", func(c echo.Context) error {
+			served++
+			if gate != nil {
+				<-gate
+			}
+			if used.TotalTokens > 0 {
+				usage.Set(c, used)
+			}
+			return c.NoContent(http.StatusNoContent)
+		}, recordCost, setIdentity, middleware.BudgetEnforcer(ledger, pricing))
+	})
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(request))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	month := func() string {
+		return billing.Month(time.Now())
+	}
+
+	It("charges the cost of each completion to the caller", func() {
+		Expect(post().Code).To(Equal(http.StatusNoContent))
+		Expect(cost).To(BeNumerically("~", 0.3, 1e-9))
+
+		Expect(post().Code).To(Equal(http.StatusNoContent))
+		Expect(ledger.Spent("key_budget", month())).To(BeNumerically("~", 0.6, 1e-9))
+	})
+
+	It("rejects requests that could go over the hard budget", func() {
+		caller.MonthlyBudget = 1
+		_, err := ledger.Charge("key_budget", month(), 0.9995)
+		Expect(err).NotTo(HaveOccurred())
+
+		rec := post()
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(served).To(BeZero())
+
+		var errResp types.ErrorResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+		Expect(errResp.Error.Type).To(Equal(apierror.TypeInsufficientQuota))
+		Expect(errResp.Error.Code).To(Equal("insufficient_quota"))
+
+		// Spend from other months doesn't count
+		caller.KeyID = "key_other"
+		_, err = ledger.Charge("key_other", "2000-01", 100)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(post().Code).To(Equal(http.StatusNoContent))
+	})
+
+	It("holds the budget of requests in flight", func() {
+		caller.MonthlyBudget = 0.0015
+		gate = make(chan struct{})
+		inFlight := gate
+
+		done := make(chan int)
+		go func() {
+			done <- post().Code
+		}()
+		Eventually(func() float64 {
+			spent, _ := ledger.Spent("key_budget", month())
+			return spent
+		}).Should(BeNumerically(">", 0))
+
+		// The first request may still cost up to its estimate, so a second doesn't fit
+		Expect(post().Code).To(Equal(http.StatusTooManyRequests))
+
+		close(inFlight)
+		Expect(<-done).To(Equal(http.StatusNoContent))
+		Expect(ledger.Spent("key_budget", month())).To(BeNumerically("~", 0.3, 1e-9))
+	})
+
+	It("warns callers past the soft budget", func() {
+		caller.MonthlyBudget = 10
+		caller.SoftBudget = 0.5
+
+		rec := post()
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get(middleware.HeaderBudgetWarning)).To(BeEmpty())
+
+		post()
+		rec = post()
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get(middleware.HeaderBudgetWarning)).To(ContainSubstring("$0.60"))
+	})
+
+	It("logs crossing the soft budget once, also when the reservation crosses it", func() {
+		var logs bytes.Buffer
+		DeferCleanup(log.SetOutput, log.Writer())
+		log.SetOutput(&logs)
+
+		caller.MonthlyBudget = 10
+		caller.SoftBudget = 1
+		// Each request reserves about $0.001 and costs $0.0003
+		used = types.Usage{PromptTokens: 100, CompletionTokens: 200, TotalTokens: 300}
+		_, err := ledger.Charge("key_budget", month(), 0.9995)
+		Expect(err).NotTo(HaveOccurred())
+
+		// The reservation crosses the soft budget but the cost doesn't
+		Expect(post().Code).To(Equal(http.StatusNoContent))
+		Expect(ledger.Spent("key_budget", month())).To(BeNumerically("~", 0.9998, 1e-9))
+		Expect(logs.String()).NotTo(ContainSubstring("past its soft budget"))
+
+		// Both cross it
+		Expect(post().Code).To(Equal(http.StatusNoContent))
+		Expect(ledger.Spent("key_budget", month())).To(BeNumerically("~", 1.0001, 1e-9))
+		Expect(logs.String()).To(ContainSubstring("Key key_budget has spent $1.00 this month, past its soft budget of $1.00"))
+
+		Expect(post().Code).To(Equal(http.StatusNoContent))
+		Expect(strings.Count(logs.String(), "past its soft budget")).To(Equal(1))
+	})
+
+	It("charges nothing for requests that never reached a model", func() {
+		used = types.Usage{}
+		Expect(post().Code).To(Equal(http.StatusNoContent))
+		Expect(ledger.Spent("key_budget", month())).To(BeZero())
+
+		// What was reserved for them is released
+		caller.MonthlyBudget = 1
+		Expect(post().Code).To(Equal(http.StatusNoContent))
+		Expect(ledger.Spent("key_budget", month())).To(BeZero())
+	})
+})
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+// chatRequestKey is the echo context key caching the chat request decoded by chatRequest
+const chatRequestKey = "chat_request"
+
+// chatRequest decodes the chat request in the body once per request, leaving
+// the body in place for the handler to bind
+func chatRequest(c echo.Context) (*types.ChatRequest, error) {
+	if req, ok := c.Get(chatRequestKey).(*types.ChatRequest); ok {
+		return req, nil
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return nil, err
+	}
+	restoreBody(c, body)
+
+	var req types.ChatRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	c.Set(chatRequestKey, &req)
+	return &req, nil
+}
+
+// setChatRequest replaces the request body with req, for middleware that changes the request
+func setChatRequest(c echo.Context, req *types.ChatRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	restoreBody(c, body)
+	c.Set(chatRequestKey, req)
+	return nil
+}
+
+// restoreBody makes body the request body again
+func restoreBody(c echo.Context, body []byte) {
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+	c.Request().ContentLength = int64(len(body))
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/ratelimit"
+	"go-api/internal/tracing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ConcurrencyLimiter middleware caps how many requests each caller, and every
+// caller together, may have in flight at once, as the concurrency section of
+// policy says. It must run after APIKeyAuth.
+//
+// A request over a cap waits in the limiter's queue, where callers of a
+// higher priority tier go first, until a slot frees up or the queue timeout
+// passes. A key's max_concurrent_requests quota overrides the cap of its tier.
+// The slot is held until the handler returns, so a stream holds it until it ends.
+func ConcurrencyLimiter(limiter *ratelimit.ConcurrencyLimiter, policy *ratelimit.Policy) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id, ok := identity.FromContext(c)
+			if !ok {
+				return next(c)
+			}
+
+			config := policy.Config().Concurrency
+			if config.IsZero() && id.MaxConcurrent == 0 {
+				return next(c)
+			}
+
+			tier := config.Tier(id.RateLimitTier)
+			caller := ratelimit.Caller{
+				Key:      id.KeyID,
+				Tier:     id.RateLimitTier,
+				PerKey:   tier.PerKey,
+				Priority: tier.Priority,
+			}
+			if id.MaxConcurrent > 0 {
+				caller.PerKey = id.MaxConcurrent
+			}
+
+			// The span covers any wait in the queue
+			ctx, span := tracing.Start(c.Request().Context(), "concurrency_limit")
+			release, err := limiter.Acquire(ctx, caller, config)
+			span.SetAttributes(tracing.RateLimitAllowedKey.Bool(err == nil))
+			if caller.PerKey > 0 {
+				span.SetAttributes(tracing.RateLimitLimitKey.Int(caller.PerKey))
+			}
+			span.End()
+			switch {
+			case errors.Is(err, ratelimit.ErrConcurrencyLimit):
+				return apierror.ConcurrencyLimited("Too many concurrent requests. Wait for some of your requests to finish and try again.")
+			case errors.Is(err, ratelimit.ErrQueueTimeout):
+				return apierror.ConcurrencyLimited(fmt.Sprintf("Too many concurrent requests: no slot came up within %s. Wait for some of your requests to finish and try again.", queueTimeout(config)))
+			case err != nil:
+				// The client went away while queued
+				return apierror.New(http.StatusRequestTimeout, apierror.TypeInvalidRequest, "The request was cancelled while waiting for a concurrency slot")
+			}
+			defer release()
+
+			return next(c)
+		}
+	}
+}
+
+// queueTimeout returns how long requests wait in the queue
+func queueTimeout(config ratelimit.ConcurrencyConfig) string {
+	if config.QueueTimeout > 0 {
+		return config.QueueTimeout.String()
+	}
+	return ratelimit.DefaultQueueTimeout.String()
+}
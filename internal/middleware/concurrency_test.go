@@ -0,0 +1,118 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/middleware"
+	"go-api/internal/ratelimit"
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ConcurrencyLimiter", func() {
+	var (
+		e        *echo.Echo
+		caller   *identity.Identity
+		limiter  *ratelimit.ConcurrencyLimiter
+		config   *ratelimit.Config
+		finish   chan struct{}
+		started  chan struct{}
+		statuses chan *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		caller = &identity.Identity{KeyID: "key_alice", RateLimitTier: "free"}
+		limiter = ratelimit.NewConcurrencyLimiter(nil)
+		config = ratelimit.DefaultConfig()
+		config.Concurrency = ratelimit.ConcurrencyConfig{
+			Tiers: map[string]ratelimit.ConcurrencyTier{"free": {PerKey: 1}},
+		}
+		finish = make(chan struct{})
+		started = make(chan struct{}, 10)
+		statuses = make(chan *httptest.ResponseRecorder, 10)
+		DeferCleanup(func() { close(finish) })
+
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		setIdentity := func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				identity.Set(c, caller)
+				return next(c)
+			}
+		}
+		// The handler holds its slot until the spec lets it finish, as a stream would
+		finish, started := finish, started
+		e.POST("/chat/completions", func(c echo.Context) error {
+			started <- struct{}{}
+			<-finish
+			return c.NoContent(http.StatusNoContent)
+		}, setIdentity, middleware.ConcurrencyLimiter(limiter, ratelimit.NewPolicy(config)))
+	})
+
+	// send sends a chat request in the background; its response arrives on statuses
+	send := func() {
+		e, statuses := e, statuses
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/chat/completions", nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			statuses <- rec
+		}()
+	}
+
+	It("rejects requests over the cap of the caller's tier", func() {
+		send()
+		Eventually(started).Should(Receive())
+
+		send()
+		var rec *httptest.ResponseRecorder
+		Eventually(statuses).Should(Receive(&rec))
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+
+		var errResp types.ErrorResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+		Expect(errResp.Error.Type).To(Equal(apierror.TypeRateLimit))
+		Expect(errResp.Error.Code).To(Equal("concurrency_limit_exceeded"))
+	})
+
+	It("queues requests until a slot frees up", func() {
+		config.Concurrency.QueueSize = 1
+		config.Concurrency.QueueTimeout = time.Minute
+
+		send()
+		Eventually(started).Should(Receive())
+		send()
+		Eventually(limiter.Queued).Should(Equal(1))
+		Consistently(started, 50*time.Millisecond).ShouldNot(Receive())
+
+		finish <- struct{}{}
+		Eventually(started).Should(Receive())
+		Expect(limiter.Queued()).To(BeZero())
+	})
+
+	It("lets the key's quota override its tier", func() {
+		caller.MaxConcurrent = 2
+
+		send()
+		send()
+		Eventually(started).Should(Receive())
+		Eventually(started).Should(Receive())
+		Expect(limiter.InFlight("key_alice")).To(Equal(2))
+	})
+
+	It("frees the slot once the handler returns", func() {
+		send()
+		Eventually(started).Should(Receive())
+		finish <- struct{}{}
+		Eventually(statuses).Should(Receive())
+		Expect(limiter.InFlight("key_alice")).To(BeZero())
+	})
+})
@@ -1,13 +1,16 @@
 package middleware
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
-	"net/http"
 	"strconv"
 	"time"
 
+	"go-api/internal/apierror"
+	"go-api/internal/billing"
+	"go-api/internal/identity"
+	"go-api/internal/types"
+	"go-api/internal/usage"
+	"go-api/pkg/provider"
+
 	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -33,11 +36,11 @@ var (
 		[]string{"method", "path"},
 	)
 
-	// apiKeyRequests counts requests by API key
+	// apiKeyRequests counts requests by the ID of the caller's key
 	apiKeyRequests = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "api_key_requests_total",
-			Help: "Total number of requests by API key (masked)",
+			Help: "Total number of authenticated requests by API key ID",
 		},
 		[]string{"api_key"},
 	)
@@ -68,34 +71,62 @@ var (
 		},
 		[]string{"api_key"},
 	)
-)
 
-// responseBodyWriter is a custom response writer that captures the response body
-type responseBodyWriter struct {
-	io.Writer
-	http.ResponseWriter
-	statusCode int
-}
+	// costUSDTotal tracks what the completions of each API key cost
+	costUSDTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cost_usd_total",
+			Help: "Total cost in USD of completions by API key, at the prices in the pricing file",
+		},
+		[]string{"api_key"},
+	)
 
-// WriteHeader captures the status code
-func (r *responseBodyWriter) WriteHeader(status int) {
-	r.statusCode = status
-	r.ResponseWriter.WriteHeader(status)
-}
+	// concurrentRequestsInFlight tracks the requests in flight under the concurrency limiter
+	concurrentRequestsInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "concurrent_requests_in_flight",
+			Help: "Number of chat requests in flight by rate limit tier",
+		},
+		[]string{"tier"},
+	)
 
-// Write captures the response body
-func (r *responseBodyWriter) Write(b []byte) (int, error) {
-	return r.Writer.Write(b)
-}
+	// concurrentRequestsQueued tracks the requests waiting for a concurrency slot
+	concurrentRequestsQueued = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "concurrent_requests_queued",
+			Help: "Number of chat requests waiting for a concurrency slot by rate limit tier",
+		},
+		[]string{"tier"},
+	)
 
-// responseBody represents the structure of a chat completion response
-type responseBody struct {
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
-}
+	// upstreamBreakerState tracks the circuit breaker state of each upstream route
+	upstreamBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "upstream_circuit_breaker_state",
+			Help: "Circuit breaker state by upstream provider and model (0 = closed, 1 = open, 2 = half-open)",
+		},
+		[]string{"provider", "model"},
+	)
+
+	// upstreamBreakerTransitions counts circuit breaker state changes
+	upstreamBreakerTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "upstream_circuit_breaker_transitions_total",
+			Help: "Total number of circuit breaker state transitions by upstream provider and model",
+		},
+		[]string{"provider", "model", "from", "to"},
+	)
+
+	// upstreamRequestDuration measures how long upstreams take to respond
+	upstreamRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "upstream_request_duration_seconds",
+			Help:    "Time until the upstream response arrived, including retries and failover, by provider, model and status code",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"provider", "model", "status"},
+	)
+)
 
 func init() {
 	// Register metrics with Prometheus
@@ -105,6 +136,12 @@ func init() {
 	prometheus.MustRegister(tokenUsagePrompt)
 	prometheus.MustRegister(tokenUsageCompletion)
 	prometheus.MustRegister(tokenUsageTotal)
+	prometheus.MustRegister(costUSDTotal)
+	prometheus.MustRegister(concurrentRequestsInFlight)
+	prometheus.MustRegister(concurrentRequestsQueued)
+	prometheus.MustRegister(upstreamBreakerState)
+	prometheus.MustRegister(upstreamBreakerTransitions)
+	prometheus.MustRegister(upstreamRequestDuration)
 }
 
 // PrometheusMiddleware returns a middleware function that collects Prometheus metrics
@@ -113,77 +150,34 @@ func PrometheusMiddleware() echo.MiddlewareFunc {
 		return func(c echo.Context) error {
 			start := time.Now()
 
-			// Capture API key from the request
-			// The API key is in the Authorization header in the format "Bearer <token>"
+			err := next(c)
+
+			// Per-key metrics are labelled with the ID of the key APIKeyAuth
+			// authenticated the request with, never with the bearer token,
+			// so JWTs don't add a series each time they are refreshed
 			apiKey := "unknown"
-			auth := c.Request().Header.Get("Authorization")
-			if len(auth) > 7 && auth[:7] == "Bearer " {
-				key := auth[7:]
-				if len(key) > 8 {
-					// Mask the API key for privacy - keep first and last 4 chars
-					apiKey = key[:4] + "..." + key[len(key)-4:]
-				} else {
-					apiKey = "short_key"
-				}
+			caller, authenticated := identity.FromContext(c)
+			if authenticated {
+				apiKey = caller.KeyID
 			}
 
-			// Use a custom response writer to capture the response body
-			// Only do this for chat completions endpoint to avoid overhead on other endpoints
-			if c.Path() == "/chat/completions" && c.Request().Method == "POST" {
-				resBody := new(bytes.Buffer)
-				writer := &responseBodyWriter{
-					Writer:         io.MultiWriter(resBody, c.Response().Writer),
-					ResponseWriter: c.Response().Writer,
-					statusCode:     http.StatusOK,
-				}
-
-				// Replace the response writer
-				c.Response().Writer = writer
-
-				// Process the request
-				err := next(c)
-
-				// Only try to parse the response body if the status code is 200 OK
-				if writer.statusCode == http.StatusOK {
-					var response responseBody
-					if jsonErr := json.Unmarshal(resBody.Bytes(), &response); jsonErr == nil {
-						// Record token usage metrics
-						if response.Usage.PromptTokens > 0 {
-							tokenUsagePrompt.WithLabelValues(apiKey).Add(float64(response.Usage.PromptTokens))
-						}
-						if response.Usage.CompletionTokens > 0 {
-							tokenUsageCompletion.WithLabelValues(apiKey).Add(float64(response.Usage.CompletionTokens))
-						}
-						if response.Usage.TotalTokens > 0 {
-							tokenUsageTotal.WithLabelValues(apiKey).Add(float64(response.Usage.TotalTokens))
-						}
-					}
-				}
-
-				// Record metrics after the request is processed
-				duration := time.Since(start).Seconds()
-				status := writer.statusCode
-				method := c.Request().Method
-				path := c.Request().URL.Path
-
-				// Record HTTP metrics
-				httpRequestsTotal.WithLabelValues(strconv.Itoa(status), method, path).Inc()
-				httpRequestDuration.WithLabelValues(method, path).Observe(duration)
-
-				// Record API key usage
-				if apiKey != "unknown" {
-					apiKeyRequests.WithLabelValues(apiKey).Inc()
-				}
-
-				return err
+			// Record token usage of chat completions, streamed or not.
+			// The chat handler stores it on the context once the completion is done.
+			if u, ok := usage.FromContext(c); ok {
+				recordTokenUsage(apiKey, u)
+			}
+			// BudgetEnforcer stores the cost of the completion beside it
+			if cost, ok := billing.CostFromContext(c); ok && cost > 0 {
+				costUSDTotal.WithLabelValues(apiKey).Add(cost)
 			}
-
-			// Standard processing for all other requests
-			err := next(c)
 
 			// Record metrics after the request is processed
 			duration := time.Since(start).Seconds()
 			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				// The error is written further out, by the error handler
+				status = apierror.From(err).Status
+			}
 			method := c.Request().Method
 			path := c.Request().URL.Path
 
@@ -192,7 +186,7 @@ func PrometheusMiddleware() echo.MiddlewareFunc {
 			httpRequestDuration.WithLabelValues(method, path).Observe(duration)
 
 			// Record API key usage
-			if apiKey != "unknown" {
+			if authenticated {
 				apiKeyRequests.WithLabelValues(apiKey).Inc()
 			}
 
@@ -201,6 +195,54 @@ func PrometheusMiddleware() echo.MiddlewareFunc {
 	}
 }
 
+// recordTokenUsage adds a completion's token usage to the counters of apiKey
+func recordTokenUsage(apiKey string, u types.Usage) {
+	if u.PromptTokens > 0 {
+		tokenUsagePrompt.WithLabelValues(apiKey).Add(float64(u.PromptTokens))
+	}
+	if u.CompletionTokens > 0 {
+		tokenUsageCompletion.WithLabelValues(apiKey).Add(float64(u.CompletionTokens))
+	}
+	if u.TotalTokens > 0 {
+		tokenUsageTotal.WithLabelValues(apiKey).Add(float64(u.TotalTokens))
+	}
+}
+
+// UpstreamMetrics records the chat service's upstream observations in Prometheus
+type UpstreamMetrics struct{}
+
+// ObserveUpstream records an upstream response and how long it took to arrive
+func (UpstreamMetrics) ObserveUpstream(route provider.Route, status int, duration time.Duration) {
+	upstreamRequestDuration.WithLabelValues(route.Provider, route.Model, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObserveBreakerTransition records a circuit breaker state change
+func (UpstreamMetrics) ObserveBreakerTransition(route provider.Route, from, to provider.BreakerState) {
+	upstreamBreakerState.WithLabelValues(route.Provider, route.Model).Set(float64(to))
+	upstreamBreakerTransitions.WithLabelValues(route.Provider, route.Model, from.String(), to.String()).Inc()
+}
+
+// ConcurrencyMetrics records the concurrency limiter's in-flight and queued requests in Prometheus
+type ConcurrencyMetrics struct{}
+
+// ObserveInFlight records a change in the requests in flight
+func (ConcurrencyMetrics) ObserveInFlight(tier string, delta int) {
+	concurrentRequestsInFlight.WithLabelValues(tierLabel(tier)).Add(float64(delta))
+}
+
+// ObserveQueued records a change in the requests waiting for a slot
+func (ConcurrencyMetrics) ObserveQueued(tier string, delta int) {
+	concurrentRequestsQueued.WithLabelValues(tierLabel(tier)).Add(float64(delta))
+}
+
+// tierLabel names callers without a rate limit tier
+func tierLabel(tier string) string {
+	if tier == "" {
+		return "default"
+	}
+	return tier
+}
+
 // RegisterPrometheusHandler registers the Prometheus metrics endpoint
 func RegisterPrometheusHandler(e *echo.Echo) {
 	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
@@ -0,0 +1,67 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"go-api/internal/apierror"
+	"go-api/internal/keys"
+	"go-api/internal/middleware"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PrometheusMiddleware", func() {
+	It("labels per-key metrics with the key ID rather than the token", func() {
+		store, err := keys.NewStoreFromKeys()
+		Expect(err).NotTo(HaveOccurred())
+		key, secret, err := store.Create(keys.Key{})
+		Expect(err).NotTo(HaveOccurred())
+
+		e := echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		e.Use(middleware.PrometheusMiddleware())
+		middleware.RegisterPrometheusHandler(e)
+		e.GET("/v1/usage", func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		}, middleware.APIKeyAuth(store, nil))
+
+		for _, token := range []string{secret, "not-a-key"} {
+			req := httptest.NewRequest(http.MethodGet, "/v1/usage", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			e.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(rec.Body.String()).To(ContainSubstring(`api_key_requests_total{api_key="` + key.ID + `"} 1`))
+		Expect(rec.Body.String()).NotTo(ContainSubstring(secret[:4] + "..." + secret[len(secret)-4:]))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("not-...-key"))
+	})
+
+	It("counts rejected requests with the status they are answered with", func() {
+		store, err := keys.NewStoreFromKeys()
+		Expect(err).NotTo(HaveOccurred())
+
+		e := echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		e.Use(middleware.PrometheusMiddleware())
+		middleware.RegisterPrometheusHandler(e)
+		e.GET("/v1/rejected", func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		}, middleware.APIKeyAuth(store, nil))
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/rejected", nil)
+		req.Header.Set("Authorization", "Bearer not-a-key")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusUnauthorized))
+
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(rec.Body.String()).To(ContainSubstring(`http_requests_total{method="GET",path="/v1/rejected",status="401"} 1`))
+		Expect(rec.Body.String()).NotTo(ContainSubstring(`path="/v1/rejected",status="200"`))
+	})
+})
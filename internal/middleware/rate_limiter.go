@@ -1,13 +1,18 @@
 package middleware
 
 import (
+	"context"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
-	"go-api/internal/types"
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/ratelimit"
+	"go-api/internal/tracing"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -16,10 +21,10 @@ import (
 
 const (
 	// DefaultRequestsPerSecond is the default number of requests allowed per second per API key
-	DefaultRequestsPerSecond = 10
+	DefaultRequestsPerSecond = ratelimit.DefaultRequestsPerSecond
 
 	// DefaultBurst is the default maximum burst size allowed
-	DefaultBurst = 15
+	DefaultBurst = ratelimit.DefaultBurst
 
 	// DefaultExpirationTime is the default duration to keep rate limiters in memory
 	DefaultExpirationTime = 30 * time.Minute
@@ -33,12 +38,20 @@ type RateLimiterConfig struct {
 	// Skipper defines a function to skip middleware.
 	Skipper middleware.Skipper
 
+	// Policy holds the default, tier and model limits. When nil, every caller
+	// gets RequestsPerSecond and Burst.
+	Policy *ratelimit.Policy
+
 	// RequestsPerSecond is the rate limit per API key
 	RequestsPerSecond rate.Limit
 
 	// Burst is the maximum burst size allowed
 	Burst int
 
+	// Backend holds the rate limiters, so that replicas can share them. When
+	// nil they are kept in memory, in Limiters.
+	Backend ratelimit.Backend
+
 	// ExpirationTime is how long to keep rate limiters in memory
 	ExpirationTime time.Duration
 
@@ -48,35 +61,57 @@ type RateLimiterConfig struct {
 	// Limiters is a map of API keys to rate limiters
 	Limiters map[string]*rateLimiterEntry
 
-	// CleanupTicker for removing expired rate limiters
+	// CleanupTicker for removing expired rate limiters. It is started along
+	// with the first limiter kept in memory, so middleware that never limits
+	// anyone in memory runs no cleanup goroutine.
 	CleanupTicker *time.Ticker
+
+	// cleanupOnce starts CleanupTicker
+	cleanupOnce sync.Once
 }
 
-// rateLimiterEntry represents a rate limiter with its last access time
+// rateLimiterEntry represents a rate limiter with its last access time. Its
+// mutex guards both, so a request sees the limiter's state and limits as it
+// left them.
 type rateLimiterEntry struct {
+	mu       sync.Mutex
 	limiter  *rate.Limiter
 	lastSeen time.Time
 }
 
-// DefaultRateLimiter returns a middleware that limits requests based on API key
-// Each API key is allowed DefaultRequestsPerSecond requests per second with a burst of DefaultBurst
+// DefaultRateLimiter returns a middleware that limits requests per caller.
+// Each caller is allowed DefaultRequestsPerSecond requests per second with a burst of DefaultBurst,
+// unless its quota says otherwise
+//
+// It limits the identity APIKeyAuth authenticated the request as, so it must
+// come after APIKeyAuth in the chain. Requests without one are passed through.
 func DefaultRateLimiter() echo.MiddlewareFunc {
-	// Initialize config with default values
-	config := &RateLimiterConfig{
-		Skipper:           middleware.DefaultSkipper,
-		RequestsPerSecond: rate.Limit(DefaultRequestsPerSecond),
-		Burst:             DefaultBurst,
-		ExpirationTime:    DefaultExpirationTime,
-		Limiters:          make(map[string]*rateLimiterEntry),
-	}
+	return RateLimiterWithConfig(&RateLimiterConfig{})
+}
 
-	// Start cleanup goroutine
-	config.CleanupTicker = time.NewTicker(CleanupInterval)
-	go func() {
-		for range config.CleanupTicker.C {
-			config.cleanup()
-		}
-	}()
+// RateLimiterWithConfig returns a rate limiter middleware with config.
+// Fields left zero get the same defaults as DefaultRateLimiter.
+func RateLimiterWithConfig(config *RateLimiterConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.RequestsPerSecond == 0 {
+		config.RequestsPerSecond = rate.Limit(DefaultRequestsPerSecond)
+	}
+	if config.Burst == 0 {
+		config.Burst = DefaultBurst
+	}
+	if config.ExpirationTime == 0 {
+		config.ExpirationTime = DefaultExpirationTime
+	}
+	if config.Policy == nil {
+		config.Policy = ratelimit.NewPolicy(&ratelimit.Config{
+			Default: ratelimit.Rate{PerSecond: float64(config.RequestsPerSecond), Burst: config.Burst},
+		})
+	}
+	if config.Limiters == nil {
+		config.Limiters = make(map[string]*rateLimiterEntry)
+	}
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -84,72 +119,152 @@ func DefaultRateLimiter() echo.MiddlewareFunc {
 				return next(c)
 			}
 
-			// Extract API key from Authorization header
-			apiKey := extractAPIKey(c)
-			if apiKey == "" {
-				// If there's no API key, the auth middleware will handle it
-				// Just pass through for now
+			caller, ok := identity.FromContext(c)
+			if !ok {
+				// Nothing authenticated the request, so there is no one to limit
 				return next(c)
 			}
 
-			// Get or create rate limiter for this API key
-			limiter := config.getLimiter(apiKey)
-
 			// Check if request allowed
-			if !limiter.Allow() {
+			id, limit := config.limitsFor(c, caller)
+			ctx, span := tracing.Start(c.Request().Context(), "rate_limit")
+			decision, err := config.allow(ctx, id, limit)
+			if err != nil {
+				// An unreachable backend shouldn't take the API down with it
+				log.Printf("Rate limiter unavailable, allowing request: %v", err)
+				span.RecordError(err)
+				span.End()
+				return next(c)
+			}
+			span.SetAttributes(
+				tracing.RateLimitAllowedKey.Bool(decision.Allowed),
+				tracing.RateLimitLimitKey.Int(limit.Burst),
+				tracing.RateLimitRemainingKey.Int(decision.Remaining),
+			)
+			span.End()
+			// Add rate limit headers, to rejected requests too
+			setRateLimitHeaders(c, limit, decision)
+			if !decision.Allowed {
 				// Return custom rate limit error response
-				return c.JSON(http.StatusTooManyRequests, types.ErrorResponse{
-					Error: struct {
-						Message string      `json:"message"`
-						Type    string      `json:"type"`
-						Param   string      `json:"param,omitempty"`
-						Code    interface{} `json:"code,omitempty"`
-					}{
-						Message: "Rate limit exceeded for your API key. Please try again later.",
-						Type:    "rate_limit_error",
-						Code:    http.StatusTooManyRequests,
-					},
-				})
+				return apierror.RateLimited("Rate limit exceeded for your API key. Please try again later.").
+					WithHeader("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
 			}
 
-			// Add rate limit headers
-			limit := strconv.FormatFloat(float64(config.RequestsPerSecond), 'f', 2, 64)
-			remaining := strconv.Itoa(config.Burst - int(limiter.Tokens()))
-			reset := strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10)
+			return next(c)
+		}
+	}
+}
 
-			c.Response().Header().Set("X-RateLimit-Limit", limit)
-			c.Response().Header().Set("X-RateLimit-Remaining", remaining)
-			c.Response().Header().Set("X-RateLimit-Reset", reset)
+// limitsFor returns the limiter ID and limits for a request made by caller.
+// Callers are limited by key ID, so a rotated key or a refreshed JWT keeps
+// its limiter, with the limits of their tier overridden by their quota.
+// Requests for a model with a multiplier use a limiter of their own with
+// scaled limits.
+//
+// Limits are worked out on every request, so changes to the config and to
+// quotas apply to existing limiters straight away.
+func (config *RateLimiterConfig) limitsFor(c echo.Context, caller *identity.Identity) (string, ratelimit.Rate) {
+	policy := config.Policy.Config()
+
+	id, limit := caller.KeyID, policy.Tier(caller.RateLimitTier)
+	if caller.RequestsPerSecond > 0 {
+		limit.PerSecond = caller.RequestsPerSecond
+	}
+	if caller.Burst > 0 {
+		limit.Burst = caller.Burst
+	}
 
-			return next(c)
+	// Only chat requests name a model. A body that doesn't decode is left for
+	// the handler to reject.
+	if len(policy.Models) > 0 && c.Request().Method == http.MethodPost {
+		if req, err := chatRequest(c); err == nil && req.Model != "" {
+			if match, multiplier := policy.Multiplier(req.Model); match != "" {
+				id, limit = id+":"+match, limit.Scale(multiplier)
+			}
 		}
 	}
+	return id, limit
+}
+
+// allow takes a request from the limiter of id, in the backend or in memory
+func (config *RateLimiterConfig) allow(ctx context.Context, id string, limits ratelimit.Rate) (ratelimit.Decision, error) {
+	if config.Backend != nil {
+		return config.Backend.Allow(ctx, id, limits)
+	}
+	return config.getLimiter(id, limits).take(limits, time.Now()), nil
 }
 
 // getLimiter gets or creates a rate limiter for the given API key
-func (config *RateLimiterConfig) getLimiter(apiKey string) *rate.Limiter {
+func (config *RateLimiterConfig) getLimiter(apiKey string, limits ratelimit.Rate) *rateLimiterEntry {
 	config.LimitersMutex.RLock()
 	entry, exists := config.Limiters[apiKey]
 	config.LimitersMutex.RUnlock()
-
 	if exists {
-		// Update last seen time
-		entry.lastSeen = time.Now()
-		return entry.limiter
+		return entry
 	}
 
-	// Create new limiter
-	limiter := rate.NewLimiter(config.RequestsPerSecond, config.Burst)
-
-	// Store in map
 	config.LimitersMutex.Lock()
-	config.Limiters[apiKey] = &rateLimiterEntry{
-		limiter:  limiter,
+	defer config.LimitersMutex.Unlock()
+
+	// Another request may have created it in the meantime
+	if entry, exists := config.Limiters[apiKey]; exists {
+		return entry
+	}
+	entry = &rateLimiterEntry{
+		limiter:  rate.NewLimiter(rate.Limit(limits.PerSecond), limits.Burst),
 		lastSeen: time.Now(),
 	}
-	config.LimitersMutex.Unlock()
+	config.Limiters[apiKey] = entry
+	config.cleanupOnce.Do(config.startCleanup)
+	return entry
+}
+
+// startCleanup starts the goroutine removing expired rate limiters
+func (config *RateLimiterConfig) startCleanup() {
+	config.CleanupTicker = time.NewTicker(CleanupInterval)
+	go func() {
+		for range config.CleanupTicker.C {
+			config.cleanup()
+		}
+	}()
+}
+
+// take reserves a request from the limiter at now, applying limits first so
+// that changed quotas and tiers take effect. A request that would have to
+// wait is rejected and its reservation cancelled, so it uses nothing.
+func (entry *rateLimiterEntry) take(limits ratelimit.Rate, now time.Time) ratelimit.Decision {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	entry.lastSeen = now
+	limit := rate.Limit(limits.PerSecond)
+	if entry.limiter.Limit() != limit {
+		entry.limiter.SetLimitAt(now, limit)
+	}
+	if entry.limiter.Burst() != limits.Burst {
+		entry.limiter.SetBurstAt(now, limits.Burst)
+	}
+
+	var decision ratelimit.Decision
+	reservation := entry.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		decision.RetryAfter = delay
+	} else {
+		decision.Allowed = true
+	}
+
+	tokens := entry.limiter.TokensAt(now)
+	decision.Remaining = max(0, int(tokens))
+	decision.Reset = time.Duration((float64(limits.Burst) - tokens) / limits.PerSecond * float64(time.Second))
+	return decision
+}
 
-	return limiter
+// idleSince reports whether the limiter has been unused since cutoff
+func (entry *rateLimiterEntry) idleSince(cutoff time.Time) bool {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	return entry.lastSeen.Before(cutoff)
 }
 
 // cleanup removes expired rate limiters
@@ -160,23 +275,23 @@ func (config *RateLimiterConfig) cleanup() {
 	defer config.LimitersMutex.Unlock()
 
 	for apiKey, entry := range config.Limiters {
-		if entry.lastSeen.Before(cutoff) {
+		if entry.idleSince(cutoff) {
 			delete(config.Limiters, apiKey)
 		}
 	}
 }
 
-// extractAPIKey extracts the API key from the Authorization header
-func extractAPIKey(c echo.Context) string {
-	auth := c.Request().Header.Get("Authorization")
-	if auth == "" {
-		return ""
-	}
-
-	parts := strings.Split(auth, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		return ""
-	}
+// setRateLimitHeaders reports the limit, the requests left and the Unix time
+// at which the limiter is full again
+func setRateLimitHeaders(c echo.Context, limit ratelimit.Rate, decision ratelimit.Decision) {
+	reset := time.Now().Add(decision.Reset)
+	header := c.Response().Header()
+	header.Set("X-RateLimit-Limit", strconv.FormatFloat(limit.PerSecond, 'f', -1, 64))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Add(time.Second-1).Unix(), 10))
+}
 
-	return parts[1]
+// ceilSeconds rounds d up to whole seconds, and to at least one, for Retry-After
+func ceilSeconds(d time.Duration) int {
+	return int(max(1, math.Ceil(d.Seconds())))
 }
@@ -0,0 +1,399 @@
+package middleware_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-api/internal/apierror"
+	"go-api/internal/keys"
+	"go-api/internal/middleware"
+	"go-api/internal/oidc"
+	"go-api/internal/ratelimit"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DefaultRateLimiter", func() {
+	var (
+		e      *echo.Echo
+		store  *keys.Store
+		key    keys.Key
+		secret string
+	)
+
+	BeforeEach(func() {
+		var err error
+		store, err = keys.NewStoreFromKeys()
+		Expect(err).NotTo(HaveOccurred())
+		key, secret, err = store.Create(keys.Key{Quota: keys.Quota{RequestsPerSecond: 0.001, Burst: 2}})
+		Expect(err).NotTo(HaveOccurred())
+
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		e.Use(middleware.APIKeyAuth(store, nil), middleware.DefaultRateLimiter())
+		e.GET("/", func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		})
+	})
+
+	// send sends a request with key as the Bearer token
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// get sends a request with key as the Bearer token and returns its status
+	get := func(key string) int {
+		return send(key).Code
+	}
+
+	It("applies the key's quota", func() {
+		Expect(get(secret)).To(Equal(http.StatusNoContent))
+		Expect(get(secret)).To(Equal(http.StatusNoContent))
+		Expect(get(secret)).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("reports the limiter's state in headers", func() {
+		rec := send(secret)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get("X-RateLimit-Limit")).To(Equal("0.001"))
+		Expect(rec.Header().Get("X-RateLimit-Remaining")).To(Equal("1"))
+		reset, err := strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reset).To(BeNumerically("~", time.Now().Add(1000*time.Second).Unix(), 2))
+
+		rec = send(secret)
+		Expect(rec.Header().Get("X-RateLimit-Remaining")).To(Equal("0"))
+		reset, err = strconv.ParseInt(rec.Header().Get("X-RateLimit-Reset"), 10, 64)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reset).To(BeNumerically("~", time.Now().Add(2000*time.Second).Unix(), 2))
+	})
+
+	It("sends headers and Retry-After when it rejects a request", func() {
+		send(secret)
+		send(secret)
+
+		rec := send(secret)
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("X-RateLimit-Limit")).To(Equal("0.001"))
+		Expect(rec.Header().Get("X-RateLimit-Remaining")).To(Equal("0"))
+		Expect(rec.Header().Get("X-RateLimit-Reset")).NotTo(BeEmpty())
+		retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retryAfter).To(BeNumerically("~", 1000, 1))
+
+		// Rejected requests use nothing, so the wait doesn't grow
+		rec = send(secret)
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(strconv.Atoi(rec.Header().Get("Retry-After"))).To(BeNumerically("~", 1000, 1))
+	})
+
+	It("is safe for concurrent use", func() {
+		var (
+			wg      sync.WaitGroup
+			allowed atomic.Int32
+		)
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				if get(secret) == http.StatusNoContent {
+					allowed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		Expect(allowed.Load()).To(Equal(int32(2)))
+	})
+
+	It("applies quota changes to existing limiters", func() {
+		Expect(get(secret)).To(Equal(http.StatusNoContent))
+		Expect(get(secret)).To(Equal(http.StatusNoContent))
+		Expect(get(secret)).To(Equal(http.StatusTooManyRequests))
+
+		_, err := store.Update(key.ID, func(k *keys.Key) error {
+			k.Quota = keys.Quota{RequestsPerSecond: 1000, Burst: 5}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() int { return get(secret) }).Should(Equal(http.StatusNoContent))
+	})
+
+	It("keeps limiting a key after it is rotated", func() {
+		Expect(get(secret)).To(Equal(http.StatusNoContent))
+		Expect(get(secret)).To(Equal(http.StatusNoContent))
+
+		_, rotated, err := store.Rotate(key.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(get(rotated)).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("starts its cleanup ticker with the first limiter, and only once", func() {
+		config := &middleware.RateLimiterConfig{}
+		e := echo.New()
+		e.Use(middleware.APIKeyAuth(store, nil), middleware.RateLimiterWithConfig(config))
+		e.GET("/", func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		})
+		Expect(config.CleanupTicker).To(BeNil())
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		ticker := config.CleanupTicker
+		Expect(ticker).NotTo(BeNil())
+		DeferCleanup(ticker.Stop)
+
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		Expect(config.CleanupTicker).To(BeIdenticalTo(ticker))
+	})
+
+	Context("with a Redis backend", func() {
+		var server *miniredis.Miniredis
+
+		// replica creates a server limiting requests through the Redis server
+		replica := func() *echo.Echo {
+			backend, err := ratelimit.OpenRedisBackend("redis://" + server.Addr())
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(backend.Close)
+
+			e := echo.New()
+			e.HTTPErrorHandler = apierror.HTTPErrorHandler
+			e.Use(middleware.APIKeyAuth(store, nil), middleware.RateLimiterWithConfig(&middleware.RateLimiterConfig{Backend: backend}))
+			e.GET("/", func(c echo.Context) error {
+				return c.NoContent(http.StatusNoContent)
+			})
+			return e
+		}
+
+		BeforeEach(func() {
+			server = miniredis.NewMiniRedis()
+			Expect(server.Start()).To(Succeed())
+			DeferCleanup(server.Close)
+			e = replica()
+		})
+
+		It("shares the key's quota between replicas", func() {
+			other := replica()
+			Expect(get(secret)).To(Equal(http.StatusNoContent))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+secret)
+			rec := httptest.NewRecorder()
+			other.ServeHTTP(rec, req)
+			Expect(rec.Code).To(Equal(http.StatusNoContent))
+			Expect(rec.Header().Get("X-RateLimit-Remaining")).To(Equal("0"))
+
+			Expect(get(secret)).To(Equal(http.StatusTooManyRequests))
+		})
+
+		It("never stores unknown tokens in Redis", func() {
+			Expect(get("not-a-key")).To(Equal(http.StatusUnauthorized))
+			Expect(server.Keys()).To(BeEmpty())
+		})
+
+		It("allows requests while Redis is unreachable", func() {
+			server.Close()
+			Expect(get(secret)).To(Equal(http.StatusNoContent))
+			Expect(get(secret)).To(Equal(http.StatusNoContent))
+			Expect(get(secret)).To(Equal(http.StatusNoContent))
+		})
+	})
+
+	Context("with a rate limit policy", func() {
+		var (
+			path   string
+			policy *ratelimit.Policy
+		)
+
+		// writePolicy writes the config file and reloads the policy from it
+		writePolicy := func(content string) {
+			Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+			later := time.Now().Add(time.Second)
+			Expect(os.Chtimes(path, later, later)).To(Succeed())
+			if policy != nil {
+				Expect(policy.Reload()).To(Succeed())
+			}
+		}
+
+		// post sends a chat request for model with key as the Bearer token
+		post := func(key, model string) int {
+			body := `{"model": "` + model + `", "messages": [{"role": "user", "content": "Hi"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+key)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		// createKey adds a key to the store and returns its secret
+		createKey := func(template keys.Key) string {
+			_, secret, err := store.Create(template)
+			Expect(err).NotTo(HaveOccurred())
+			return secret
+		}
+
+		BeforeEach(func() {
+			path = filepath.Join(GinkgoT().TempDir(), "rate-limits.yaml")
+			policy = nil
+			writePolicy(`
+default:
+  requests_per_second: 0.001
+  burst: 1
+tiers:
+  team:
+    requests_per_second: 0.001
+    burst: 3
+models:
+  gemma*: 2
+`)
+			var err error
+			policy, err = ratelimit.LoadPolicy(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			e = echo.New()
+			e.HTTPErrorHandler = apierror.HTTPErrorHandler
+			e.Use(middleware.APIKeyAuth(store, nil), middleware.RateLimiterWithConfig(&middleware.RateLimiterConfig{Policy: policy}))
+			e.GET("/", func(c echo.Context) error {
+				return c.NoContent(http.StatusNoContent)
+			})
+			e.POST("/", func(c echo.Context) error {
+				return c.NoContent(http.StatusNoContent)
+			})
+		})
+
+		It("applies the default limits to keys without a tier", func() {
+			plain := createKey(keys.Key{})
+			Expect(get(plain)).To(Equal(http.StatusNoContent))
+			Expect(get(plain)).To(Equal(http.StatusTooManyRequests))
+		})
+
+		It("applies the limits of the key's tier", func() {
+			team := createKey(keys.Key{RateLimitTier: "team"})
+			for range 3 {
+				Expect(get(team)).To(Equal(http.StatusNoContent))
+			}
+			Expect(get(team)).To(Equal(http.StatusTooManyRequests))
+
+			// Unknown tiers get the default limits
+			other := createKey(keys.Key{RateLimitTier: "enterprise"})
+			Expect(get(other)).To(Equal(http.StatusNoContent))
+			Expect(get(other)).To(Equal(http.StatusTooManyRequests))
+		})
+
+		It("lets the key's quota override its tier", func() {
+			// The key created by the outer BeforeEach has a burst of 2
+			Expect(get(secret)).To(Equal(http.StatusNoContent))
+			Expect(get(secret)).To(Equal(http.StatusNoContent))
+			Expect(get(secret)).To(Equal(http.StatusTooManyRequests))
+		})
+
+		It("gives scaled models a limiter of their own", func() {
+			team := createKey(keys.Key{RateLimitTier: "team"})
+			for range 6 {
+				Expect(post(team, "gemma-7b-it")).To(Equal(http.StatusNoContent))
+			}
+			Expect(post(team, "gemma-7b-it")).To(Equal(http.StatusTooManyRequests))
+
+			// Other models still have the key's own limiter
+			Expect(post(team, "llama-3.3-70b-versatile")).To(Equal(http.StatusNoContent))
+		})
+
+		Context("and JWT callers", func() {
+			var signingKey *rsa.PrivateKey
+
+			BeforeEach(func() {
+				var err error
+				signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+				Expect(err).NotTo(HaveOccurred())
+
+				jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+					"kty": "RSA",
+					"kid": "idp-1",
+					"n":   base64.RawURLEncoding.EncodeToString(signingKey.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(signingKey.E)).Bytes()),
+				}}})
+				Expect(err).NotTo(HaveOccurred())
+				jwksPath := filepath.Join(GinkgoT().TempDir(), "jwks.json")
+				Expect(os.WriteFile(jwksPath, jwks, 0o600)).To(Succeed())
+				verifier, err := oidc.NewVerifier(oidc.Config{Issuer: "https://id.example.com", Audience: "scarlett-api", JWKS: jwksPath})
+				Expect(err).NotTo(HaveOccurred())
+
+				e = echo.New()
+				e.HTTPErrorHandler = apierror.HTTPErrorHandler
+				e.Use(middleware.APIKeyAuth(store, verifier), middleware.RateLimiterWithConfig(&middleware.RateLimiterConfig{Policy: policy}))
+				e.GET("/", func(c echo.Context) error {
+					return c.NoContent(http.StatusNoContent)
+				})
+			})
+
+			// token signs a token for subject in tier, expiring at exp
+			token := func(subject, tier string, exp time.Time) string {
+				t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+					"iss": "https://id.example.com", "aud": "scarlett-api", "sub": subject,
+					"tier": tier, "exp": exp.Unix(),
+				})
+				t.Header["kid"] = "idp-1"
+				signed, err := t.SignedString(signingKey)
+				Expect(err).NotTo(HaveOccurred())
+				return signed
+			}
+
+			It("applies the limits of the tier claim", func() {
+				team := token("svc-search", "team", time.Now().Add(time.Hour))
+				for range 3 {
+					Expect(get(team)).To(Equal(http.StatusNoContent))
+				}
+				Expect(get(team)).To(Equal(http.StatusTooManyRequests))
+
+				other := token("svc-index", "", time.Now().Add(time.Hour))
+				Expect(get(other)).To(Equal(http.StatusNoContent))
+				Expect(get(other)).To(Equal(http.StatusTooManyRequests))
+			})
+
+			It("keeps limiting a caller whose token is refreshed", func() {
+				Expect(get(token("svc-search", "team", time.Now().Add(time.Hour)))).To(Equal(http.StatusNoContent))
+				Expect(get(token("svc-search", "team", time.Now().Add(2*time.Hour)))).To(Equal(http.StatusNoContent))
+				Expect(get(token("svc-search", "team", time.Now().Add(3*time.Hour)))).To(Equal(http.StatusNoContent))
+				Expect(get(token("svc-search", "team", time.Now().Add(4*time.Hour)))).To(Equal(http.StatusTooManyRequests))
+			})
+		})
+
+		It("updates existing limiters when the config reloads", func() {
+			team := createKey(keys.Key{RateLimitTier: "team"})
+			for range 3 {
+				Expect(get(team)).To(Equal(http.StatusNoContent))
+			}
+			Expect(get(team)).To(Equal(http.StatusTooManyRequests))
+
+			writePolicy(`
+tiers:
+  team:
+    requests_per_second: 1000
+    burst: 5
+`)
+			Eventually(func() int { return get(team) }).Should(Equal(http.StatusNoContent))
+		})
+	})
+})
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"go-api/internal/requestid"
+
+	"github.com/labstack/echo/v4"
+	echomw "github.com/labstack/echo/v4/middleware"
+)
+
+// AccessLogFormat is the access log format: Echo's default fields, with the
+// request ID as request_id and the ID the upstream gave the request beside it
+const AccessLogFormat = `{"time":"${time_rfc3339_nano}","request_id":"${id}","upstream_request_id":${custom},` +
+	`"remote_ip":"${remote_ip}","host":"${host}","method":"${method}","uri":"${uri}","user_agent":"${user_agent}",` +
+	`"status":${status},"error":"${error}","latency":${latency},"latency_human":"${latency_human}",` +
+	`"bytes_in":${bytes_in},"bytes_out":${bytes_out}}` + "\n"
+
+// RequestID middleware gives every request an ID: the client's X-Request-ID
+// if it sent a usable one, or a new one. The ID is sent back in the response,
+// forwarded to the upstream, and included in errors, logs and audit records.
+// It must run before every other middleware.
+func RequestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(requestid.Header)
+			if !requestid.Valid(id) {
+				id = requestid.New()
+			}
+			requestid.Set(c, id)
+			return next(c)
+		}
+	}
+}
+
+// AccessLogger middleware logs a line for every request in AccessLogFormat.
+// It must run after RequestID, so that the line carries the final ID.
+func AccessLogger() echo.MiddlewareFunc {
+	return echomw.LoggerWithConfig(echomw.LoggerConfig{
+		Format: AccessLogFormat,
+		CustomTagFunc: func(c echo.Context, buf *bytes.Buffer) (int, error) {
+			// Upstreams choose their IDs, so they are quoted as JSON
+			quoted, _ := json.Marshal(c.Response().Header().Get(requestid.UpstreamHeader))
+			return buf.Write(quoted)
+		},
+	})
+}
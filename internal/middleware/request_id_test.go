@@ -0,0 +1,80 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"go-api/internal/apierror"
+	"go-api/internal/middleware"
+	"go-api/internal/requestid"
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequestID", func() {
+	var (
+		e    *echo.Echo
+		seen string
+	)
+
+	BeforeEach(func() {
+		seen = ""
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		e.Use(middleware.RequestID())
+		e.GET("/ok", func(c echo.Context) error {
+			seen = requestid.FromContext(c.Request().Context())
+			return c.NoContent(http.StatusNoContent)
+		})
+		e.GET("/fail", func(c echo.Context) error {
+			return apierror.RateLimited("Too many requests")
+		})
+	})
+
+	send := func(path, id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if id != "" {
+			req.Header.Set(requestid.Header, id)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("keeps the client's ID", func() {
+		rec := send("/ok", "client-trace-1")
+
+		Expect(rec.Header().Get(requestid.Header)).To(Equal("client-trace-1"))
+		Expect(seen).To(Equal("client-trace-1"))
+	})
+
+	It("generates an ID when the client sent none", func() {
+		rec := send("/ok", "")
+
+		Expect(rec.Header().Get(requestid.Header)).To(HavePrefix(requestid.Prefix))
+		Expect(seen).To(Equal(rec.Header().Get(requestid.Header)))
+	})
+
+	It("replaces an ID that isn't safe to log or forward", func() {
+		rec := send("/ok", `bad"id`)
+
+		Expect(rec.Header().Get(requestid.Header)).To(HavePrefix(requestid.Prefix))
+	})
+
+	It("logs the request and upstream IDs in the access log", func() {
+		Expect(middleware.AccessLogFormat).To(ContainSubstring(`"request_id":"${id}"`))
+		Expect(middleware.AccessLogFormat).To(ContainSubstring(`"upstream_request_id":${custom}`))
+	})
+
+	It("includes the ID in error responses", func() {
+		rec := send("/fail", "client-trace-2")
+
+		var body types.ErrorResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &body)).To(Succeed())
+		Expect(body.RequestID).To(Equal("client-trace-2"))
+	})
+})
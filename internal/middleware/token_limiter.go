@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/ratelimit"
+	"go-api/internal/tracing"
+	"go-api/internal/types"
+	"go-api/internal/usage"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultCompletionTokens is how many completion tokens are reserved for a
+// request that doesn't set max_tokens, until its actual usage is known
+const DefaultCompletionTokens = 1024
+
+// Token rate limit headers, as OpenAI sends them
+const (
+	HeaderLimitTokens     = "x-ratelimit-limit-tokens"
+	HeaderRemainingTokens = "x-ratelimit-remaining-tokens"
+	HeaderResetTokens     = "x-ratelimit-reset-tokens"
+)
+
+// TokenRateLimiter middleware limits the tokens each caller may use per minute
+// and per day. It must run after APIKeyAuth.
+//
+// Before the request is sent upstream, its prompt and max_tokens are estimated
+// and reserved from the caller's budgets; once the handler has recorded the
+// actual usage, the difference is returned to or taken from the budgets.
+// Callers whose identity sets no budget get defaults, and zero defaults are unlimited.
+func TokenRateLimiter(limiter *ratelimit.TokenLimiter, defaults ratelimit.Limits) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id, ok := identity.FromContext(c)
+			if !ok {
+				return next(c)
+			}
+
+			limits := defaults
+			if id.TokensPerMinute > 0 {
+				limits.TokensPerMinute = id.TokensPerMinute
+			}
+			if id.TokensPerDay > 0 {
+				limits.TokensPerDay = id.TokensPerDay
+			}
+			if limits.IsZero() {
+				return next(c)
+			}
+
+			// A body that doesn't decode is left for the handler to reject
+			req, err := chatRequest(c)
+			if err != nil {
+				return next(c)
+			}
+
+			estimate := EstimateTokens(req)
+			_, span := tracing.Start(c.Request().Context(), "token_rate_limit")
+			result := limiter.Reserve(id.KeyID, limits, estimate)
+			span.SetAttributes(
+				tracing.RateLimitAllowedKey.Bool(result.Allowed),
+				tracing.RateLimitLimitKey.Int64(result.Limit),
+				tracing.RateLimitRemainingKey.Int64(result.Remaining),
+				tracing.RateLimitRequestedKey.Int64(estimate),
+			)
+			span.End()
+			setTokenHeaders(c, result)
+
+			if !result.Allowed {
+				if result.RetryAfter < 0 {
+					return apierror.RateLimited(fmt.Sprintf("Request too large: it may use up to %d tokens, more than the token rate limit of this API key allows. Reduce the prompt or max_tokens.", estimate))
+				}
+				return apierror.RateLimited("Token rate limit exceeded for your API key. Please try again later.").
+					WithHeader("Retry-After", strconv.Itoa(int((result.RetryAfter+time.Second-1)/time.Second)))
+			}
+
+			err = next(c)
+
+			// Reconcile the reservation with what the completion really used.
+			// Requests that never reached a model used nothing.
+			used := int64(0)
+			if u, ok := usage.FromContext(c); ok {
+				used = int64(u.TotalTokens)
+			}
+			limiter.Adjust(id.KeyID, limits, used-estimate)
+
+			return err
+		}
+	}
+}
+
+// EstimateTokens returns how many tokens req may use: its estimated prompt
+// plus the completion tokens it allows for each choice
+func EstimateTokens(req *types.ChatRequest) int64 {
+	return int64(usage.EstimatePrompt(req) + completionTokens(req))
+}
+
+// completionTokens returns how many completion tokens req allows across its choices
+func completionTokens(req *types.ChatRequest) int {
+	completion := req.MaxCompletionTokens
+	if completion == 0 {
+		completion = req.MaxTokens
+	}
+	if completion == 0 {
+		completion = DefaultCompletionTokens
+	}
+	return max(req.N, 1) * completion
+}
+
+// setTokenHeaders reports the caller's token budget
+func setTokenHeaders(c echo.Context, result ratelimit.Result) {
+	header := c.Response().Header()
+	header.Set(HeaderLimitTokens, strconv.FormatInt(result.Limit, 10))
+	header.Set(HeaderRemainingTokens, strconv.FormatInt(result.Remaining, 10))
+	header.Set(HeaderResetTokens, result.Reset.Round(time.Millisecond).String())
+}
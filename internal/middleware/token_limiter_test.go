@@ -0,0 +1,117 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/middleware"
+	"go-api/internal/ratelimit"
+	"go-api/internal/types"
+	"go-api/internal/usage"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TokenRateLimiter", func() {
+	const request = `{"model":"llama-3.1-8b-instant","messages":[{"role":"user","content":"hi"}],"max_tokens":1000}`
+
+	var (
+		e      *echo.Echo
+		caller *identity.Identity
+		used   int
+		served int
+	)
+
+	BeforeEach(func() {
+		caller = &identity.Identity{KeyID: "key_tokens"}
+		used = 100
+		served = 0
+
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		setIdentity := func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				identity.Set(c, caller)
+				return next(c)
+			}
+		}
+		e.POST("/chat/completions", func(c echo.Context) error {
+			served++
+			usage.Set(c, types.Usage{TotalTokens: used})
+			return c.NoContent(http.StatusNoContent)
+		}, setIdentity, middleware.TokenRateLimiter(ratelimit.NewTokenLimiter(), ratelimit.Limits{TokensPerMinute: 2500}))
+	})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	It("reports the budget left after reserving the estimate", func() {
+		rec := post(request)
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+
+		var req types.ChatRequest
+		Expect(json.Unmarshal([]byte(request), &req)).To(Succeed())
+		estimate := middleware.EstimateTokens(&req)
+		Expect(estimate).To(BeNumerically(">", 1000))
+
+		Expect(rec.Header().Get(middleware.HeaderLimitTokens)).To(Equal("2500"))
+		Expect(rec.Header().Get(middleware.HeaderRemainingTokens)).To(Equal(itoa(2500 - estimate)))
+		Expect(rec.Header().Get(middleware.HeaderResetTokens)).NotTo(BeEmpty())
+	})
+
+	It("charges actual usage rather than the estimate", func() {
+		// Each request reserves over 1000 tokens but uses only 100, so
+		// many more fit in the budget than the estimates alone would allow
+		for i := 0; i < 10; i++ {
+			Expect(post(request).Code).To(Equal(http.StatusNoContent))
+		}
+		Expect(served).To(Equal(10))
+	})
+
+	It("rejects requests once the budget is spent", func() {
+		used = 2000
+		Expect(post(request).Code).To(Equal(http.StatusNoContent))
+
+		rec := post(request)
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).NotTo(BeEmpty())
+		Expect(rec.Header().Get(middleware.HeaderRemainingTokens)).To(Equal("500"))
+		var errResp types.ErrorResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &errResp)).To(Succeed())
+		Expect(errResp.Error.Type).To(Equal(apierror.TypeRateLimit))
+		Expect(served).To(Equal(1))
+	})
+
+	It("rejects requests larger than the budget", func() {
+		rec := post(`{"model":"llama-3.1-8b-instant","messages":[],"max_tokens":32000}`)
+
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).To(BeEmpty())
+		Expect(rec.Body.String()).To(ContainSubstring("Request too large"))
+	})
+
+	It("uses the budget of the caller's key over the default", func() {
+		caller.TokensPerMinute = 100000
+		rec := post(`{"model":"llama-3.1-8b-instant","messages":[],"max_tokens":32000}`)
+
+		Expect(rec.Code).To(Equal(http.StatusNoContent))
+		Expect(rec.Header().Get(middleware.HeaderLimitTokens)).To(Equal("100000"))
+	})
+})
+
+// itoa formats n for comparison with a header
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
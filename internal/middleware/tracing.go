@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-api/internal/apierror"
+	"go-api/internal/identity"
+	"go-api/internal/requestid"
+	"go-api/internal/tracing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing middleware starts a server span for every request, continuing the
+// trace of the caller's traceparent header if it sent one. The spans of
+// later middleware, the handler and upstream calls are its children. It must
+// run after RequestID, so that the span carries the request ID.
+func Tracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := tracing.Propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			// Spans are named after the route, not the path, to keep their names few
+			route := c.Path()
+			name := req.Method
+			if route != "" {
+				name += " " + route
+			}
+			ctx, span := tracing.Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(req.URL.Path),
+					semconv.URLScheme(c.Scheme()),
+					semconv.UserAgentOriginal(req.UserAgent()),
+					semconv.ClientAddress(c.RealIP()),
+					tracing.RequestIDKey.String(requestid.FromEcho(c)),
+				),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+
+			// Errors returned here are only written later, by the error handler,
+			// unless the response was already under way
+			status := c.Response().Status
+			if err != nil {
+				if !c.Response().Committed {
+					status = apierror.From(err).Status
+				}
+				span.RecordError(err)
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			if id, ok := identity.FromContext(c); ok {
+				span.SetAttributes(tracing.KeyIDKey.String(id.KeyID))
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"go-api/internal/apierror"
+	"go-api/internal/keys"
+	"go-api/internal/middleware"
+	"go-api/internal/ratelimit"
+	"go-api/internal/requestid"
+	"go-api/internal/tracing"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var _ = Describe("Tracing", func() {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	var (
+		e        *echo.Echo
+		exporter *tracetest.InMemoryExporter
+		secret   string
+	)
+
+	BeforeEach(func() {
+		exporter = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+		DeferCleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+		var err error
+		secret, err = keys.Generate()
+		Expect(err).NotTo(HaveOccurred())
+		key, err := keys.NewHashedKey(secret)
+		Expect(err).NotTo(HaveOccurred())
+		store, err := keys.NewStoreFromKeys(key)
+		Expect(err).NotTo(HaveOccurred())
+
+		e = echo.New()
+		e.HTTPErrorHandler = apierror.HTTPErrorHandler
+		e.Use(middleware.RequestID())
+		e.Use(middleware.Tracing())
+		e.GET("/v1/models/:id", func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		}, middleware.APIKeyAuth(store, nil), middleware.RateLimiterWithConfig(&middleware.RateLimiterConfig{
+			Policy: ratelimit.NewPolicy(&ratelimit.Config{
+				Default: ratelimit.Rate{PerSecond: 1, Burst: 1},
+			}),
+		}))
+	})
+
+	send := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models/llama", nil)
+		req.Header.Set("traceparent", traceparent)
+		req.Header.Set(requestid.Header, "req_traced")
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// spans returns the ended spans by name
+	spans := func() map[string]tracetest.SpanStub {
+		byName := make(map[string]tracetest.SpanStub)
+		for _, span := range exporter.GetSpans() {
+			byName[span.Name] = span
+		}
+		return byName
+	}
+
+	attributes := func(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+		attrs := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes {
+			attrs[kv.Key] = kv.Value
+		}
+		return attrs
+	}
+
+	It("continues the caller's trace with a server span and spans for auth and rate limiting", func() {
+		Expect(send(secret).Code).To(Equal(http.StatusNoContent))
+
+		byName := spans()
+		Expect(byName).To(HaveKey("GET /v1/models/:id"))
+		server := byName["GET /v1/models/:id"]
+		Expect(server.SpanKind).To(Equal(trace.SpanKindServer))
+		Expect(server.SpanContext.TraceID().String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(server.Parent.SpanID().String()).To(Equal("00f067aa0ba902b7"))
+
+		attrs := attributes(server)
+		Expect(attrs["http.route"].AsString()).To(Equal("/v1/models/:id"))
+		Expect(attrs["http.response.status_code"].AsInt64()).To(Equal(int64(http.StatusNoContent)))
+		Expect(attrs[tracing.RequestIDKey].AsString()).To(Equal("req_traced"))
+		Expect(attrs).To(HaveKey(tracing.KeyIDKey))
+
+		for _, name := range []string{"auth", "rate_limit"} {
+			Expect(byName).To(HaveKey(name))
+			Expect(byName[name].Parent.SpanID()).To(Equal(server.SpanContext.SpanID()), name)
+		}
+		Expect(attributes(byName["rate_limit"])[tracing.RateLimitAllowedKey].AsBool()).To(BeTrue())
+	})
+
+	It("records rejected requests", func() {
+		send(secret)
+		exporter.Reset()
+
+		Expect(send(secret).Code).To(Equal(http.StatusTooManyRequests))
+		byName := spans()
+		Expect(attributes(byName["rate_limit"])[tracing.RateLimitAllowedKey].AsBool()).To(BeFalse())
+		Expect(attributes(byName["GET /v1/models/:id"])["http.response.status_code"].AsInt64()).To(Equal(int64(http.StatusTooManyRequests)))
+		Expect(byName["rate_limit"].Parent.SpanID()).To(Equal(byName["GET /v1/models/:id"].SpanContext.SpanID()))
+		Expect(byName).To(HaveKey("auth"))
+	})
+
+	It("records failed authentication", func() {
+		Expect(send("not-a-key").Code).To(Equal(http.StatusUnauthorized))
+
+		Expect(spans()["auth"].Status.Description).To(Equal("Invalid API key"))
+	})
+})
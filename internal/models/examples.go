@@ -25,6 +25,7 @@ type ChatRequestExample struct {
 
 // GetChatCompletionExample returns a concrete example for documentation
 func GetChatCompletionExample() types.ChatRequest {
+	temperature := 0.7
 	return types.ChatRequest{
 		Model: "deepseek-r1-distill-llama-70b",
 		Messages: []types.Message{
@@ -33,7 +34,7 @@ func GetChatCompletionExample() types.ChatRequest {
 				Content: "Hello, how are you?",
 			},
 		},
-		Temperature: 0.7,
+		Temperature: &temperature,
 		MaxTokens:   100,
 		Stream:      false,
 	}
@@ -0,0 +1,315 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRefreshInterval is how long a fetched key set is used before it is fetched again
+	DefaultRefreshInterval = time.Hour
+
+	// MinRefreshInterval limits how often an unknown key ID can trigger a fetch,
+	// so tokens with made-up key IDs can't hammer the identity provider
+	MinRefreshInterval = time.Minute
+
+	// DefaultFetchTimeout bounds a fetch of the key set from a URL
+	DefaultFetchTimeout = 10 * time.Second
+
+	// maxJWKSSize bounds the key set document read from a URL
+	maxJWKSSize = 1 << 20
+)
+
+// ErrUnknownKeyID is returned for a token signed with a key that isn't in the key set
+var ErrUnknownKeyID = errors.New("unknown signing key")
+
+// KeySetOptions tunes how a KeySet is fetched. Zero values use the defaults.
+type KeySetOptions struct {
+	// RefreshInterval is how long fetched keys are used before fetching them again
+	RefreshInterval time.Duration
+
+	// MinRefreshInterval is the least time between fetches caused by unknown key IDs
+	MinRefreshInterval time.Duration
+
+	// HTTPClient fetches key sets from URLs. Defaults to a client with a
+	// timeout of DefaultFetchTimeout.
+	HTTPClient *http.Client
+}
+
+// KeySet holds the public keys of a JWKS document read from a file or URL. It is
+// refreshed every RefreshInterval, and early when a token names a key it doesn't
+// have, so keys rotated by the identity provider are picked up without a restart.
+//
+// Only one fetch runs at a time, and the lock isn't held during it: tokens
+// signed with a key the set already holds are verified with it meanwhile, and
+// only tokens naming an unknown key wait for the fetch.
+type KeySet struct {
+	source  string
+	options KeySetOptions
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// fetching is closed when the fetch in flight finishes. Nil when there is none.
+	fetching chan struct{}
+}
+
+// NewKeySet creates a key set read from source, which is either an http(s) URL or a file path
+func NewKeySet(source string, options KeySetOptions) *KeySet {
+	if options.RefreshInterval <= 0 {
+		options.RefreshInterval = DefaultRefreshInterval
+	}
+	if options.MinRefreshInterval <= 0 {
+		options.MinRefreshInterval = MinRefreshInterval
+	}
+	if options.HTTPClient == nil {
+		options.HTTPClient = &http.Client{Timeout: DefaultFetchTimeout}
+	}
+	return &KeySet{source: source, options: options}
+}
+
+// Key returns the public key with the given key ID. If the token has no key
+// ID, the set's only key is used.
+func (s *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stale := time.Since(s.fetchedAt) > s.options.RefreshInterval
+	_, known := s.find(kid)
+	switch {
+	case s.fetching != nil:
+		if !known {
+			// The fetch in flight may bring the key
+			if err := s.wait(ctx, s.fetching); err != nil {
+				return nil, err
+			}
+		}
+	case stale || (!known && time.Since(s.fetchedAt) > s.options.MinRefreshInterval):
+		if err := s.refresh(ctx); err != nil {
+			// Keep using the keys we have rather than failing every request
+			// while the identity provider is unreachable
+			if s.keys == nil {
+				return nil, err
+			}
+			log.Printf("Failed to refresh JWKS from %s, keeping the previous keys: %v", s.source, err)
+		}
+	}
+
+	key, ok := s.find(kid)
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	return key, nil
+}
+
+// wait waits for the fetch in flight to finish, or for ctx to be done. It is
+// called with s.mu held, and releases it while waiting.
+func (s *KeySet) wait(ctx context.Context, fetching chan struct{}) error {
+	s.mu.Unlock()
+	defer s.mu.Lock()
+
+	select {
+	case <-fetching:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// find looks kid up in the current keys
+func (s *KeySet) find(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// refresh reads the key set document again. It is called with s.mu held, and
+// releases it during the fetch.
+func (s *KeySet) refresh(ctx context.Context) error {
+	// Counted as a fetch even if it fails, so a failing source isn't retried on every request
+	s.fetchedAt = time.Now()
+	fetching := make(chan struct{})
+	s.fetching = fetching
+
+	s.mu.Unlock()
+	keys, err := s.fetch(ctx)
+	s.mu.Lock()
+
+	s.fetching = nil
+	close(fetching)
+	if err != nil {
+		return err
+	}
+	s.keys = keys
+	return nil
+}
+
+// fetch reads and parses the key set document
+func (s *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS from %s: %w", s.source, err)
+	}
+	return keys, nil
+}
+
+// read returns the key set document
+func (s *KeySet) read(ctx context.Context) ([]byte, error) {
+	if !isURL(s.source) {
+		return os.ReadFile(s.source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.options.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s returned %d", s.source, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// jwk is a JSON Web Key, as far as verifying signatures needs
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the signing keys of a JWKS document by key ID. Keys of
+// unsupported types and encryption keys are skipped.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d] (%s): %w", i, k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey decodes the key, returning nil for key types that aren't supported
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid n: %w", err)
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x: %w", err)
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid x")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// decodeInt decodes a base64url big-endian integer
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// isURL reports whether source is an http(s) URL rather than a file path
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
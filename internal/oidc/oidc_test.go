@@ -0,0 +1,58 @@
+package oidc_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// jwksOf returns a JWKS document holding the public halves of keys, by key ID
+func jwksOf(keys map[string]interface{}) []byte {
+	encode := func(n *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(n.Bytes())
+	}
+
+	var doc struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			doc.Keys = append(doc.Keys, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+				"n": encode(k.N), "e": encode(big.NewInt(int64(k.E))),
+			})
+		case *ecdsa.PrivateKey:
+			doc.Keys = append(doc.Keys, map[string]string{
+				"kty": "EC", "kid": kid, "crv": "P-256",
+				"x": encode(k.X), "y": encode(k.Y),
+			})
+		}
+	}
+	data, err := json.Marshal(doc)
+	Expect(err).NotTo(HaveOccurred())
+	return data
+}
+
+// sign returns a token with claims signed by key
+func sign(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	Expect(err).NotTo(HaveOccurred())
+	return signed
+}
+
+func TestOIDC(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "OIDC Suite")
+}
@@ -0,0 +1,175 @@
+// Package oidc verifies JWT bearer tokens issued by an OpenID Connect identity
+// provider and maps their claims onto the identity used by the rest of the API.
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-api/internal/identity"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultGroupsClaim is the claim holding the caller's groups
+	DefaultGroupsClaim = "groups"
+
+	// DefaultTierClaim is the claim holding the caller's rate limit tier
+	DefaultTierClaim = "tier"
+
+	// DefaultLeeway is the clock skew allowed when checking exp, nbf and iat
+	DefaultLeeway = 30 * time.Second
+)
+
+var (
+	// ErrTokenExpired is returned for a token past its exp
+	ErrTokenExpired = errors.New("token has expired")
+
+	// ErrInvalidToken is returned for any other token that doesn't verify
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// signingMethods are the algorithms accepted in tokens. Symmetric algorithms
+// and "none" are never accepted, since the keys come from a public key set.
+var signingMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// Config configures JWT validation
+type Config struct {
+	// Issuer is the required iss claim
+	Issuer string
+
+	// Audience is the required aud claim
+	Audience string
+
+	// JWKS is the URL or file path of the identity provider's key set
+	JWKS string
+
+	// KeySet tunes how the key set is fetched
+	KeySet KeySetOptions
+
+	// GroupsClaim names the claim holding the caller's groups. Defaults to DefaultGroupsClaim.
+	GroupsClaim string
+
+	// TierClaim names the claim holding the caller's rate limit tier. Defaults to DefaultTierClaim.
+	TierClaim string
+
+	// Leeway is the clock skew allowed. Defaults to DefaultLeeway.
+	Leeway time.Duration
+}
+
+// Verifier checks JWT bearer tokens and returns the identity they carry
+type Verifier struct {
+	config Config
+	keys   *KeySet
+	parser *jwt.Parser
+}
+
+// NewVerifier creates a verifier. Issuer, Audience and JWKS are required.
+func NewVerifier(config Config) (*Verifier, error) {
+	switch {
+	case config.Issuer == "":
+		return nil, errors.New("oidc: issuer is required")
+	case config.Audience == "":
+		return nil, errors.New("oidc: audience is required")
+	case config.JWKS == "":
+		return nil, errors.New("oidc: a JWKS URL or file is required")
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = DefaultGroupsClaim
+	}
+	if config.TierClaim == "" {
+		config.TierClaim = DefaultTierClaim
+	}
+	if config.Leeway == 0 {
+		config.Leeway = DefaultLeeway
+	}
+
+	return &Verifier{
+		config: config,
+		keys:   NewKeySet(config.JWKS, config.KeySet),
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(signingMethods),
+			jwt.WithIssuer(config.Issuer),
+			jwt.WithAudience(config.Audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+			jwt.WithLeeway(config.Leeway),
+		),
+	}, nil
+}
+
+// IsJWT reports whether token looks like a JWT rather than a static API key
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verify checks the token's signature, issuer, audience and expiry, and
+// returns the identity it carries. The error wraps ErrTokenExpired or
+// ErrInvalidToken.
+func (v *Verifier) Verify(ctx context.Context, token string) (*identity.Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, ErrTokenExpired
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return v.identity(claims)
+}
+
+// identity maps verified claims onto an identity
+func (v *Verifier) identity(claims jwt.MapClaims) (*identity.Identity, error) {
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("%w: token has no sub claim", ErrInvalidToken)
+	}
+
+	id := &identity.Identity{
+		KeyID:  "jwt:" + subject,
+		Owner:  subject,
+		Groups: stringList(claims[v.config.GroupsClaim]),
+	}
+	// The client the token was issued to describes what it's used for
+	if azp, ok := claims["azp"].(string); ok {
+		id.Label = azp
+	}
+	if tier, ok := claims[v.config.TierClaim].(string); ok {
+		id.RateLimitTier = tier
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		id.ExpiresAt = exp.Time
+	}
+	return id, nil
+}
+
+// stringList reads a claim holding either a list of strings or a single string
+func stringList(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var list []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,249 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-api/internal/oidc"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	issuer   = "https://id.example.com"
+	audience = "scarlett-api"
+)
+
+var _ = Describe("Verifier", func() {
+	var (
+		signingKey *rsa.PrivateKey
+		ctx        context.Context
+
+		mu      sync.Mutex
+		served  map[string]interface{}
+		fetches atomic.Int32
+		server  *httptest.Server
+	)
+
+	// claims returns valid claims for a caller
+	claims := func() jwt.MapClaims {
+		now := time.Now()
+		return jwt.MapClaims{
+			"iss":    issuer,
+			"aud":    audience,
+			"sub":    "svc-ranking",
+			"azp":    "ranking-worker",
+			"groups": []string{"ml-platform", "ranking"},
+			"tier":   "pro",
+			"iat":    now.Unix(),
+			"exp":    now.Add(time.Hour).Unix(),
+		}
+	}
+
+	newVerifier := func(jwks string) *oidc.Verifier {
+		verifier, err := oidc.NewVerifier(oidc.Config{
+			Issuer:   issuer,
+			Audience: audience,
+			JWKS:     jwks,
+			KeySet:   oidc.KeySetOptions{MinRefreshInterval: time.Nanosecond},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return verifier
+	}
+
+	BeforeEach(func() {
+		var err error
+		signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		ctx = context.Background()
+
+		served = map[string]interface{}{"key-1": signingKey}
+		fetches.Store(0)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches.Add(1)
+			mu.Lock()
+			defer mu.Unlock()
+			w.Write(jwksOf(served))
+		}))
+		DeferCleanup(server.Close)
+	})
+
+	It("maps the claims of a valid token onto an identity", func() {
+		verifier := newVerifier(server.URL)
+		id, err := verifier.Verify(ctx, sign(jwt.SigningMethodRS256, "key-1", signingKey, claims()))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(id.KeyID).To(Equal("jwt:svc-ranking"))
+		Expect(id.Owner).To(Equal("svc-ranking"))
+		Expect(id.Label).To(Equal("ranking-worker"))
+		Expect(id.Groups).To(Equal([]string{"ml-platform", "ranking"}))
+		Expect(id.RateLimitTier).To(Equal("pro"))
+		Expect(id.ExpiresAt).To(BeTemporally("~", time.Now().Add(time.Hour), 2*time.Second))
+	})
+
+	It("reads custom claim names", func() {
+		verifier, err := oidc.NewVerifier(oidc.Config{
+			Issuer: issuer, Audience: audience, JWKS: server.URL,
+			GroupsClaim: "roles", TierClaim: "https://scarlett.ai/tier",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		c := claims()
+		c["roles"] = "admin"
+		c["https://scarlett.ai/tier"] = "enterprise"
+		id, err := verifier.Verify(ctx, sign(jwt.SigningMethodRS256, "key-1", signingKey, c))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id.Groups).To(Equal([]string{"admin"}))
+		Expect(id.RateLimitTier).To(Equal("enterprise"))
+	})
+
+	DescribeTable("rejects tokens that don't verify",
+		func(mutate func(jwt.MapClaims), expected error) {
+			c := claims()
+			mutate(c)
+			_, err := newVerifier(server.URL).Verify(ctx, sign(jwt.SigningMethodRS256, "key-1", signingKey, c))
+			Expect(err).To(MatchError(expected))
+		},
+		Entry("expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, oidc.ErrTokenExpired),
+		Entry("without exp", func(c jwt.MapClaims) { delete(c, "exp") }, oidc.ErrInvalidToken),
+		Entry("another issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, oidc.ErrInvalidToken),
+		Entry("another audience", func(c jwt.MapClaims) { c["aud"] = "other-api" }, oidc.ErrInvalidToken),
+		Entry("without sub", func(c jwt.MapClaims) { delete(c, "sub") }, oidc.ErrInvalidToken),
+	)
+
+	It("rejects tokens signed by other keys or algorithms", func() {
+		verifier := newVerifier(server.URL)
+
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = verifier.Verify(ctx, sign(jwt.SigningMethodRS256, "key-1", otherKey, claims()))
+		Expect(err).To(MatchError(oidc.ErrInvalidToken))
+
+		_, err = verifier.Verify(ctx, sign(jwt.SigningMethodRS256, "key-9", otherKey, claims()))
+		Expect(err).To(MatchError(oidc.ErrInvalidToken))
+
+		_, err = verifier.Verify(ctx, sign(jwt.SigningMethodHS256, "key-1", []byte("shared-secret"), claims()))
+		Expect(err).To(MatchError(oidc.ErrInvalidToken))
+
+		_, err = verifier.Verify(ctx, sign(jwt.SigningMethodNone, "key-1", jwt.UnsafeAllowNoneSignatureType, claims()))
+		Expect(err).To(MatchError(oidc.ErrInvalidToken))
+	})
+
+	It("caches the key set and picks up rotated keys", func() {
+		verifier := newVerifier(server.URL)
+		token := sign(jwt.SigningMethodRS256, "key-1", signingKey, claims())
+		for i := 0; i < 5; i++ {
+			_, err := verifier.Verify(ctx, token)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(fetches.Load()).To(BeEquivalentTo(1))
+
+		// The identity provider rotates to a new key
+		rotated, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+		mu.Lock()
+		served = map[string]interface{}{"key-2": rotated}
+		mu.Unlock()
+
+		_, err = verifier.Verify(ctx, sign(jwt.SigningMethodES256, "key-2", rotated, claims()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetches.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("fetches the key set without holding up tokens signed with known keys", func() {
+		rotated, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		var slowFetches atomic.Int32
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slowFetches.Add(1) > 1 {
+				<-release
+				w.Write(jwksOf(map[string]interface{}{"key-1": signingKey, "key-2": rotated}))
+				return
+			}
+			w.Write(jwksOf(map[string]interface{}{"key-1": signingKey}))
+		}))
+		DeferCleanup(slow.Close)
+		DeferCleanup(func() {
+			select {
+			case <-release:
+			default:
+				close(release)
+			}
+		})
+
+		verifier := newVerifier(slow.URL)
+		known := sign(jwt.SigningMethodRS256, "key-1", signingKey, claims())
+		_, err = verifier.Verify(ctx, known)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Two tokens signed with the rotated key wait for a single fetch
+		unknown := sign(jwt.SigningMethodES256, "key-2", rotated, claims())
+		results := make(chan error, 2)
+		for range 2 {
+			go func() {
+				_, err := verifier.Verify(context.Background(), unknown)
+				results <- err
+			}()
+		}
+		Eventually(slowFetches.Load).Should(BeEquivalentTo(2))
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := verifier.Verify(context.Background(), known)
+			done <- err
+		}()
+		Eventually(done).Should(Receive(BeNil()))
+		Consistently(results).ShouldNot(Receive())
+
+		close(release)
+		Eventually(results).Should(Receive(BeNil()))
+		Eventually(results).Should(Receive(BeNil()))
+		Expect(slowFetches.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("keeps the previous keys while the key set can't be fetched", func() {
+		verifier, err := oidc.NewVerifier(oidc.Config{
+			Issuer: issuer, Audience: audience, JWKS: server.URL,
+			KeySet: oidc.KeySetOptions{RefreshInterval: time.Nanosecond},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		token := sign(jwt.SigningMethodRS256, "key-1", signingKey, claims())
+		_, err = verifier.Verify(ctx, token)
+		Expect(err).NotTo(HaveOccurred())
+
+		server.Close()
+		_, err = verifier.Verify(ctx, token)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reads the key set from a file", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "jwks.json")
+		Expect(os.WriteFile(path, jwksOf(map[string]interface{}{"key-1": signingKey}), 0o600)).To(Succeed())
+
+		_, err := newVerifier(path).Verify(ctx, sign(jwt.SigningMethodRS256, "key-1", signingKey, claims()))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("requires an issuer, audience and key set", func() {
+		_, err := oidc.NewVerifier(oidc.Config{Audience: audience, JWKS: server.URL})
+		Expect(err).To(MatchError(ContainSubstring("issuer")))
+		_, err = oidc.NewVerifier(oidc.Config{Issuer: issuer, JWKS: server.URL})
+		Expect(err).To(MatchError(ContainSubstring("audience")))
+		_, err = oidc.NewVerifier(oidc.Config{Issuer: issuer, Audience: audience})
+		Expect(err).To(MatchError(ContainSubstring("JWKS")))
+	})
+})
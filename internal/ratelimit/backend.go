@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Rate limits requests: up to Burst at once, refilled at PerSecond requests a second
+type Rate struct {
+	// PerSecond is how many requests a second may be sent on average
+	PerSecond float64 `yaml:"requests_per_second"`
+
+	// Burst is how many requests may be sent at once
+	Burst int `yaml:"burst"`
+}
+
+// Decision is the outcome of asking a backend whether a request may proceed
+type Decision struct {
+	// Allowed reports whether the request may proceed
+	Allowed bool
+
+	// Remaining is how many more requests may be sent right now
+	Remaining int
+
+	// Reset is how long until the limiter is full again
+	Reset time.Duration
+
+	// RetryAfter is how long until a rejected request could succeed
+	RetryAfter time.Duration
+}
+
+// Backend holds request rate limiters keyed by caller. Backends that keep their
+// state outside the process let replicas share one limit per caller.
+type Backend interface {
+	// Allow takes one request from the limiter of key, which is created with
+	// rate if it doesn't exist and uses rate from then on
+	Allow(ctx context.Context, key string, rate Rate) (Decision, error)
+}
+
+// Rate limiter backends
+const (
+	// BackendMemory keeps limiters in the memory of each replica
+	BackendMemory = "memory"
+
+	// BackendRedis keeps limiters in Redis, shared by every replica
+	BackendRedis = "redis"
+)
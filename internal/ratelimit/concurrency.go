@@ -0,0 +1,288 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultQueueTimeout is how long a queued request waits for a slot when the config sets no timeout
+const DefaultQueueTimeout = 30 * time.Second
+
+var (
+	// ErrConcurrencyLimit is returned when a request can't start and the wait queue is full or disabled
+	ErrConcurrencyLimit = errors.New("too many concurrent requests")
+
+	// ErrQueueTimeout is returned when a queued request didn't get a slot in time
+	ErrQueueTimeout = errors.New("timed out waiting for a concurrent request slot")
+)
+
+// ConcurrencyConfig caps how many requests may be in flight at once. Zero caps are unlimited.
+type ConcurrencyConfig struct {
+	// MaxInFlight caps the requests in flight across every caller
+	MaxInFlight int `yaml:"max_in_flight"`
+
+	// PerKey caps the requests in flight for each caller without a tier, or
+	// with a tier that isn't listed
+	PerKey int `yaml:"per_key"`
+
+	// QueueSize is how many requests may wait for a slot. Zero rejects
+	// requests over a cap straight away.
+	QueueSize int `yaml:"queue_size"`
+
+	// QueueTimeout is how long a request waits for a slot. Defaults to DefaultQueueTimeout.
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+
+	// Tiers holds the per-caller cap and queue priority of each rate limit tier
+	Tiers map[string]ConcurrencyTier `yaml:"tiers,omitempty"`
+}
+
+// ConcurrencyTier is the concurrency limit of a rate limit tier
+type ConcurrencyTier struct {
+	// PerKey caps the requests in flight for each caller of the tier. Zero uses the default.
+	PerKey int `yaml:"per_key"`
+
+	// Priority orders the wait queue: requests of a higher priority get the
+	// next free slot first
+	Priority int `yaml:"priority"`
+}
+
+// IsZero reports whether nothing is capped
+func (c ConcurrencyConfig) IsZero() bool {
+	if c.MaxInFlight > 0 || c.PerKey > 0 {
+		return false
+	}
+	for _, tier := range c.Tiers {
+		if tier.PerKey > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Tier returns the per-caller cap and priority of the named tier. Tiers that
+// aren't listed, or list no cap, get PerKey; unlisted ones get priority zero.
+func (c ConcurrencyConfig) Tier(name string) ConcurrencyTier {
+	tier := c.Tiers[name]
+	if tier.PerKey == 0 {
+		tier.PerKey = c.PerKey
+	}
+	return tier
+}
+
+// validate checks that no cap, queue size or timeout is negative
+func (c ConcurrencyConfig) validate() error {
+	if c.MaxInFlight < 0 || c.PerKey < 0 || c.QueueSize < 0 || c.QueueTimeout < 0 {
+		return errors.New("max_in_flight, per_key, queue_size and queue_timeout must not be negative")
+	}
+	for name, tier := range c.Tiers {
+		if tier.PerKey < 0 {
+			return fmt.Errorf("tiers.%s: per_key must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// ConcurrencyMetrics observes how many requests of each tier are in flight and queued
+type ConcurrencyMetrics interface {
+	// ObserveInFlight records a change in the requests in flight
+	ObserveInFlight(tier string, delta int)
+
+	// ObserveQueued records a change in the requests waiting for a slot
+	ObserveQueued(tier string, delta int)
+}
+
+// nopConcurrencyMetrics discards all observations
+type nopConcurrencyMetrics struct{}
+
+func (nopConcurrencyMetrics) ObserveInFlight(string, int) {}
+
+func (nopConcurrencyMetrics) ObserveQueued(string, int) {}
+
+// Caller identifies who a request is for, and the cap and priority that apply to them
+type Caller struct {
+	// Key identifies the caller
+	Key string
+
+	// Tier is the caller's rate limit tier, for metrics
+	Tier string
+
+	// PerKey caps the caller's requests in flight. Zero is unlimited.
+	PerKey int
+
+	// Priority orders the caller's requests in the wait queue
+	Priority int
+}
+
+// ConcurrencyLimiter counts the requests in flight in this process, per
+// caller and in total. Requests over a cap wait in a bounded queue, ordered by
+// priority and then by arrival, and each freed slot goes straight to the
+// first queued request it fits.
+type ConcurrencyLimiter struct {
+	metrics ConcurrencyMetrics
+
+	mu          sync.Mutex
+	inFlight    map[string]int
+	total       int
+	maxInFlight int
+	queue       []*waiter
+}
+
+// waiter is a request in the wait queue
+type waiter struct {
+	caller  Caller
+	ready   chan struct{}
+	granted bool
+}
+
+// NewConcurrencyLimiter creates a limiter with nothing in flight. A nil metrics discards observations.
+func NewConcurrencyLimiter(metrics ConcurrencyMetrics) *ConcurrencyLimiter {
+	if metrics == nil {
+		metrics = nopConcurrencyMetrics{}
+	}
+	return &ConcurrencyLimiter{metrics: metrics, inFlight: make(map[string]int)}
+}
+
+// Acquire starts a request for caller under the caps of config, waiting in
+// the queue if needed. On success, call release once the request is done.
+// It fails with ErrConcurrencyLimit if the queue is full, ErrQueueTimeout if
+// no slot came up in time, or the context's error if it ends first.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, caller Caller, config ConcurrencyConfig) (release func(), err error) {
+	l.mu.Lock()
+
+	// Caps may have been raised since the queued requests arrived
+	l.maxInFlight = config.MaxInFlight
+	l.dispatch()
+
+	if l.fits(caller) {
+		l.start(caller)
+		l.mu.Unlock()
+		return l.releaser(caller), nil
+	}
+	if len(l.queue) >= config.QueueSize {
+		l.mu.Unlock()
+		return nil, ErrConcurrencyLimit
+	}
+
+	w := &waiter{caller: caller, ready: make(chan struct{})}
+	l.enqueue(w)
+	l.mu.Unlock()
+
+	timeout := config.QueueTimeout
+	if timeout <= 0 {
+		timeout = DefaultQueueTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-w.ready:
+		return l.releaser(caller), nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// A slot may have come up just as the wait ended
+	if w.granted {
+		return l.releaser(caller), nil
+	}
+	l.remove(w)
+	return nil, err
+}
+
+// InFlight returns how many requests of key are in flight
+func (l *ConcurrencyLimiter) InFlight(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight[key]
+}
+
+// Queued returns how many requests are waiting for a slot
+func (l *ConcurrencyLimiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queue)
+}
+
+// fits reports whether a request of caller can start without going over a cap
+func (l *ConcurrencyLimiter) fits(caller Caller) bool {
+	if l.maxInFlight > 0 && l.total >= l.maxInFlight {
+		return false
+	}
+	return caller.PerKey <= 0 || l.inFlight[caller.Key] < caller.PerKey
+}
+
+// start counts a request of caller as in flight
+func (l *ConcurrencyLimiter) start(caller Caller) {
+	l.inFlight[caller.Key]++
+	l.total++
+	l.metrics.ObserveInFlight(caller.Tier, 1)
+}
+
+// releaser returns a function that ends a request of caller once, however often it's called
+func (l *ConcurrencyLimiter) releaser(caller Caller) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			if l.inFlight[caller.Key]--; l.inFlight[caller.Key] <= 0 {
+				delete(l.inFlight, caller.Key)
+			}
+			l.total--
+			l.metrics.ObserveInFlight(caller.Tier, -1)
+			l.dispatch()
+		})
+	}
+}
+
+// dispatch starts queued requests, in queue order, for as long as free slots fit them
+func (l *ConcurrencyLimiter) dispatch() {
+	for i := 0; i < len(l.queue); {
+		if l.maxInFlight > 0 && l.total >= l.maxInFlight {
+			return
+		}
+		w := l.queue[i]
+		if !l.fits(w.caller) {
+			// Requests further back may be for callers with a free slot
+			i++
+			continue
+		}
+		l.queue = append(l.queue[:i], l.queue[i+1:]...)
+		l.metrics.ObserveQueued(w.caller.Tier, -1)
+		l.start(w.caller)
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// enqueue adds w behind the requests of the same or a higher priority
+func (l *ConcurrencyLimiter) enqueue(w *waiter) {
+	i := sort.Search(len(l.queue), func(i int) bool {
+		return l.queue[i].caller.Priority < w.caller.Priority
+	})
+	l.queue = append(l.queue, nil)
+	copy(l.queue[i+1:], l.queue[i:])
+	l.queue[i] = w
+	l.metrics.ObserveQueued(w.caller.Tier, 1)
+}
+
+// remove takes w out of the queue
+func (l *ConcurrencyLimiter) remove(w *waiter) {
+	for i, queued := range l.queue {
+		if queued == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			l.metrics.ObserveQueued(w.caller.Tier, -1)
+			return
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package ratelimit_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-api/internal/ratelimit"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// gauges records concurrency metrics by tier
+type gauges struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	queued   map[string]int
+}
+
+func newGauges() *gauges {
+	return &gauges{inFlight: make(map[string]int), queued: make(map[string]int)}
+}
+
+func (g *gauges) ObserveInFlight(tier string, delta int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inFlight[tier] += delta
+}
+
+func (g *gauges) ObserveQueued(tier string, delta int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.queued[tier] += delta
+}
+
+func (g *gauges) get(tier string) (inFlight, queued int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.inFlight[tier], g.queued[tier]
+}
+
+var _ = Describe("ConcurrencyLimiter", func() {
+	var (
+		metrics *gauges
+		limiter *ratelimit.ConcurrencyLimiter
+		ctx     context.Context
+	)
+
+	BeforeEach(func() {
+		metrics = newGauges()
+		limiter = ratelimit.NewConcurrencyLimiter(metrics)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(context.Background())
+		// Stops requests still waiting when the spec ends
+		DeferCleanup(cancel)
+	})
+
+	// acquire starts a request that must be let through
+	acquire := func(caller ratelimit.Caller, config ratelimit.ConcurrencyConfig) func() {
+		release, err := limiter.Acquire(ctx, caller, config)
+		Expect(err).NotTo(HaveOccurred())
+		return release
+	}
+
+	// wait starts a request in the background, sending its outcome on the returned channel
+	wait := func(caller ratelimit.Caller, config ratelimit.ConcurrencyConfig) chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := limiter.Acquire(ctx, caller, config)
+			done <- err
+		}()
+		return done
+	}
+
+	alice := ratelimit.Caller{Key: "key_alice", Tier: "free", PerKey: 2}
+	bob := ratelimit.Caller{Key: "key_bob", Tier: "free", PerKey: 2}
+
+	It("caps the requests each caller has in flight", func() {
+		config := ratelimit.ConcurrencyConfig{}
+		first := acquire(alice, config)
+		acquire(alice, config)
+
+		_, err := limiter.Acquire(ctx, alice, config)
+		Expect(err).To(MatchError(ratelimit.ErrConcurrencyLimit))
+
+		// Other callers have their own cap
+		acquire(bob, config)
+
+		first()
+		acquire(alice, config)
+		Expect(limiter.InFlight("key_alice")).To(Equal(2))
+	})
+
+	It("caps the requests in flight across callers", func() {
+		config := ratelimit.ConcurrencyConfig{MaxInFlight: 2}
+		acquire(alice, config)
+		release := acquire(bob, config)
+
+		_, err := limiter.Acquire(ctx, ratelimit.Caller{Key: "key_carol"}, config)
+		Expect(err).To(MatchError(ratelimit.ErrConcurrencyLimit))
+
+		release()
+		acquire(ratelimit.Caller{Key: "key_carol"}, config)
+	})
+
+	It("queues requests until a slot frees up", func() {
+		config := ratelimit.ConcurrencyConfig{QueueSize: 1, QueueTimeout: time.Minute}
+		first := acquire(alice, config)
+		acquire(alice, config)
+
+		done := wait(alice, config)
+		Eventually(limiter.Queued).Should(Equal(1))
+		Consistently(done, 50*time.Millisecond).ShouldNot(Receive())
+
+		// The queue is full
+		_, err := limiter.Acquire(ctx, alice, config)
+		Expect(err).To(MatchError(ratelimit.ErrConcurrencyLimit))
+
+		first()
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(limiter.Queued()).To(BeZero())
+		Expect(limiter.InFlight("key_alice")).To(Equal(2))
+	})
+
+	It("gives up on queued requests after the timeout", func() {
+		config := ratelimit.ConcurrencyConfig{QueueSize: 1, QueueTimeout: 20 * time.Millisecond}
+		acquire(alice, config)
+		acquire(alice, config)
+
+		_, err := limiter.Acquire(ctx, alice, config)
+		Expect(err).To(MatchError(ratelimit.ErrQueueTimeout))
+		Expect(limiter.Queued()).To(BeZero())
+	})
+
+	It("stops waiting when the request is cancelled", func() {
+		config := ratelimit.ConcurrencyConfig{QueueSize: 1, QueueTimeout: time.Minute}
+		acquire(alice, config)
+		acquire(alice, config)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := limiter.Acquire(cancelled, alice, config)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(limiter.Queued()).To(BeZero())
+	})
+
+	It("hands free slots to higher priorities first", func() {
+		config := ratelimit.ConcurrencyConfig{MaxInFlight: 1, QueueSize: 3, QueueTimeout: time.Minute}
+		release := acquire(alice, config)
+
+		low := wait(ratelimit.Caller{Key: "key_low"}, config)
+		Eventually(limiter.Queued).Should(Equal(1))
+		high := wait(ratelimit.Caller{Key: "key_high", Priority: 10}, config)
+		Eventually(limiter.Queued).Should(Equal(2))
+
+		release()
+		Eventually(high).Should(Receive(BeNil()))
+		Consistently(low, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("lets queued requests of other callers past a caller at its cap", func() {
+		config := ratelimit.ConcurrencyConfig{MaxInFlight: 3, QueueSize: 2, QueueTimeout: time.Minute}
+		acquire(alice, config)
+		acquire(alice, config)
+		release := acquire(bob, config)
+
+		blocked := wait(alice, config)
+		Eventually(limiter.Queued).Should(Equal(1))
+		other := wait(bob, config)
+		Eventually(limiter.Queued).Should(Equal(2))
+
+		// Alice queued first but is still at her own cap
+		release()
+		Eventually(other).Should(Receive(BeNil()))
+		Consistently(blocked, 50*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("reports requests in flight and queued", func() {
+		config := ratelimit.ConcurrencyConfig{QueueSize: 1, QueueTimeout: time.Minute}
+		first := acquire(alice, config)
+		acquire(alice, config)
+		done := wait(alice, config)
+
+		Eventually(func() []int {
+			inFlight, queued := metrics.get("free")
+			return []int{inFlight, queued}
+		}).Should(Equal([]int{2, 1}))
+
+		first()
+		first()
+		Eventually(done).Should(Receive(BeNil()))
+		inFlight, queued := metrics.get("free")
+		Expect(inFlight).To(Equal(2))
+		Expect(queued).To(BeZero())
+	})
+})
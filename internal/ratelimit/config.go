@@ -0,0 +1,253 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultRequestsPerSecond is the request rate of callers without a tier
+	DefaultRequestsPerSecond = 10
+
+	// DefaultBurst is the burst of callers without a tier
+	DefaultBurst = 15
+
+	// DefaultReloadInterval is how often the config file is checked for changes
+	DefaultReloadInterval = 5 * time.Second
+)
+
+// Config holds the request rate limits of every caller, as read from a file
+// such as rate-limits.yaml
+type Config struct {
+	// Default applies to callers without a tier, or with a tier that isn't listed
+	Default Rate `yaml:"default"`
+
+	// Tiers holds the limits of each rate limit tier, such as free, team and prod
+	Tiers map[string]Rate `yaml:"tiers,omitempty"`
+
+	// Models scales the limits of requests for some models, so that 0.5 halves
+	// them. Names ending in * match every model with that prefix. Requests for
+	// a scaled model get a limiter of their own.
+	Models map[string]float64 `yaml:"models,omitempty"`
+
+	// Concurrency caps how many requests may be in flight at once
+	Concurrency ConcurrencyConfig `yaml:"concurrency,omitempty"`
+}
+
+// DefaultConfig returns the limits used without a config file
+func DefaultConfig() *Config {
+	return &Config{Default: Rate{PerSecond: DefaultRequestsPerSecond, Burst: DefaultBurst}}
+}
+
+// LoadConfig reads the config file at path. A missing file gives DefaultConfig.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("Warning: %s not found, using the default rate limits", path)
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultConfig()
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config, nil
+}
+
+// validate checks that every limit and multiplier is positive, and that no
+// concurrency cap is negative
+func (c *Config) validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for name, rate := range c.Tiers {
+		if err := rate.validate(); err != nil {
+			return fmt.Errorf("tiers.%s: %w", name, err)
+		}
+	}
+	for model, multiplier := range c.Models {
+		if multiplier <= 0 {
+			return fmt.Errorf("models.%s: multiplier must be positive", model)
+		}
+	}
+	if err := c.Concurrency.validate(); err != nil {
+		return fmt.Errorf("concurrency: %w", err)
+	}
+	return nil
+}
+
+// Tier returns the limits of the named tier, or the default ones
+func (c *Config) Tier(name string) Rate {
+	if rate, ok := c.Tiers[name]; ok {
+		return rate
+	}
+	return c.Default
+}
+
+// Multiplier returns how much to scale the limits of requests for model, and
+// the entry of Models that matched it. An exact name wins over a prefix, and a
+// longer prefix over a shorter one. Unlisted models aren't scaled.
+func (c *Config) Multiplier(model string) (string, float64) {
+	if multiplier, ok := c.Models[model]; ok {
+		return model, multiplier
+	}
+
+	match, multiplier := "", 1.0
+	for pattern, m := range c.Models {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(model, prefix) && len(pattern) > len(match) {
+			match, multiplier = pattern, m
+		}
+	}
+	return match, multiplier
+}
+
+// Scale returns the rate multiplied by m. The burst is rounded, but never below one request.
+func (r Rate) Scale(m float64) Rate {
+	return Rate{PerSecond: r.PerSecond * m, Burst: max(1, int(math.Round(float64(r.Burst)*m)))}
+}
+
+// validate checks that the rate and burst are positive
+func (r Rate) validate() error {
+	if r.PerSecond <= 0 || r.Burst <= 0 {
+		return errors.New("requests_per_second and burst must be positive")
+	}
+	return nil
+}
+
+// Policy holds the current rate limit config. When it is read from a file, it
+// is reloaded whenever the file changes, and limiters pick up the new limits
+// on their next request.
+type Policy struct {
+	path   string
+	config atomic.Pointer[Config]
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewPolicy creates a policy that always uses config
+func NewPolicy(config *Config) *Policy {
+	p := &Policy{}
+	p.config.Store(config)
+	return p
+}
+
+// LoadPolicy creates a policy read from the config file at path
+func LoadPolicy(path string) (*Policy, error) {
+	p := &Policy{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Config returns the current config
+func (p *Policy) Config() *Config {
+	return p.config.Load()
+}
+
+// Reload reads the config file again. The current config is kept if it fails.
+func (p *Policy) Reload() error {
+	if p.path == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Stat before reading, so a write racing with the read is seen as a change next time
+	info, statErr := os.Stat(p.path)
+	config, err := LoadConfig(p.path)
+	if err != nil {
+		return err
+	}
+	if statErr == nil {
+		p.modTime, p.size = info.ModTime(), info.Size()
+	}
+	p.config.Store(config)
+	return nil
+}
+
+// Changed reports whether the config file looks different from when it was last loaded
+func (p *Policy) Changed() bool {
+	if p.path == "" {
+		return false
+	}
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !info.ModTime().Equal(p.modTime) || info.Size() != p.size
+}
+
+// Watch reloads the config file when it changes, checking every interval,
+// and on SIGHUP. Call the returned function to stop watching.
+func (p *Policy) Watch(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-done:
+				return
+			case <-hangup:
+				p.reloadAndLog("SIGHUP")
+			case <-ticker.C:
+				if p.Changed() {
+					p.reloadAndLog("file change")
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(hangup)
+			ticker.Stop()
+			close(done)
+			<-exited
+		})
+	}
+}
+
+// reloadAndLog reloads the config and logs the outcome
+func (p *Policy) reloadAndLog(reason string) {
+	if err := p.Reload(); err != nil {
+		log.Printf("Failed to reload rate limits after %s, keeping the previous limits: %v", reason, err)
+		return
+	}
+	log.Printf("Reloaded rate limits from %s after %s", p.path, reason)
+}
@@ -0,0 +1,162 @@
+package ratelimit_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-api/internal/ratelimit"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "rate-limits.yaml")
+	})
+
+	write := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+	}
+
+	It("reads the default, tier and model limits", func() {
+		write(`
+default:
+  requests_per_second: 5
+  burst: 8
+tiers:
+  free:
+    requests_per_second: 1
+    burst: 2
+  prod:
+    requests_per_second: 100
+    burst: 200
+models:
+  llama-3.3-70b-versatile: 0.5
+  gemma*: 2
+`)
+		config, err := ratelimit.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Default).To(Equal(ratelimit.Rate{PerSecond: 5, Burst: 8}))
+		Expect(config.Tier("free")).To(Equal(ratelimit.Rate{PerSecond: 1, Burst: 2}))
+		Expect(config.Tier("prod")).To(Equal(ratelimit.Rate{PerSecond: 100, Burst: 200}))
+		Expect(config.Tier("unknown")).To(Equal(config.Default))
+		Expect(config.Tier("")).To(Equal(config.Default))
+	})
+
+	It("falls back to the built-in defaults", func() {
+		config, err := ratelimit.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config).To(Equal(ratelimit.DefaultConfig()))
+
+		write("tiers:\n  free:\n    requests_per_second: 1\n    burst: 1\n")
+		config, err = ratelimit.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Default).To(Equal(ratelimit.Rate{PerSecond: ratelimit.DefaultRequestsPerSecond, Burst: ratelimit.DefaultBurst}))
+	})
+
+	It("reads the concurrency caps", func() {
+		write(`
+concurrency:
+  max_in_flight: 100
+  per_key: 4
+  queue_size: 20
+  queue_timeout: 15s
+  tiers:
+    free:
+      per_key: 1
+    prod:
+      priority: 10
+`)
+		config, err := ratelimit.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Concurrency.MaxInFlight).To(Equal(100))
+		Expect(config.Concurrency.QueueSize).To(Equal(20))
+		Expect(config.Concurrency.QueueTimeout).To(Equal(15 * time.Second))
+		Expect(config.Concurrency.Tier("free")).To(Equal(ratelimit.ConcurrencyTier{PerKey: 1}))
+		Expect(config.Concurrency.Tier("prod")).To(Equal(ratelimit.ConcurrencyTier{PerKey: 4, Priority: 10}))
+		Expect(config.Concurrency.Tier("")).To(Equal(ratelimit.ConcurrencyTier{PerKey: 4}))
+
+		write("concurrency:\n  per_key: -1\n")
+		_, err = ratelimit.LoadConfig(path)
+		Expect(err).To(MatchError(ContainSubstring("concurrency")))
+	})
+
+	It("rejects limits that aren't positive", func() {
+		write("tiers:\n  free:\n    requests_per_second: 1\n")
+		_, err := ratelimit.LoadConfig(path)
+		Expect(err).To(MatchError(ContainSubstring("tiers.free")))
+
+		write("models:\n  gemma*: 0\n")
+		_, err = ratelimit.LoadConfig(path)
+		Expect(err).To(MatchError(ContainSubstring("models.gemma*")))
+	})
+
+	It("matches models exactly or by the longest prefix", func() {
+		config := &ratelimit.Config{Models: map[string]float64{
+			"llama*":                  2,
+			"llama-3.3*":              0.5,
+			"llama-3.3-70b-versatile": 0.25,
+		}}
+
+		match, multiplier := config.Multiplier("llama-3.3-70b-versatile")
+		Expect(match).To(Equal("llama-3.3-70b-versatile"))
+		Expect(multiplier).To(Equal(0.25))
+
+		match, multiplier = config.Multiplier("llama-3.3-8b-instant")
+		Expect(match).To(Equal("llama-3.3*"))
+		Expect(multiplier).To(Equal(0.5))
+
+		match, multiplier = config.Multiplier("llama3-8b-8192")
+		Expect(match).To(Equal("llama*"))
+		Expect(multiplier).To(Equal(2.0))
+
+		match, multiplier = config.Multiplier("gemma-7b-it")
+		Expect(match).To(BeEmpty())
+		Expect(multiplier).To(Equal(1.0))
+	})
+
+	It("scales rates without dropping the burst below one request", func() {
+		rate := ratelimit.Rate{PerSecond: 10, Burst: 15}
+		Expect(rate.Scale(2)).To(Equal(ratelimit.Rate{PerSecond: 20, Burst: 30}))
+		Expect(rate.Scale(0.5)).To(Equal(ratelimit.Rate{PerSecond: 5, Burst: 8}))
+		Expect(rate.Scale(0.01)).To(Equal(ratelimit.Rate{PerSecond: 0.1, Burst: 1}))
+	})
+})
+
+var _ = Describe("Policy", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "rate-limits.yaml")
+		Expect(os.WriteFile(path, []byte("default:\n  requests_per_second: 5\n  burst: 8\n"), 0o600)).To(Succeed())
+	})
+
+	It("reloads the config file when it changes", func() {
+		policy, err := ratelimit.LoadPolicy(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.Config().Default.PerSecond).To(Equal(5.0))
+		Expect(policy.Changed()).To(BeFalse())
+
+		Expect(os.WriteFile(path, []byte("default:\n  requests_per_second: 50\n  burst: 80\n"), 0o600)).To(Succeed())
+		later := time.Now().Add(time.Second)
+		Expect(os.Chtimes(path, later, later)).To(Succeed())
+		Expect(policy.Changed()).To(BeTrue())
+
+		Expect(policy.Reload()).To(Succeed())
+		Expect(policy.Config().Default).To(Equal(ratelimit.Rate{PerSecond: 50, Burst: 80}))
+		Expect(policy.Changed()).To(BeFalse())
+	})
+
+	It("keeps the current config when the file is invalid", func() {
+		policy, err := ratelimit.LoadPolicy(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.WriteFile(path, []byte("default: [\n"), 0o600)).To(Succeed())
+		Expect(policy.Reload()).NotTo(Succeed())
+		Expect(policy.Config().Default).To(Equal(ratelimit.Rate{PerSecond: 5, Burst: 8}))
+	})
+})
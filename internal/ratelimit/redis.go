@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisPrefix is prepended to the Redis keys of request rate limiters
+const DefaultRedisPrefix = "ratelimit:requests:"
+
+// tokenBucket takes tokens from a bucket stored in a hash at KEYS[1], in one
+// atomic step so replicas sharing the bucket can't both take its last token.
+// Time is read from Redis rather than passed in, so clock skew between
+// replicas doesn't matter. The bucket expires once it would be full again,
+// since a missing bucket is the same as a full one.
+//
+// ARGV is the refill rate per second, the burst and the tokens to take. It
+// returns whether they were taken, the tokens left, the seconds until the
+// bucket is full and the seconds until the tokens could be taken. The numbers
+// are strings, since Redis would truncate Lua numbers to integers.
+var tokenBucket = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil or updated == nil then
+  tokens = burst
+else
+  tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+end
+
+local allowed = 0
+local retry_after = 0
+if tokens >= cost then
+  tokens = tokens - cost
+  allowed = 1
+else
+  retry_after = (cost - tokens) / rate
+end
+
+local reset = (burst - tokens) / rate
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(reset * 1000) + 1000)
+
+return {tostring(allowed), tostring(tokens), tostring(reset), tostring(retry_after)}
+`)
+
+// RedisBackend keeps request rate limiters in Redis, or anything else that
+// speaks its protocol and runs Lua scripts, so every replica using the same
+// server shares one limit per caller. It needs Redis 5 or later.
+type RedisBackend struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisBackend creates a backend that stores limiters through client
+func NewRedisBackend(client redis.UniversalClient) *RedisBackend {
+	return &RedisBackend{client: client, prefix: DefaultRedisPrefix}
+}
+
+// OpenRedisBackend connects to the server at url, such as redis://localhost:6379/0
+func OpenRedisBackend(url string) (*RedisBackend, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	return NewRedisBackend(redis.NewClient(options)), nil
+}
+
+// Allow takes one request from the limiter of key
+func (b *RedisBackend) Allow(ctx context.Context, key string, rate Rate) (Decision, error) {
+	if rate.PerSecond <= 0 || rate.Burst <= 0 {
+		return Decision{}, errors.New("ratelimit: rate and burst must be positive")
+	}
+
+	values, err := tokenBucket.Run(ctx, b.client, []string{b.prefix + key}, rate.PerSecond, rate.Burst, 1).StringSlice()
+	if err != nil {
+		return Decision{}, fmt.Errorf("ratelimit: %w", err)
+	}
+	if len(values) != 4 {
+		return Decision{}, fmt.Errorf("ratelimit: unexpected script result %q", values)
+	}
+
+	numbers := make([]float64, len(values))
+	for i, value := range values {
+		if numbers[i], err = strconv.ParseFloat(value, 64); err != nil {
+			return Decision{}, fmt.Errorf("ratelimit: unexpected script result %q", values)
+		}
+	}
+	return Decision{
+		Allowed:    numbers[0] == 1,
+		Remaining:  int(max(0, numbers[1])),
+		Reset:      seconds(numbers[2]),
+		RetryAfter: seconds(numbers[3]),
+	}, nil
+}
+
+// Ping checks that the server can be reached
+func (b *RedisBackend) Ping(ctx context.Context) error {
+	return b.client.Ping(ctx).Err()
+}
+
+// Close closes the connection to the server
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}
+
+// seconds converts a number of seconds to a duration, rounding up
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
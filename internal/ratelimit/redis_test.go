@@ -0,0 +1,119 @@
+package ratelimit_test
+
+import (
+	"context"
+	"time"
+
+	"go-api/internal/ratelimit"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RedisBackend", func() {
+	var (
+		server  *miniredis.Miniredis
+		now     time.Time
+		backend *ratelimit.RedisBackend
+		ctx     context.Context
+	)
+
+	rate := ratelimit.Rate{PerSecond: 1, Burst: 3}
+
+	// open connects another backend to the server, as another replica would
+	open := func() *ratelimit.RedisBackend {
+		b, err := ratelimit.OpenRedisBackend("redis://" + server.Addr())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(b.Close)
+		return b
+	}
+
+	BeforeEach(func() {
+		server = miniredis.NewMiniRedis()
+		Expect(server.Start()).To(Succeed())
+		DeferCleanup(server.Close)
+
+		now = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		server.SetTime(now)
+		backend = open()
+		ctx = context.Background()
+	})
+
+	// allow takes a request from key through b
+	allow := func(b *ratelimit.RedisBackend, key string, rate ratelimit.Rate) ratelimit.Decision {
+		decision, err := b.Allow(ctx, key, rate)
+		Expect(err).NotTo(HaveOccurred())
+		return decision
+	}
+
+	It("allows a burst of requests and then rejects them", func() {
+		for remaining := 2; remaining >= 0; remaining-- {
+			decision := allow(backend, "key_a", rate)
+			Expect(decision.Allowed).To(BeTrue())
+			Expect(decision.Remaining).To(Equal(remaining))
+		}
+
+		decision := allow(backend, "key_a", rate)
+		Expect(decision.Allowed).To(BeFalse())
+		Expect(decision.Remaining).To(BeZero())
+		Expect(decision.RetryAfter).To(Equal(time.Second))
+		Expect(decision.Reset).To(Equal(3 * time.Second))
+
+		// Other callers have their own limiter
+		Expect(allow(backend, "key_b", rate).Allowed).To(BeTrue())
+	})
+
+	It("refills the limiter as time passes", func() {
+		for range 3 {
+			Expect(allow(backend, "key_a", rate).Allowed).To(BeTrue())
+		}
+		Expect(allow(backend, "key_a", rate).Allowed).To(BeFalse())
+
+		server.SetTime(now.Add(1500 * time.Millisecond))
+		decision := allow(backend, "key_a", rate)
+		Expect(decision.Allowed).To(BeTrue())
+		Expect(decision.Remaining).To(BeZero())
+		Expect(decision.RetryAfter).To(BeZero())
+	})
+
+	It("shares limits between replicas", func() {
+		replica := open()
+
+		Expect(allow(backend, "key_a", rate).Allowed).To(BeTrue())
+		Expect(allow(replica, "key_a", rate).Allowed).To(BeTrue())
+		Expect(allow(backend, "key_a", rate).Allowed).To(BeTrue())
+		Expect(allow(replica, "key_a", rate).Allowed).To(BeFalse())
+		Expect(allow(backend, "key_a", rate).Allowed).To(BeFalse())
+	})
+
+	It("applies new rates to existing limiters", func() {
+		for range 3 {
+			Expect(allow(backend, "key_a", rate).Allowed).To(BeTrue())
+		}
+		Expect(allow(backend, "key_a", rate).Allowed).To(BeFalse())
+
+		faster := ratelimit.Rate{PerSecond: 10, Burst: 3}
+		server.SetTime(now.Add(200 * time.Millisecond))
+		Expect(allow(backend, "key_a", faster).Allowed).To(BeTrue())
+	})
+
+	It("expires limiters once they are full again", func() {
+		Expect(allow(backend, "key_a", rate).Allowed).To(BeTrue())
+		Expect(server.Exists(ratelimit.DefaultRedisPrefix + "key_a")).To(BeTrue())
+
+		server.FastForward(2 * time.Second)
+		Expect(server.Exists(ratelimit.DefaultRedisPrefix + "key_a")).To(BeFalse())
+	})
+
+	It("fails when the server can't be reached", func() {
+		server.Close()
+		_, err := backend.Allow(ctx, "key_a", rate)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects invalid rates", func() {
+		_, err := backend.Allow(ctx, "key_a", ratelimit.Rate{PerSecond: 0, Burst: 3})
+		Expect(err).To(HaveOccurred())
+	})
+})
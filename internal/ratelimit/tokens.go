@@ -0,0 +1,230 @@
+// Package ratelimit provides backends for request rate limiters, such as Redis
+// so that replicas share them, and per-caller token budgets, so that large
+// requests count for more than small ones.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// cleanupInterval is how often budgets that have refilled completely are dropped
+const cleanupInterval = 10 * time.Minute
+
+// Limits are the token budgets of a caller. Zero fields are unlimited.
+type Limits struct {
+	// TokensPerMinute is how many tokens may be used in any minute
+	TokensPerMinute int64
+
+	// TokensPerDay is how many tokens may be used in any day
+	TokensPerDay int64
+}
+
+// IsZero reports whether no budget is set
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Result describes a caller's budget after a reservation, for rate limit headers.
+// It covers the per-minute budget if there is one, otherwise the per-day budget.
+type Result struct {
+	// Allowed reports whether the tokens were reserved
+	Allowed bool
+
+	// Limit is the size of the budget
+	Limit int64
+
+	// Remaining is how many tokens are left in the budget
+	Remaining int64
+
+	// Reset is how long until the budget is full again
+	Reset time.Duration
+
+	// RetryAfter is how long until the rejected reservation could succeed.
+	// It is negative if it never can, because it's larger than the budget.
+	RetryAfter time.Duration
+}
+
+// TokenLimiter holds the token budgets of every caller in memory. Each budget
+// is a bucket that refills continuously, so a per-minute budget of 60,000
+// tokens regains 1,000 tokens every second.
+type TokenLimiter struct {
+	mu          sync.Mutex
+	budgets     map[string]*budget
+	now         func() time.Time
+	lastCleanup time.Time
+}
+
+// NewTokenLimiter creates an empty limiter
+func NewTokenLimiter() *TokenLimiter {
+	return &TokenLimiter{budgets: make(map[string]*budget), now: time.Now}
+}
+
+// NewTokenLimiterWithClock creates an empty limiter that reads the time from now, for tests
+func NewTokenLimiterWithClock(now func() time.Time) *TokenLimiter {
+	l := NewTokenLimiter()
+	l.now = now
+	return l
+}
+
+// Reserve takes tokens from the budgets of key if all of them have enough left.
+// Call Adjust once the actual number of tokens used is known.
+func (l *TokenLimiter) Reserve(key string, limits Limits, tokens int64) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.cleanup(now)
+	b := l.budget(key, limits, now)
+
+	// Wait for the slowest bucket, unless one can never hold the tokens
+	var retryAfter time.Duration
+	for _, w := range b.windows() {
+		switch wait := w.waitFor(tokens); {
+		case wait < 0:
+			retryAfter = wait
+		case retryAfter >= 0 && wait > retryAfter:
+			retryAfter = wait
+		}
+	}
+	allowed := retryAfter == 0
+	if allowed {
+		for _, w := range b.windows() {
+			w.tokens -= float64(tokens)
+		}
+	}
+
+	result := b.result()
+	result.Allowed = allowed
+	result.RetryAfter = retryAfter
+	return result
+}
+
+// Adjust corrects the budgets of key by the difference between the tokens
+// reserved and those actually used. A negative delta returns tokens.
+func (l *TokenLimiter) Adjust(key string, limits Limits, delta int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.budget(key, limits, l.now())
+	for _, w := range b.windows() {
+		// Tokens given back can't make the budget larger than it is
+		w.tokens = math.Min(w.tokens-float64(delta), w.capacity)
+	}
+}
+
+// budget returns the budget of key refilled up to now, creating it or
+// resizing it to limits as needed
+func (l *TokenLimiter) budget(key string, limits Limits, now time.Time) *budget {
+	b, ok := l.budgets[key]
+	if !ok {
+		b = &budget{}
+		l.budgets[key] = b
+	}
+	b.minute.resize(float64(limits.TokensPerMinute), time.Minute)
+	b.day.resize(float64(limits.TokensPerDay), 24*time.Hour)
+	b.refill(now)
+	return b
+}
+
+// cleanup drops budgets that have refilled completely, since they're the
+// same as new ones. It runs at most every cleanupInterval.
+func (l *TokenLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+
+	for key, b := range l.budgets {
+		b.refill(now)
+		if b.full() {
+			delete(l.budgets, key)
+		}
+	}
+}
+
+// budget is the per-minute and per-day buckets of one caller
+type budget struct {
+	minute, day window
+	updated     time.Time
+}
+
+// windows returns the buckets that are limited
+func (b *budget) windows() []*window {
+	var windows []*window
+	for _, w := range []*window{&b.minute, &b.day} {
+		if w.capacity > 0 {
+			windows = append(windows, w)
+		}
+	}
+	return windows
+}
+
+// refill adds the tokens regained since the last update
+func (b *budget) refill(now time.Time) {
+	if !b.updated.IsZero() {
+		elapsed := now.Sub(b.updated)
+		for _, w := range b.windows() {
+			w.tokens = math.Min(w.capacity, w.tokens+w.rate*elapsed.Seconds())
+		}
+	}
+	b.updated = now
+}
+
+// full reports whether every bucket is full
+func (b *budget) full() bool {
+	for _, w := range b.windows() {
+		if w.tokens < w.capacity {
+			return false
+		}
+	}
+	return true
+}
+
+// result describes the per-minute bucket, or the per-day one if there's no per-minute limit
+func (b *budget) result() Result {
+	windows := b.windows()
+	if len(windows) == 0 {
+		return Result{}
+	}
+	w := windows[0]
+	return Result{
+		Limit:     int64(w.capacity),
+		Remaining: int64(math.Max(0, math.Floor(w.tokens))),
+		Reset:     w.waitFor(int64(w.capacity)),
+	}
+}
+
+// window is a bucket holding up to capacity tokens that refills at rate tokens a second
+type window struct {
+	capacity float64
+	rate     float64
+	tokens   float64
+}
+
+// resize sets the capacity of the bucket to a budget per period. A new
+// bucket starts full; a resized one keeps the tokens already used.
+func (w *window) resize(capacity float64, period time.Duration) {
+	if capacity == w.capacity {
+		return
+	}
+	used := w.capacity - w.tokens
+	w.capacity = capacity
+	w.rate = capacity / period.Seconds()
+	w.tokens = math.Min(capacity, capacity-used)
+}
+
+// waitFor returns how long until the bucket holds n tokens: zero if it does
+// now, or negative if it never will because n is more than it can hold
+func (w *window) waitFor(n int64) time.Duration {
+	missing := float64(n) - w.tokens
+	switch {
+	case missing <= 0:
+		return 0
+	case float64(n) > w.capacity:
+		return -1
+	default:
+		return time.Duration(math.Ceil(missing / w.rate * float64(time.Second)))
+	}
+}
@@ -0,0 +1,103 @@
+package ratelimit_test
+
+import (
+	"time"
+
+	"go-api/internal/ratelimit"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TokenLimiter", func() {
+	var (
+		now     time.Time
+		limiter *ratelimit.TokenLimiter
+	)
+
+	perMinute := ratelimit.Limits{TokensPerMinute: 6000}
+
+	BeforeEach(func() {
+		now = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		limiter = ratelimit.NewTokenLimiterWithClock(func() time.Time { return now })
+	})
+
+	It("reserves tokens until the budget runs out", func() {
+		result := limiter.Reserve("key_a", perMinute, 4000)
+		Expect(result.Allowed).To(BeTrue())
+		Expect(result.Limit).To(Equal(int64(6000)))
+		Expect(result.Remaining).To(Equal(int64(2000)))
+		Expect(result.Reset).To(Equal(40 * time.Second))
+
+		result = limiter.Reserve("key_a", perMinute, 3000)
+		Expect(result.Allowed).To(BeFalse())
+		Expect(result.Remaining).To(Equal(int64(2000)))
+		Expect(result.RetryAfter).To(Equal(10 * time.Second))
+
+		// Other callers have their own budget
+		Expect(limiter.Reserve("key_b", perMinute, 3000).Allowed).To(BeTrue())
+	})
+
+	It("refills the budget continuously", func() {
+		Expect(limiter.Reserve("key_a", perMinute, 6000).Allowed).To(BeTrue())
+		Expect(limiter.Reserve("key_a", perMinute, 1).Allowed).To(BeFalse())
+
+		now = now.Add(10 * time.Second)
+		result := limiter.Reserve("key_a", perMinute, 1000)
+		Expect(result.Allowed).To(BeTrue())
+		Expect(result.Remaining).To(BeZero())
+	})
+
+	It("reconciles reservations with actual usage", func() {
+		Expect(limiter.Reserve("key_a", perMinute, 5000).Allowed).To(BeTrue())
+
+		// The completion used far fewer tokens than max_tokens allowed
+		limiter.Adjust("key_a", perMinute, 800-5000)
+		Expect(limiter.Reserve("key_a", perMinute, 0).Remaining).To(Equal(int64(5200)))
+
+		// Usage beyond the reservation is charged too
+		limiter.Adjust("key_a", perMinute, 6000)
+		result := limiter.Reserve("key_a", perMinute, 100)
+		Expect(result.Allowed).To(BeFalse())
+		Expect(result.Remaining).To(BeZero())
+
+		// Refunds never grow the budget beyond its limit
+		limiter.Adjust("key_b", perMinute, -10000)
+		Expect(limiter.Reserve("key_b", perMinute, 0).Remaining).To(Equal(int64(6000)))
+	})
+
+	It("rejects requests larger than the budget for good", func() {
+		result := limiter.Reserve("key_a", perMinute, 10000)
+		Expect(result.Allowed).To(BeFalse())
+		Expect(result.RetryAfter).To(BeNumerically("<", 0))
+		Expect(result.Remaining).To(Equal(int64(6000)))
+	})
+
+	It("enforces the daily budget alongside the per-minute one", func() {
+		limits := ratelimit.Limits{TokensPerMinute: 6000, TokensPerDay: 10000}
+		Expect(limiter.Reserve("key_a", limits, 6000).Allowed).To(BeTrue())
+
+		now = now.Add(time.Minute)
+		Expect(limiter.Reserve("key_a", limits, 4000).Allowed).To(BeTrue())
+
+		now = now.Add(time.Minute)
+		result := limiter.Reserve("key_a", limits, 1000)
+		Expect(result.Allowed).To(BeFalse())
+		// Headers describe the per-minute budget, which has refilled
+		Expect(result.Remaining).To(Equal(int64(6000)))
+		Expect(result.RetryAfter).To(BeNumerically(">", time.Minute))
+	})
+
+	It("keeps usage when the limits change", func() {
+		Expect(limiter.Reserve("key_a", perMinute, 5000).Allowed).To(BeTrue())
+
+		result := limiter.Reserve("key_a", ratelimit.Limits{TokensPerMinute: 12000}, 0)
+		Expect(result.Limit).To(Equal(int64(12000)))
+		Expect(result.Remaining).To(Equal(int64(7000)))
+	})
+
+	It("doesn't limit callers without limits", func() {
+		result := limiter.Reserve("key_a", ratelimit.Limits{}, 1_000_000)
+		Expect(result.Allowed).To(BeTrue())
+	})
+})
@@ -0,0 +1,110 @@
+// Package requestid carries the ID of each request from the client, through
+// logs, errors and audit records, to the upstream, and reads back the IDs
+// upstreams give their own requests.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Header carries the request ID, from the client and to the upstream, and back in the response
+	Header = echo.HeaderXRequestID
+
+	// UpstreamHeader reports the ID the upstream gave the request
+	UpstreamHeader = "X-Upstream-Request-ID"
+
+	// ContextKey is the echo context key holding the request ID
+	ContextKey = "request_id"
+
+	// Prefix starts every generated request ID
+	Prefix = "req_"
+
+	// maxLength is the longest request ID accepted from a client
+	maxLength = 128
+)
+
+// upstreamHeaders are the headers upstreams report their request ID in:
+// x-request-id for Groq and OpenAI-compatible servers, request-id for Anthropic
+var upstreamHeaders = []string{"X-Request-Id", "Request-Id"}
+
+// contextKey is the context.Context key holding the request ID
+type contextKey struct{}
+
+// New generates a request ID
+func New() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return Prefix + hex.EncodeToString(b)
+}
+
+// Valid reports whether id, as sent by a client, may be used as the request
+// ID: up to 128 letters, digits and . _ : - characters
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Set records id as the ID of this request: on the echo context, on the
+// request's context.Context for upstream calls, and in the request and
+// response headers for the access log and the client
+func Set(c echo.Context, id string) {
+	c.Set(ContextKey, id)
+	req := c.Request()
+	req.Header.Set(Header, id)
+	c.SetRequest(req.WithContext(WithID(req.Context(), id)))
+	c.Response().Header().Set(Header, id)
+}
+
+// FromEcho returns the ID of this request, or "" if it has none
+func FromEcho(c echo.Context) string {
+	id, _ := c.Get(ContextKey).(string)
+	return id
+}
+
+// WithID returns a copy of ctx carrying id
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or "" if it has none
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Propagate sets the request ID carried by the context of req, an upstream
+// request, in its headers
+func Propagate(req *http.Request) {
+	if id := FromContext(req.Context()); id != "" {
+		req.Header.Set(Header, id)
+	}
+}
+
+// Upstream returns the ID the upstream gave its request, as reported in the
+// headers of its response, or "" if it reported none
+func Upstream(header http.Header) string {
+	for _, name := range upstreamHeaders {
+		if id := header.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package requestid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-api/internal/requestid"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Request IDs", func() {
+	It("generates distinct, valid IDs", func() {
+		first, second := requestid.New(), requestid.New()
+
+		Expect(first).To(HavePrefix(requestid.Prefix))
+		Expect(first).NotTo(Equal(second))
+		Expect(requestid.Valid(first)).To(BeTrue())
+	})
+
+	DescribeTable("accepts only short, plain IDs from clients",
+		func(id string, valid bool) {
+			Expect(requestid.Valid(id)).To(Equal(valid))
+		},
+		Entry("a UUID", "0f8fad5b-d9cb-469f-a165-70867728950e", true),
+		Entry("dots, colons and underscores", "svc.web:trace_42", true),
+		Entry("an empty ID", "", false),
+		Entry("spaces", "req 1", false),
+		Entry("a header injection", "req\r\nX-Admin: 1", false),
+		Entry("quotes", `req"1`, false),
+		Entry("an overlong ID", strings.Repeat("a", 129), false),
+	)
+
+	It("carries the ID on the echo context, the request context and both headers", func() {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/chat/completions", nil), rec)
+
+		requestid.Set(c, "req_1")
+
+		Expect(requestid.FromEcho(c)).To(Equal("req_1"))
+		Expect(requestid.FromContext(c.Request().Context())).To(Equal("req_1"))
+		Expect(c.Request().Header.Get(requestid.Header)).To(Equal("req_1"))
+		Expect(rec.Header().Get(requestid.Header)).To(Equal("req_1"))
+	})
+
+	It("forwards the ID of the request context to upstreams", func() {
+		ctx := requestid.WithID(context.Background(), "req_1")
+		upstream, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://upstream/v1/chat/completions", nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		requestid.Propagate(upstream)
+		Expect(upstream.Header.Get("X-Request-ID")).To(Equal("req_1"))
+
+		bare, err := http.NewRequest(http.MethodPost, "http://upstream/v1/chat/completions", nil)
+		Expect(err).NotTo(HaveOccurred())
+		requestid.Propagate(bare)
+		Expect(bare.Header).NotTo(HaveKey("X-Request-Id"))
+	})
+
+	It("reads the upstream's ID from x-request-id or request-id", func() {
+		Expect(requestid.Upstream(http.Header{"X-Request-Id": {"req_groq"}})).To(Equal("req_groq"))
+		Expect(requestid.Upstream(http.Header{"Request-Id": {"req_anthropic"}})).To(Equal("req_anthropic"))
+		Expect(requestid.Upstream(http.Header{})).To(BeEmpty())
+	})
+})
+
+func TestRequestID(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Request ID Suite")
+}
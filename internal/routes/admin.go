@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"go-api/internal/api"
+	"go-api/internal/middleware"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterAdminRoutes registers the admin API, protected by the admin token
+// @title Admin API Routes
+// @description Routes for managing API keys
+// @Security AdminAuth
+func RegisterAdminRoutes(e *echo.Echo, admin *api.KeyAdmin, token string) {
+	g := e.Group("/admin", middleware.AdminAuth(token))
+
+	g.GET("/keys", admin.ListKeys)
+	g.POST("/keys", admin.CreateKey)
+	g.GET("/keys/:id", admin.GetKey)
+	g.PATCH("/keys/:id", admin.UpdateKey)
+	g.DELETE("/keys/:id", admin.DeleteKey)
+	g.PUT("/keys/:id/quota", admin.SetQuota)
+	g.POST("/keys/:id/rotate", admin.RotateKey)
+	g.POST("/keys/:id/disable", admin.DisableKey)
+	g.POST("/keys/:id/enable", admin.EnableKey)
+}
@@ -1,18 +1,90 @@
 package routes
 
 import (
-	"go-api/internal/handlers"
+	"go-api/internal/api"
+	"go-api/internal/billing"
+	"go-api/internal/keys"
 	"go-api/internal/middleware"
+	"go-api/internal/oidc"
+	"go-api/internal/ratelimit"
 
 	"github.com/labstack/echo/v4"
 )
 
+// ChatOptions holds what the chat routes authenticate and limit callers with
+type ChatOptions struct {
+	// KeyStore holds the static API keys
+	KeyStore *keys.Store
+
+	// Verifier verifies JWTs. Nil accepts API keys only.
+	Verifier *oidc.Verifier
+
+	// RateLimiter limits the request rate of authenticated callers. Nil
+	// limits them with the limits of RatePolicy, kept in memory.
+	RateLimiter echo.MiddlewareFunc
+
+	// TokenLimiter holds the token budgets of callers
+	TokenLimiter *ratelimit.TokenLimiter
+
+	// TokenLimits are the token budgets of callers whose key sets none
+	TokenLimits ratelimit.Limits
+
+	// RatePolicy holds the request rate limits and concurrency caps of
+	// callers. Nil uses the defaults.
+	RatePolicy *ratelimit.Policy
+
+	// ConcurrencyLimiter counts the requests callers have in flight
+	ConcurrencyLimiter *ratelimit.ConcurrencyLimiter
+
+	// Pricing prices completions. Nil costs nothing.
+	Pricing *billing.Pricing
+
+	// Ledger holds what callers have spent. Nil keeps it in memory.
+	Ledger billing.Ledger
+}
+
 // RegisterRoutes registers all chat-related routes
 // @title Chat API Routes
 // @description Routes for chat functionality
 // @Security BearerAuth
-func RegisterRoutes(e *echo.Echo) {
+func RegisterRoutes(e *echo.Echo, chat *api.ChatService, options ChatOptions) {
+	tokenLimiter := options.TokenLimiter
+	if tokenLimiter == nil {
+		tokenLimiter = ratelimit.NewTokenLimiter()
+	}
+	ratePolicy := options.RatePolicy
+	if ratePolicy == nil {
+		ratePolicy = ratelimit.NewPolicy(ratelimit.DefaultConfig())
+	}
+	rateLimiter := options.RateLimiter
+	if rateLimiter == nil {
+		rateLimiter = middleware.RateLimiterWithConfig(&middleware.RateLimiterConfig{Policy: ratePolicy})
+	}
+	concurrencyLimiter := options.ConcurrencyLimiter
+	if concurrencyLimiter == nil {
+		concurrencyLimiter = ratelimit.NewConcurrencyLimiter(nil)
+	}
+
+	pricing := options.Pricing
+	if pricing == nil {
+		pricing = &billing.Pricing{}
+	}
+	ledger := options.Ledger
+	if ledger == nil {
+		ledger = billing.NewMemoryLedger()
+	}
+
 	// Register chat routes
-	// Chat completions endpoint for interacting with Groq API
-	e.POST("/chat/completions", handlers.HandleChatCompletions, middleware.APIKeyAuth())
+	// Chat completions endpoint, routed to the provider configured for each model.
+	// The caller's key is checked first, then its request rate, what the key
+	// allows, its monthly spend and its token budget, and last whether it may
+	// have another request in flight.
+	e.POST("/chat/completions", chat.HandleChatCompletions,
+		middleware.APIKeyAuth(options.KeyStore, options.Verifier),
+		rateLimiter,
+		middleware.AuthorizeChat(),
+		middleware.BudgetEnforcer(ledger, pricing),
+		middleware.TokenRateLimiter(tokenLimiter, options.TokenLimits),
+		middleware.ConcurrencyLimiter(concurrencyLimiter, ratePolicy),
+	)
 }
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"go-api/internal/api"
+	"go-api/internal/keys"
+	"go-api/internal/middleware"
+	"go-api/internal/oidc"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RegisterUsageRoutes registers the usage reports: each caller's own under
+// /v1/usage, limited by rateLimiter unless it is nil, and every key's under
+// /admin/usage when an admin token is set
+// @title Usage API Routes
+// @description Routes for reporting token usage
+func RegisterUsageRoutes(e *echo.Echo, reporter *api.UsageReporter, keyStore *keys.Store, verifier *oidc.Verifier, rateLimiter echo.MiddlewareFunc, adminToken string) {
+	own := []echo.MiddlewareFunc{middleware.APIKeyAuth(keyStore, verifier)}
+	if rateLimiter != nil {
+		own = append(own, rateLimiter)
+	}
+	e.GET("/v1/usage", reporter.OwnUsage, own...)
+
+	if adminToken != "" {
+		e.GET("/admin/usage", reporter.AllUsage, middleware.AdminAuth(adminToken))
+	}
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-api/internal/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Completion traces a chat completion, retries and failover included, with
+// the attributes of the OpenTelemetry GenAI semantic conventions. Its span
+// is the parent of the client spans of each upstream call.
+type Completion struct {
+	span       trace.Span
+	start      time.Time
+	firstToken bool
+}
+
+// StartCompletion starts the span of a completion of req, named
+// "chat {model}" as the conventions ask
+func StartCompletion(ctx context.Context, req *types.ChatRequest) (context.Context, *Completion) {
+	attrs := []attribute.KeyValue{
+		semconv.GenAIOperationNameChat,
+		semconv.GenAIRequestModel(req.Model),
+	}
+	if maxTokens := req.MaxCompletionTokens; maxTokens > 0 {
+		attrs = append(attrs, semconv.GenAIRequestMaxTokens(maxTokens))
+	} else if req.MaxTokens > 0 {
+		attrs = append(attrs, semconv.GenAIRequestMaxTokens(req.MaxTokens))
+	}
+	if req.Temperature != nil {
+		attrs = append(attrs, semconv.GenAIRequestTemperature(*req.Temperature))
+	}
+	if req.TopP != nil {
+		attrs = append(attrs, semconv.GenAIRequestTopP(*req.TopP))
+	}
+
+	ctx, span := Start(ctx, "chat "+req.Model,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx, &Completion{span: span, start: time.Now()}
+}
+
+// Upstream records the upstream that served the completion and the ID it gave the request
+func (t *Completion) Upstream(route, requestID string) {
+	t.span.SetAttributes(UpstreamKey.String(route))
+	if requestID != "" {
+		t.span.SetAttributes(UpstreamRequestIDKey.String(requestID))
+	}
+}
+
+// Chunk notes a chunk of a streamed completion. The first one records the
+// time to first token.
+func (t *Completion) Chunk(*types.ChatCompletionChunk) {
+	if t.firstToken {
+		return
+	}
+	t.firstToken = true
+	ttft := time.Since(t.start)
+	t.span.AddEvent("gen_ai.first_token")
+	t.span.SetAttributes(TimeToFirstTokenKey.Float64(ttft.Seconds()))
+}
+
+// Finish records the id and model of the response, why each choice
+// finished, and the tokens used. Empty values are left out.
+func (t *Completion) Finish(id, model string, choices []types.Choice, u types.Usage) {
+	if id != "" {
+		t.span.SetAttributes(semconv.GenAIResponseID(id))
+	}
+	if model != "" {
+		t.span.SetAttributes(semconv.GenAIResponseModel(model))
+	}
+
+	var reasons []string
+	for _, choice := range choices {
+		if choice.FinishReason != "" {
+			reasons = append(reasons, choice.FinishReason)
+		}
+	}
+	if len(reasons) > 0 {
+		t.span.SetAttributes(semconv.GenAIResponseFinishReasons(reasons...))
+	}
+
+	t.span.SetAttributes(
+		semconv.GenAIUsageInputTokens(u.PromptTokens),
+		semconv.GenAIUsageOutputTokens(u.CompletionTokens),
+	)
+}
+
+// Fail records err as the reason the completion failed
+func (t *Completion) Fail(err error) {
+	t.span.RecordError(err)
+	t.span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span, marking it failed if status, the status sent to the
+// caller, is an error
+func (t *Completion) End(status int) {
+	if status >= http.StatusBadRequest {
+		t.span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+		t.span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	t.span.End()
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartHTTP starts the client span of req, a call to the upstream of the
+// GenAI system named system, such as groq, and writes the span's trace
+// context into the traceparent header of req. The request returned carries
+// the span's context.
+func StartHTTP(req *http.Request, system string) (*http.Request, trace.Span) {
+	ctx, span := Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(req.URL.String()),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.GenAISystemKey.String(system),
+		),
+	)
+	req = req.WithContext(ctx)
+	Propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, span
+}
+
+// EndHTTP records the outcome of a call started with StartHTTP on its span.
+// The span ends once the response body is closed, so that it covers the
+// whole response, or straight away if the call failed.
+func EndHTTP(span trace.Span, resp *http.Response, err error) (*http.Response, error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetAttributes(semconv.ErrorTypeKey.String(strconv.Itoa(resp.StatusCode)))
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+	return resp, nil
+}
+
+// spanBody ends a span when the body it wraps is closed
+type spanBody struct {
+	io.ReadCloser
+	span trace.Span
+	once sync.Once
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.span.End() })
+	return err
+}
@@ -0,0 +1,141 @@
+// Package tracing traces requests with OpenTelemetry: a server span for each
+// request, spans for authentication, rate limiting and chat completions, and
+// client spans for upstream calls, which carry the W3C trace context upstream.
+//
+// Spans are exported over OTLP when the standard OTEL_EXPORTER_OTLP_*
+// environment variables name an endpoint. Otherwise they are not recorded,
+// but trace context from callers is still passed on to upstreams.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TracerName names the tracer of every span the gateway starts
+	TracerName = "go-api"
+
+	// DefaultServiceName is the service.name of the spans when OTEL_SERVICE_NAME is not set
+	DefaultServiceName = "go-api"
+
+	// ProtocolGRPC and ProtocolHTTP are the OTLP protocols spans can be exported with
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http/protobuf"
+)
+
+// Attributes of the gateway's own, beside the OpenTelemetry semantic conventions
+const (
+	RequestIDKey         = attribute.Key("gateway.request_id")
+	KeyIDKey             = attribute.Key("gateway.key_id")
+	UpstreamKey          = attribute.Key("gateway.upstream")
+	UpstreamRequestIDKey = attribute.Key("gateway.upstream_request_id")
+
+	// TimeToFirstTokenKey is how long a stream took to deliver its first chunk, in seconds
+	TimeToFirstTokenKey = attribute.Key("gen_ai.server.time_to_first_token")
+
+	// Rate limit decisions
+	RateLimitAllowedKey   = attribute.Key("gateway.rate_limit.allowed")
+	RateLimitLimitKey     = attribute.Key("gateway.rate_limit.limit")
+	RateLimitRemainingKey = attribute.Key("gateway.rate_limit.remaining")
+	RateLimitRequestedKey = attribute.Key("gateway.rate_limit.requested")
+)
+
+// Propagator reads and writes the W3C traceparent, tracestate and baggage headers
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// Tracer returns the tracer of the gateway, from the global tracer provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// Start starts a span named name, as a child of the span in ctx if there is one
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// Setup installs Propagator as the global propagator and, when the
+// environment configures an OTLP endpoint, a global tracer provider
+// exporting spans to it. The returned function flushes and stops the
+// provider.
+//
+// The exporter is configured by the standard variables:
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,
+// OTEL_EXPORTER_OTLP_PROTOCOL or OTEL_EXPORTER_OTLP_TRACES_PROTOCOL (grpc or
+// http/protobuf, the default), OTEL_EXPORTER_OTLP_HEADERS, OTEL_SERVICE_NAME,
+// OTEL_RESOURCE_ATTRIBUTES and OTEL_TRACES_SAMPLER. OTEL_SDK_DISABLED=true
+// turns exporting off.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(Propagator)
+
+	if !Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx, protocol())
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(DefaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the service: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Enabled reports whether the environment configures an OTLP endpoint to export spans to
+func Enabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// protocol returns the OTLP protocol spans are exported with
+func protocol() string {
+	if p := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"); p != "" {
+		return p
+	}
+	if p := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); p != "" {
+		return p
+	}
+	return ProtocolHTTP
+}
+
+// newExporter creates an OTLP exporter speaking protocol. Its endpoint and
+// headers come from the environment.
+func newExporter(ctx context.Context, protocol string) (sdktrace.SpanExporter, error) {
+	switch protocol {
+	case ProtocolHTTP:
+		return otlptracehttp.New(ctx)
+	case ProtocolGRPC:
+		return otlptracegrpc.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, expected %q or %q", protocol, ProtocolGRPC, ProtocolHTTP)
+	}
+}
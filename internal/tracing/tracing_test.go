@@ -0,0 +1,218 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"go-api/internal/tracing"
+	"go-api/internal/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordSpans installs a tracer provider recording spans in memory for the current spec
+func recordSpans() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	DeferCleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return exporter
+}
+
+// attributes returns the attributes of span as a map
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// setenv sets an environment variable for the current spec
+func setenv(name, value string) {
+	previous, had := os.LookupEnv(name)
+	Expect(os.Setenv(name, value)).To(Succeed())
+	DeferCleanup(func() {
+		if had {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+var _ = Describe("Setup", func() {
+	It("only exports spans when an OTLP endpoint is configured", func() {
+		setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+		Expect(tracing.Enabled()).To(BeFalse())
+
+		setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+		Expect(tracing.Enabled()).To(BeTrue())
+
+		setenv("OTEL_SDK_DISABLED", "true")
+		Expect(tracing.Enabled()).To(BeFalse())
+	})
+
+	It("installs the W3C propagator even when spans aren't exported", func() {
+		setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+		shutdown, err := tracing.Setup(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shutdown(context.Background())).To(Succeed())
+		Expect(otel.GetTextMapPropagator().Fields()).To(ContainElement("traceparent"))
+	})
+
+	It("rejects unknown OTLP protocols", func() {
+		setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+		setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+
+		_, err := tracing.Setup(context.Background())
+		Expect(err).To(MatchError(ContainSubstring(`unsupported OTLP protocol "http/json"`)))
+	})
+})
+
+var _ = Describe("Completion", func() {
+	var exporter *tracetest.InMemoryExporter
+
+	BeforeEach(func() {
+		exporter = recordSpans()
+	})
+
+	It("records the GenAI attributes of a completion", func() {
+		temperature := 0.5
+		req := &types.ChatRequest{Model: "llama-3.3-70b-versatile", MaxTokens: 100, Temperature: &temperature}
+		_, completion := tracing.StartCompletion(context.Background(), req)
+		completion.Upstream("groq/llama-3.3-70b-versatile", "req_groq_1")
+		completion.Finish("chatcmpl-1", "llama-3.3-70b-versatile",
+			[]types.Choice{{FinishReason: "stop"}, {Index: 1, FinishReason: "length"}},
+			types.Usage{PromptTokens: 12, CompletionTokens: 40, TotalTokens: 52})
+		completion.End(http.StatusOK)
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(1))
+		span := spans[0]
+		Expect(span.Name).To(Equal("chat llama-3.3-70b-versatile"))
+		Expect(span.SpanKind).To(Equal(trace.SpanKindClient))
+		Expect(span.Status.Code).To(Equal(codes.Unset))
+
+		attrs := attributes(span)
+		Expect(attrs["gen_ai.operation.name"].AsString()).To(Equal("chat"))
+		Expect(attrs["gen_ai.request.model"].AsString()).To(Equal("llama-3.3-70b-versatile"))
+		Expect(attrs["gen_ai.request.max_tokens"].AsInt64()).To(Equal(int64(100)))
+		Expect(attrs["gen_ai.request.temperature"].AsFloat64()).To(Equal(0.5))
+		Expect(attrs["gen_ai.response.id"].AsString()).To(Equal("chatcmpl-1"))
+		Expect(attrs["gen_ai.response.model"].AsString()).To(Equal("llama-3.3-70b-versatile"))
+		Expect(attrs["gen_ai.response.finish_reasons"].AsStringSlice()).To(Equal([]string{"stop", "length"}))
+		Expect(attrs["gen_ai.usage.input_tokens"].AsInt64()).To(Equal(int64(12)))
+		Expect(attrs["gen_ai.usage.output_tokens"].AsInt64()).To(Equal(int64(40)))
+		Expect(attrs[tracing.UpstreamKey].AsString()).To(Equal("groq/llama-3.3-70b-versatile"))
+		Expect(attrs[tracing.UpstreamRequestIDKey].AsString()).To(Equal("req_groq_1"))
+	})
+
+	It("records the time to first token of streams once", func() {
+		_, completion := tracing.StartCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		completion.Chunk(&types.ChatCompletionChunk{})
+		completion.Chunk(&types.ChatCompletionChunk{})
+		completion.End(http.StatusOK)
+
+		span := exporter.GetSpans()[0]
+		Expect(span.Events).To(HaveLen(1))
+		Expect(span.Events[0].Name).To(Equal("gen_ai.first_token"))
+		Expect(attributes(span)).To(HaveKey(tracing.TimeToFirstTokenKey))
+	})
+
+	It("marks failed completions", func() {
+		_, completion := tracing.StartCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		completion.Fail(errors.New("upstream unavailable"))
+		completion.End(http.StatusServiceUnavailable)
+
+		span := exporter.GetSpans()[0]
+		Expect(span.Status.Code).To(Equal(codes.Error))
+		Expect(attributes(span)["error.type"].AsString()).To(Equal("503"))
+	})
+})
+
+var _ = Describe("StartHTTP", func() {
+	var (
+		exporter    *tracetest.InMemoryExporter
+		traceparent string
+		upstream    *httptest.Server
+	)
+
+	BeforeEach(func() {
+		exporter = recordSpans()
+		traceparent = ""
+		upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			traceparent = r.Header.Get("traceparent")
+			if r.URL.Path == "/missing" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+			io.WriteString(w, "{}")
+		}))
+		DeferCleanup(upstream.Close)
+	})
+
+	call := func(path string) (*http.Response, error) {
+		ctx, parent := tracing.Start(context.Background(), "chat llama")
+		defer parent.End()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL+path, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		req, span := tracing.StartHTTP(req, "groq")
+		resp, err := upstream.Client().Do(req)
+		return tracing.EndHTTP(span, resp, err)
+	}
+
+	It("sends the trace context upstream and ends the span with the response body", func() {
+		resp, err := call("/v1/chat/completions")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exporter.GetSpans()).To(HaveLen(1), "only the parent has ended")
+
+		io.ReadAll(resp.Body)
+		Expect(resp.Body.Close()).To(Succeed())
+
+		spans := exporter.GetSpans()
+		Expect(spans).To(HaveLen(2))
+		client := spans[1]
+		Expect(client.Name).To(Equal(http.MethodPost))
+		Expect(client.SpanKind).To(Equal(trace.SpanKindClient))
+		Expect(client.Parent.SpanID()).To(Equal(spans[0].SpanContext.SpanID()))
+		Expect(traceparent).To(ContainSubstring(client.SpanContext.TraceID().String()))
+		Expect(traceparent).To(ContainSubstring(client.SpanContext.SpanID().String()))
+
+		attrs := attributes(client)
+		Expect(attrs["gen_ai.system"].AsString()).To(Equal("groq"))
+		Expect(attrs["http.request.method"].AsString()).To(Equal(http.MethodPost))
+		Expect(attrs["http.response.status_code"].AsInt64()).To(Equal(int64(http.StatusOK)))
+		Expect(attrs["server.address"].AsString()).To(Equal("127.0.0.1"))
+	})
+
+	It("marks error responses", func() {
+		resp, err := call("/missing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+
+		client := exporter.GetSpans()[1]
+		Expect(client.Status.Code).To(Equal(codes.Error))
+		Expect(attributes(client)["error.type"].AsString()).To(Equal("404"))
+	})
+})
+
+func TestTracing(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Tracing Suite")
+}
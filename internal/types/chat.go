@@ -1,5 +1,12 @@
 package types
 
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
 // Message represents a chat message with role and content
 // @Description A message in a chat conversation
 type Message struct {
@@ -9,6 +16,144 @@ type Message struct {
 	// Content of the message
 	// example: Hello, how are you today?
 	Content string `json:"content" example:"Hello, how are you today?"`
+	// Name of the participant, or of the function for legacy function messages
+	Name string `json:"name,omitempty"`
+	// Tool calls made by an assistant message
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ID of the tool call a tool message responds to
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	// Parts holds the content when it was sent as an array of parts, such as text and images.
+	// When set it takes precedence over Content.
+	Parts []ContentPart `json:"-"`
+	// Extra holds any fields not listed above, so they reach the upstream unchanged
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Message roles
+const (
+	RoleSystem    = "system"
+	RoleDeveloper = "developer"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// ToolCall is a call the model made to one of the request's tools
+type ToolCall struct {
+	ID string `json:"id"`
+	// Type is always function
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall is the function and arguments of a tool call
+type FunctionCall struct {
+	Name string `json:"name"`
+	// Arguments is a JSON object encoded as a string
+	Arguments string `json:"arguments"`
+}
+
+// ContentPart is one part of a multi-part message
+type ContentPart struct {
+	// Type is text, image_url or input_audio
+	Type       string      `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+}
+
+type ImageURL struct {
+	// URL is an http(s) URL or a base64 data URL
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type InputAudio struct {
+	// Data is base64-encoded audio
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+// messageFields are the JSON names of Message's typed fields
+var messageFields = jsonFieldNames(reflect.TypeOf(Message{}))
+
+// Text returns the message text, joining the text parts of multi-part content
+func (m Message) Text() string {
+	if m.Parts == nil {
+		return m.Content
+	}
+
+	var text []string
+	for _, part := range m.Parts {
+		if part.Type == "text" {
+			text = append(text, part.Text)
+		}
+	}
+	return strings.Join(text, "\n")
+}
+
+// UnmarshalJSON accepts content as either a string or an array of parts
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type plain Message
+	var raw struct {
+		plain
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Message(raw.plain)
+
+	content := raw.Content
+	switch {
+	case len(content) == 0 || isJSONNull(content):
+	case content[0] == '"':
+		if err := json.Unmarshal(content, &m.Content); err != nil {
+			return err
+		}
+	case content[0] == '[':
+		if err := json.Unmarshal(content, &m.Parts); err != nil {
+			return err
+		}
+		if m.Parts == nil {
+			m.Parts = []ContentPart{}
+		}
+	default:
+		return fmt.Errorf("message content must be a string or an array of content parts")
+	}
+
+	extra, err := extraFields(data, messageFields)
+	if err != nil {
+		return err
+	}
+	m.Extra = extra
+
+	return nil
+}
+
+// MarshalJSON writes content as an array of parts if the message has any,
+// as null for assistant messages that only call tools, and as a string otherwise
+func (m Message) MarshalJSON() ([]byte, error) {
+	type plain Message
+	var out struct {
+		plain
+		Content interface{} `json:"content"`
+	}
+	out.plain = plain(m)
+	switch {
+	case m.Parts != nil:
+		out.Content = m.Parts
+	case m.Content == "" && len(m.ToolCalls) > 0:
+		out.Content = nil
+	default:
+		out.Content = m.Content
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return mergeExtra(data, m.Extra)
 }
 
 type Usage struct {
@@ -40,6 +185,8 @@ type ErrorResponse struct {
 		Param   string      `json:"param,omitempty"`
 		Code    interface{} `json:"code,omitempty"`
 	} `json:"error"`
+	// ID of the request, to quote when reporting a problem
+	RequestID string `json:"request_id,omitempty" example:"req_6f1c0a9e2b7d4c3a8e5f1b2d"`
 }
 
 // ChatRequest represents a chat completion request
@@ -49,22 +196,185 @@ type ChatRequest struct {
 	Messages []Message `json:"messages" example:"[{\"role\":\"user\",\"content\":\"Tell me about artificial intelligence\"}]"`
 	// Model ID to use for completion
 	Model string `json:"model" example:"deepseek-r1-distill-llama-70b"`
-	// Sampling temperature between 0 and 2
-	Temperature float64 `json:"temperature,omitempty" example:"0.7"`
+	// Sampling temperature between 0 and 2. Nil leaves the upstream's default; 0 is sent.
+	Temperature *float64 `json:"temperature,omitempty" example:"0.7"`
 	// Maximum number of tokens to generate
 	MaxTokens int `json:"max_tokens,omitempty" example:"100"`
 	// Nucleus sampling parameter
-	TopP float64 `json:"top_p,omitempty" example:"1.0"`
+	TopP *float64 `json:"top_p,omitempty" example:"1.0"`
 	// Frequency penalty for token generation
-	FrequencyPenalty float64 `json:"frequency_penalty,omitempty" example:"0"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty" example:"0"`
 	// Presence penalty for token generation
-	PresencePenalty float64 `json:"presence_penalty,omitempty" example:"0"`
+	PresencePenalty *float64 `json:"presence_penalty,omitempty" example:"0"`
 	// Whether to stream the response
 	Stream bool `json:"stream,omitempty" example:"false"`
-	// Sequences to stop generation
+	// Sequences to stop generation, sent as a string or an array
 	Stop []string `json:"stop,omitempty" example:"[\"END\",\"STOP\"]"`
 	// Number of completions to generate
 	N int `json:"n,omitempty" example:"1"`
 	// Optional user identifier
 	User string `json:"user,omitempty" example:"user123"`
+	// Upper bound on generated tokens, including reasoning tokens. Supersedes max_tokens.
+	MaxCompletionTokens int `json:"max_completion_tokens,omitempty" example:"100"`
+	// Tools the model may call
+	Tools []Tool `json:"tools,omitempty"`
+	// Controls which tool, if any, the model calls
+	ToolChoice *ToolChoice `json:"tool_choice,omitempty" swaggertype:"string" example:"auto"`
+	// Whether the model may call several tools at once
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty" example:"true"`
+	// Constrains the output to JSON
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	// Seed for best-effort deterministic sampling
+	Seed *int64 `json:"seed,omitempty" example:"42"`
+	// Whether to return log probabilities of the output tokens
+	Logprobs bool `json:"logprobs,omitempty" example:"false"`
+	// Number of most likely tokens to return at each position, requires logprobs
+	TopLogprobs *int `json:"top_logprobs,omitempty" example:"5"`
+	// Bias added to the logits of the given token IDs, from -100 to 100
+	LogitBias map[string]float64 `json:"logit_bias,omitempty"`
+	// Options for streaming responses
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	// Extra holds any fields not listed above, so they reach the upstream unchanged
+	Extra map[string]json.RawMessage `json:"-" swaggerignore:"true"`
+}
+
+// chatRequestFields are the JSON names of ChatRequest's typed fields
+var chatRequestFields = jsonFieldNames(reflect.TypeOf(ChatRequest{}))
+
+// UnmarshalJSON decodes the request, keeping unknown fields in Extra. stop
+// may be a single string or an array of them.
+func (r *ChatRequest) UnmarshalJSON(data []byte) error {
+	type plain ChatRequest
+	aux := struct {
+		*plain
+		Stop json.RawMessage `json:"stop"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	stop, err := decodeStop(aux.Stop)
+	if err != nil {
+		return err
+	}
+	r.Stop = stop
+
+	extra, err := extraFields(data, chatRequestFields)
+	if err != nil {
+		return err
+	}
+	r.Extra = extra
+
+	return nil
+}
+
+// decodeStop accepts both the string and the array form of stop
+func decodeStop(data json.RawMessage) ([]string, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	if data[0] == '"' {
+		var stop string
+		if err := json.Unmarshal(data, &stop); err != nil {
+			return nil, err
+		}
+		return []string{stop}, nil
+	}
+
+	var stop []string
+	if err := json.Unmarshal(data, &stop); err != nil {
+		return nil, fmt.Errorf("stop must be a string or an array of strings: %w", err)
+	}
+	return stop, nil
+}
+
+// MarshalJSON encodes the request, including the unknown fields in Extra
+func (r ChatRequest) MarshalJSON() ([]byte, error) {
+	type plain ChatRequest
+	data, err := json.Marshal(plain(r))
+	if err != nil {
+		return nil, err
+	}
+	return mergeExtra(data, r.Extra)
+}
+
+// Tool is a tool the model may call
+type Tool struct {
+	// Type is always function
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition describes a function the model may call
+type FunctionDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON Schema of the function's arguments
+	Parameters json.RawMessage `json:"parameters,omitempty" swaggertype:"object"`
+	Strict     *bool           `json:"strict,omitempty"`
+}
+
+// ToolChoice is either a mode (none, auto or required) or a specific function to call
+type ToolChoice struct {
+	// Mode is none, auto or required. Empty when Function is set.
+	Mode string
+	// Function names the function the model must call
+	Function *ToolChoiceFunction
+}
+
+type ToolChoiceFunction struct {
+	Name string `json:"name"`
+}
+
+// toolChoiceObject is the object form of tool_choice
+type toolChoiceObject struct {
+	Type     string              `json:"type"`
+	Function *ToolChoiceFunction `json:"function,omitempty"`
+}
+
+// UnmarshalJSON accepts both the string and the object form
+func (t *ToolChoice) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*t = ToolChoice{}
+		return json.Unmarshal(data, &t.Mode)
+	}
+
+	var obj toolChoiceObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("tool_choice must be a string or an object: %w", err)
+	}
+	*t = ToolChoice{Function: obj.Function}
+	if obj.Function == nil {
+		t.Mode = obj.Type
+	}
+	return nil
+}
+
+// MarshalJSON writes modes as strings and function choices as objects
+func (t ToolChoice) MarshalJSON() ([]byte, error) {
+	if t.Function == nil {
+		return json.Marshal(t.Mode)
+	}
+	return json.Marshal(toolChoiceObject{Type: "function", Function: t.Function})
+}
+
+// ResponseFormat constrains the model's output
+type ResponseFormat struct {
+	// Type is text, json_object or json_schema
+	Type       string            `json:"type" example:"json_object"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat is the schema for the json_schema response format
+type JSONSchemaFormat struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty" swaggertype:"object"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// StreamOptions are options for streaming responses
+type StreamOptions struct {
+	// IncludeUsage asks for a final chunk reporting token usage
+	IncludeUsage bool `json:"include_usage"`
 }
@@ -0,0 +1,130 @@
+package types_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go-api/internal/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChatRequest", func() {
+	It("decodes the full OpenAI schema", func() {
+		var req types.ChatRequest
+		Expect(json.Unmarshal([]byte(`{
+			"model": "llama",
+			"messages": [{"role": "user", "content": "hi"}],
+			"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}],
+			"tool_choice": {"type": "function", "function": {"name": "get_weather"}},
+			"parallel_tool_calls": false,
+			"response_format": {"type": "json_schema", "json_schema": {"name": "weather", "schema": {"type": "object"}, "strict": true}},
+			"seed": 42,
+			"logprobs": true,
+			"top_logprobs": 3,
+			"logit_bias": {"50256": -100},
+			"stream_options": {"include_usage": true},
+			"max_completion_tokens": 256
+		}`), &req)).To(Succeed())
+
+		Expect(req.Tools[0].Function.Name).To(Equal("get_weather"))
+		Expect(req.ToolChoice.Function.Name).To(Equal("get_weather"))
+		Expect(*req.ParallelToolCalls).To(BeFalse())
+		Expect(req.ResponseFormat.JSONSchema.Name).To(Equal("weather"))
+		Expect(*req.Seed).To(BeEquivalentTo(42))
+		Expect(*req.TopLogprobs).To(Equal(3))
+		Expect(req.LogitBias).To(HaveKeyWithValue("50256", -100.0))
+		Expect(req.StreamOptions.IncludeUsage).To(BeTrue())
+		Expect(req.MaxCompletionTokens).To(Equal(256))
+		Expect(req.Extra).To(BeNil())
+	})
+
+	It("passes unknown fields through", func() {
+		var req types.ChatRequest
+		Expect(json.Unmarshal([]byte(`{"model": "llama", "messages": [], "reasoning_effort": "low", "metadata": {"a": 1}}`), &req)).To(Succeed())
+		Expect(req.Extra).To(HaveKey("reasoning_effort"))
+
+		req.Model = "llama-3.3-70b-versatile"
+		data, err := json.Marshal(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"model": "llama-3.3-70b-versatile", "messages": [], "reasoning_effort": "low", "metadata": {"a": 1}}`))
+	})
+
+	It("keeps sampling parameters set to zero", func() {
+		var req types.ChatRequest
+		Expect(json.Unmarshal([]byte(`{"model": "llama", "messages": [], "temperature": 0, "top_p": 0, "frequency_penalty": 0, "presence_penalty": 0}`), &req)).To(Succeed())
+		Expect(req.Temperature).To(HaveValue(BeZero()))
+		Expect(req.TopP).To(HaveValue(BeZero()))
+		Expect(req.FrequencyPenalty).To(HaveValue(BeZero()))
+		Expect(req.PresencePenalty).To(HaveValue(BeZero()))
+
+		data, err := json.Marshal(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"model": "llama", "messages": [], "temperature": 0, "top_p": 0, "frequency_penalty": 0, "presence_penalty": 0}`))
+
+		// Parameters left out stay out
+		req = types.ChatRequest{Model: "llama", Messages: []types.Message{}}
+		data, err = json.Marshal(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"model": "llama", "messages": []}`))
+	})
+
+	It("accepts stop as a string or an array", func() {
+		var req types.ChatRequest
+		Expect(json.Unmarshal([]byte(`{"model": "llama", "messages": [], "stop": "END"}`), &req)).To(Succeed())
+		Expect(req.Stop).To(Equal([]string{"END"}))
+		Expect(req.Extra).To(BeNil())
+
+		req = types.ChatRequest{}
+		Expect(json.Unmarshal([]byte(`{"model": "llama", "messages": [], "stop": ["END", "STOP"]}`), &req)).To(Succeed())
+		Expect(req.Stop).To(Equal([]string{"END", "STOP"}))
+
+		Expect(json.Unmarshal([]byte(`{"model": "llama", "messages": [], "stop": 1}`), &req)).
+			To(MatchError(ContainSubstring("stop must be a string or an array of strings")))
+	})
+
+	It("keeps tool_choice modes as strings", func() {
+		var req types.ChatRequest
+		Expect(json.Unmarshal([]byte(`{"model": "llama", "messages": [], "tool_choice": "required"}`), &req)).To(Succeed())
+		Expect(req.ToolChoice.Mode).To(Equal("required"))
+
+		data, err := json.Marshal(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"tool_choice":"required"`))
+	})
+})
+
+var _ = Describe("Message", func() {
+	It("accepts string content", func() {
+		var m types.Message
+		Expect(json.Unmarshal([]byte(`{"role": "user", "content": "hello"}`), &m)).To(Succeed())
+		Expect(m.Content).To(Equal("hello"))
+		Expect(m.Parts).To(BeNil())
+		Expect(m.Text()).To(Equal("hello"))
+	})
+
+	It("accepts and re-encodes content parts", func() {
+		input := `{"role": "user", "content": [{"type": "text", "text": "What is this?"}, {"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}}]}`
+
+		var m types.Message
+		Expect(json.Unmarshal([]byte(input), &m)).To(Succeed())
+		Expect(m.Parts).To(HaveLen(2))
+		Expect(m.Parts[1].ImageURL.URL).To(Equal("https://example.com/cat.png"))
+		Expect(m.Text()).To(Equal("What is this?"))
+
+		data, err := json.Marshal(m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(input))
+	})
+
+	It("rejects content of other types", func() {
+		var m types.Message
+		Expect(json.Unmarshal([]byte(`{"role": "user", "content": 5}`), &m)).NotTo(Succeed())
+	})
+})
+
+func TestTypes(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Types Suite")
+}
@@ -0,0 +1,63 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// jsonFieldNames returns the JSON member names of the fields of struct type t
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// extraFields returns the members of the JSON object data that aren't in known,
+// or nil if there are none
+func extraFields(data []byte, known map[string]bool) (map[string]json.RawMessage, error) {
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	for name := range all {
+		if known[name] {
+			delete(all, name)
+		}
+	}
+	if len(all) == 0 {
+		return nil, nil
+	}
+	return all, nil
+}
+
+// mergeExtra adds the extra members to the JSON object data. Members already
+// in data win, so extras can never override a typed field.
+func mergeExtra(data []byte, extra map[string]json.RawMessage) ([]byte, error) {
+	if len(extra) == 0 {
+		return data, nil
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, ok := all[name]; !ok {
+			all[name] = value
+		}
+	}
+	return json.Marshal(all)
+}
+
+// isJSONNull reports whether data is the JSON null literal
+func isJSONNull(data []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+}
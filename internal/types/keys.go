@@ -0,0 +1,83 @@
+package types
+
+import "time"
+
+// APIKey is an API key as shown by the admin API. The secret and its hash are never included.
+type APIKey struct {
+	ID              string      `json:"id" example:"key_3f2a9c1b7d4e"`
+	Object          string      `json:"object" example:"api_key"`
+	Prefix          string      `json:"prefix" example:"scarlett-AbCdEfGh"`
+	Owner           string      `json:"owner,omitempty" example:"alice"`
+	Team            string      `json:"team,omitempty" example:"search"`
+	Label           string      `json:"label,omitempty" example:"staging"`
+	CreatedAt       *time.Time  `json:"created_at,omitempty"`
+	ExpiresAt       *time.Time  `json:"expires_at,omitempty"`
+	Disabled        bool        `json:"disabled"`
+	AllowedModels   []string    `json:"allowed_models,omitempty"`
+	MaxTokens       int         `json:"max_tokens,omitempty" example:"1024"`
+	AllowedFeatures []string    `json:"allowed_features,omitempty" example:"streaming"`
+	RateLimitTier   string      `json:"rate_limit_tier,omitempty" example:"free"`
+	Quota           APIKeyQuota `json:"quota"`
+	AuditOptOut     bool        `json:"audit_opt_out,omitempty"`
+}
+
+// APIKeyQuota holds the per-key rate limits and monthly budgets. Zero fields use the server defaults.
+type APIKeyQuota struct {
+	RequestsPerSecond     float64 `json:"requests_per_second,omitempty" example:"5"`
+	Burst                 int     `json:"burst,omitempty" example:"10"`
+	TokensPerMinute       int64   `json:"tokens_per_minute,omitempty" example:"60000"`
+	TokensPerDay          int64   `json:"tokens_per_day,omitempty" example:"2000000"`
+	MaxConcurrentRequests int     `json:"max_concurrent_requests,omitempty" example:"4"`
+	MonthlyBudgetUSD      float64 `json:"monthly_budget_usd,omitempty" example:"100"`
+	MonthlySoftBudgetUSD  float64 `json:"monthly_soft_budget_usd,omitempty" example:"80"`
+}
+
+// APIKeyWithSecret is returned when a key is created or rotated. The secret
+// is only ever shown in this response.
+type APIKeyWithSecret struct {
+	APIKey
+	Key string `json:"key" example:"scarlett-AbCdEfGhIjKlMnOpQrStUvWxYz0123456789abcd"`
+}
+
+// APIKeyList is the response of the key list endpoint
+type APIKeyList struct {
+	Object string   `json:"object" example:"list"`
+	Data   []APIKey `json:"data"`
+}
+
+// DeletedAPIKey is the response of the key delete endpoint
+type DeletedAPIKey struct {
+	ID      string `json:"id" example:"key_3f2a9c1b7d4e"`
+	Object  string `json:"object" example:"api_key"`
+	Deleted bool   `json:"deleted" example:"true"`
+}
+
+// CreateAPIKeyRequest is the body of the key create endpoint
+type CreateAPIKeyRequest struct {
+	Owner           string      `json:"owner,omitempty" example:"alice"`
+	Team            string      `json:"team,omitempty" example:"search"`
+	Label           string      `json:"label,omitempty" example:"staging"`
+	ExpiresAt       *time.Time  `json:"expires_at,omitempty"`
+	AllowedModels   []string    `json:"allowed_models,omitempty"`
+	MaxTokens       int         `json:"max_tokens,omitempty" example:"1024"`
+	AllowedFeatures []string    `json:"allowed_features,omitempty" example:"streaming"`
+	RateLimitTier   string      `json:"rate_limit_tier,omitempty" example:"free"`
+	Quota           APIKeyQuota `json:"quota"`
+	AuditOptOut     bool        `json:"audit_opt_out,omitempty"`
+}
+
+// UpdateAPIKeyRequest is the body of the key update endpoint. Only the fields
+// present are changed; a zero expires_at removes the expiry.
+type UpdateAPIKeyRequest struct {
+	Owner           *string      `json:"owner,omitempty"`
+	Team            *string      `json:"team,omitempty"`
+	Label           *string      `json:"label,omitempty"`
+	ExpiresAt       *time.Time   `json:"expires_at,omitempty"`
+	Disabled        *bool        `json:"disabled,omitempty"`
+	AllowedModels   *[]string    `json:"allowed_models,omitempty"`
+	MaxTokens       *int         `json:"max_tokens,omitempty"`
+	AllowedFeatures *[]string    `json:"allowed_features,omitempty"`
+	RateLimitTier   *string      `json:"rate_limit_tier,omitempty"`
+	Quota           *APIKeyQuota `json:"quota,omitempty"`
+	AuditOptOut     *bool        `json:"audit_opt_out,omitempty"`
+}
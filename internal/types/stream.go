@@ -0,0 +1,139 @@
+package types
+
+// ChatCompletionChunk is a single event of a streamed chat completion
+type ChatCompletionChunk struct {
+	ID                string        `json:"id"`
+	Object            string        `json:"object"`
+	Created           int64         `json:"created"`
+	Model             string        `json:"model"`
+	SystemFingerprint string        `json:"system_fingerprint,omitempty"`
+	Choices           []ChunkChoice `json:"choices"`
+	// Usage is only set on the final chunk, and only by upstreams that report it
+	Usage *Usage `json:"usage,omitempty"`
+	// XGroq carries Groq's extensions; its final chunk reports usage here
+	XGroq *XGroq `json:"x_groq,omitempty"`
+}
+
+// XGroq holds Groq-specific chunk fields
+type XGroq struct {
+	ID    string `json:"id,omitempty"`
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+type ChunkChoice struct {
+	Index        int        `json:"index"`
+	Delta        ChunkDelta `json:"delta"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+// ChunkDelta is the part of a message added by a chunk
+type ChunkDelta struct {
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ToolCallDelta is a fragment of a tool call. The first fragment of each call
+// carries its ID and function name; later ones append to the arguments.
+type ToolCallDelta struct {
+	// Index identifies the tool call within the choice
+	Index    int               `json:"index"`
+	ID       string            `json:"id,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	Function FunctionCallDelta `json:"function"`
+}
+
+type FunctionCallDelta struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// StreamAccumulator reassembles the choices of a streamed completion, including
+// tool calls split across many chunks. Deltas for a choice the request didn't
+// ask for, with an index below 0 or at least N, are ignored.
+type StreamAccumulator struct {
+	// N is how many choices the request asked for. Zero means one.
+	N int
+
+	choices []*Choice
+	// toolCalls maps choice index to tool call index to its position in the choice's ToolCalls
+	toolCalls map[int]map[int]int
+}
+
+// Add merges a chunk into the completion
+func (a *StreamAccumulator) Add(chunk *ChatCompletionChunk) {
+	for _, delta := range chunk.Choices {
+		if !a.requested(delta.Index) {
+			continue
+		}
+		choice := a.choice(delta.Index)
+
+		if delta.Delta.Role != "" {
+			choice.Message.Role = delta.Delta.Role
+		}
+		choice.Message.Content += delta.Delta.Content
+		if delta.FinishReason != nil {
+			choice.FinishReason = *delta.FinishReason
+		}
+
+		for _, tc := range delta.Delta.ToolCalls {
+			call := a.toolCall(delta.Index, tc.Index)
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Type != "" {
+				call.Type = tc.Type
+			}
+			if tc.Function.Name != "" {
+				call.Function.Name = tc.Function.Name
+			}
+			call.Function.Arguments += tc.Function.Arguments
+		}
+	}
+}
+
+// Choices returns the completion's choices assembled so far, ordered by index
+func (a *StreamAccumulator) Choices() []Choice {
+	choices := make([]Choice, 0, len(a.choices))
+	for _, choice := range a.choices {
+		if choice != nil {
+			choices = append(choices, *choice)
+		}
+	}
+	return choices
+}
+
+// requested reports whether the request asked for the choice with the given index
+func (a *StreamAccumulator) requested(index int) bool {
+	return index >= 0 && index < max(a.N, 1)
+}
+
+// choice returns the choice with the given index, creating it if needed
+func (a *StreamAccumulator) choice(index int) *Choice {
+	for len(a.choices) <= index {
+		a.choices = append(a.choices, nil)
+	}
+	if a.choices[index] == nil {
+		a.choices[index] = &Choice{Index: index, Message: Message{Role: RoleAssistant}}
+	}
+	return a.choices[index]
+}
+
+// toolCall returns the tool call with the given index within a choice, creating it if needed
+func (a *StreamAccumulator) toolCall(choiceIndex, callIndex int) *ToolCall {
+	if a.toolCalls == nil {
+		a.toolCalls = make(map[int]map[int]int)
+	}
+	if a.toolCalls[choiceIndex] == nil {
+		a.toolCalls[choiceIndex] = make(map[int]int)
+	}
+
+	choice := a.choice(choiceIndex)
+	pos, ok := a.toolCalls[choiceIndex][callIndex]
+	if !ok {
+		pos = len(choice.Message.ToolCalls)
+		choice.Message.ToolCalls = append(choice.Message.ToolCalls, ToolCall{Type: "function"})
+		a.toolCalls[choiceIndex][callIndex] = pos
+	}
+	return &choice.Message.ToolCalls[pos]
+}
@@ -0,0 +1,66 @@
+package types_test
+
+import (
+	"encoding/json"
+
+	"go-api/internal/types"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StreamAccumulator", func() {
+	It("reassembles tool calls split across chunks", func() {
+		chunks := []string{
+			`{"choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		}
+
+		var acc types.StreamAccumulator
+		for _, data := range chunks {
+			var chunk types.ChatCompletionChunk
+			Expect(json.Unmarshal([]byte(data), &chunk)).To(Succeed())
+			acc.Add(&chunk)
+		}
+
+		choices := acc.Choices()
+		Expect(choices).To(HaveLen(1))
+		Expect(choices[0].FinishReason).To(Equal("tool_calls"))
+		Expect(choices[0].Message.ToolCalls).To(Equal([]types.ToolCall{
+			{ID: "call_1", Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+			{ID: "call_2", Type: "function", Function: types.FunctionCall{Name: "get_time", Arguments: `{}`}},
+		}))
+	})
+
+	It("ignores choices the request didn't ask for", func() {
+		chunks := []string{
+			`{"choices":[{"index":-1,"delta":{"content":"bad"}}]}`,
+			`{"choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"}},{"index":1,"delta":{"content":"Hello"}}]}`,
+			`{"choices":[{"index":2,"delta":{"content":"extra"}},{"index":1000000000,"delta":{"content":"huge"}}]}`,
+		}
+
+		acc := types.StreamAccumulator{N: 2}
+		for _, data := range chunks {
+			var chunk types.ChatCompletionChunk
+			Expect(json.Unmarshal([]byte(data), &chunk)).To(Succeed())
+			Expect(func() { acc.Add(&chunk) }).NotTo(Panic())
+		}
+
+		choices := acc.Choices()
+		Expect(choices).To(HaveLen(2))
+		Expect(choices[0].Message.Content).To(Equal("Hi"))
+		Expect(choices[1].Message.Content).To(Equal("Hello"))
+	})
+
+	It("encodes tool-only assistant messages with null content", func() {
+		data, err := json.Marshal(types.Message{
+			Role:      types.RoleAssistant,
+			ToolCalls: []types.ToolCall{{ID: "call_1", Type: "function", Function: types.FunctionCall{Name: "f", Arguments: "{}"}}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"content":null`))
+	})
+})
@@ -0,0 +1,24 @@
+package types
+
+import "time"
+
+// UsageBucket is the usage of one key and model in one hour or day
+type UsageBucket struct {
+	Start            time.Time `json:"start" example:"2025-01-01T00:00:00Z"`
+	KeyID            string    `json:"key_id" example:"key_3f2a9c1b7d4e"`
+	Team             string    `json:"team,omitempty" example:"search"`
+	Model            string    `json:"model" example:"llama-3.3-70b-versatile"`
+	Requests         int64     `json:"requests" example:"42"`
+	PromptTokens     int64     `json:"prompt_tokens" example:"12000"`
+	CompletionTokens int64     `json:"completion_tokens" example:"3400"`
+	TotalTokens      int64     `json:"total_tokens" example:"15400"`
+}
+
+// UsageReport is the response of the usage endpoints
+type UsageReport struct {
+	Object string        `json:"object" example:"list"`
+	Bucket string        `json:"bucket" example:"day"`
+	Start  time.Time     `json:"start" example:"2025-01-01T00:00:00Z"`
+	End    time.Time     `json:"end" example:"2025-02-01T00:00:00Z"`
+	Data   []UsageBucket `json:"data"`
+}
@@ -0,0 +1,215 @@
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go-api/internal/types"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket sizes usage can be reported in
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+)
+
+// hourFormat is the layout of the hour each entry is stored under. It sorts in time order.
+const hourFormat = "2006-01-02T15"
+
+// usageBucket is the bucket usage is stored in, by hour, key and model
+var usageBucket = []byte("usage")
+
+// Record is the usage of one completion
+type Record struct {
+	// Time is when the completion finished
+	Time time.Time
+
+	// KeyID and Team identify the caller
+	KeyID string
+	Team  string
+
+	// Model is the model the caller asked for
+	Model string
+
+	Usage types.Usage
+}
+
+// Query selects the usage to report
+type Query struct {
+	// Start and End bound the time range, from Start up to but not including End
+	Start time.Time
+	End   time.Time
+
+	// Bucket is BucketHour or BucketDay
+	Bucket string
+
+	// KeyID, Team and Model select only the usage of one key, team or model. Empty selects all.
+	KeyID string
+	Team  string
+	Model string
+}
+
+// Store keeps the usage of every completion, added up by hour, key and model,
+// in an embedded BoltDB database so it survives restarts
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens the usage database at path, creating it if it doesn't exist
+func OpenStore(path string) (*Store, error) {
+	// Fail rather than hang if another process holds the database
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(usageBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// entry is what is stored for one hour, key and model
+type entry struct {
+	Team             string `json:"team,omitempty"`
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+}
+
+// Record adds the usage of a completion. Concurrent calls are written to
+// the database together.
+func (s *Store) Record(r Record) error {
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usageBucket)
+		id := entryKey(r.Time, r.KeyID, r.Model)
+
+		var e entry
+		if data := bucket.Get(id); data != nil {
+			if err := json.Unmarshal(data, &e); err != nil {
+				return err
+			}
+		}
+		e.Team = r.Team
+		e.Requests++
+		e.PromptTokens += int64(r.Usage.PromptTokens)
+		e.CompletionTokens += int64(r.Usage.CompletionTokens)
+		e.TotalTokens += int64(r.Usage.TotalTokens)
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(id, data)
+	})
+}
+
+// Query returns the usage matching q, added up by bucket, key and model, in
+// time order and then by key and model
+func (s *Store) Query(q Query) ([]types.UsageBucket, error) {
+	truncate := truncateHour
+	if q.Bucket == BucketDay {
+		truncate = truncateDay
+	}
+
+	buckets := make(map[[3]string]*types.UsageBucket)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(usageBucket).Cursor()
+		start := []byte(q.Start.UTC().Format(hourFormat))
+		for k, v := cursor.Seek(start); k != nil; k, v = cursor.Next() {
+			hour, keyID, model, err := parseEntryKey(k)
+			if err != nil {
+				return err
+			}
+			if !hour.Before(q.End) {
+				break
+			}
+			if hour.Before(q.Start) || (q.KeyID != "" && keyID != q.KeyID) || (q.Model != "" && model != q.Model) {
+				continue
+			}
+
+			var e entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if q.Team != "" && e.Team != q.Team {
+				continue
+			}
+
+			bucketStart := truncate(hour)
+			id := [3]string{bucketStart.Format(time.RFC3339), keyID, model}
+			b, ok := buckets[id]
+			if !ok {
+				b = &types.UsageBucket{Start: bucketStart, KeyID: keyID, Model: model}
+				buckets[id] = b
+			}
+			b.Team = e.Team
+			b.Requests += e.Requests
+			b.PromptTokens += e.PromptTokens
+			b.CompletionTokens += e.CompletionTokens
+			b.TotalTokens += e.TotalTokens
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := make([]types.UsageBucket, 0, len(buckets))
+	for _, b := range buckets {
+		report = append(report, *b)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		if a.KeyID != b.KeyID {
+			return a.KeyID < b.KeyID
+		}
+		return a.Model < b.Model
+	})
+	return report, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// entryKey is the database key of the usage of keyID and model in the hour holding t
+func entryKey(t time.Time, keyID, model string) []byte {
+	return []byte(t.UTC().Format(hourFormat) + "\x00" + keyID + "\x00" + model)
+}
+
+// parseEntryKey splits a database key made by entryKey
+func parseEntryKey(k []byte) (time.Time, string, string, error) {
+	parts := bytes.SplitN(k, []byte{0}, 3)
+	if len(parts) != 3 {
+		return time.Time{}, "", "", fmt.Errorf("malformed usage entry %q", k)
+	}
+	hour, err := time.Parse(hourFormat, string(parts[0]))
+	if err != nil {
+		return time.Time{}, "", "", fmt.Errorf("malformed usage entry %q: %w", k, err)
+	}
+	return hour, string(parts[1]), string(parts[2]), nil
+}
+
+func truncateHour(t time.Time) time.Time {
+	return t.Truncate(time.Hour)
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,121 @@
+package usage_test
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go-api/internal/types"
+	"go-api/internal/usage"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var (
+		path  string
+		store *usage.Store
+	)
+
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "usage.db")
+		var err error
+		store, err = usage.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() { store.Close() })
+	})
+
+	record := func(t time.Time, keyID, team, model string, tokens int) {
+		ExpectWithOffset(1, store.Record(usage.Record{
+			Time:  t,
+			KeyID: keyID,
+			Team:  team,
+			Model: model,
+			Usage: types.Usage{PromptTokens: tokens, CompletionTokens: tokens, TotalTokens: 2 * tokens},
+		})).To(Succeed())
+	}
+
+	query := func(q usage.Query) []types.UsageBucket {
+		buckets, err := store.Query(q)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return buckets
+	}
+
+	It("adds up usage by day, key and model", func() {
+		record(day.Add(9*time.Hour), "key_alice", "search", "llama", 10)
+		record(day.Add(17*time.Hour), "key_alice", "search", "llama", 20)
+		record(day.Add(17*time.Hour), "key_alice", "search", "gemma", 5)
+		record(day.Add(25*time.Hour), "key_bob", "ads", "llama", 1)
+
+		buckets := query(usage.Query{Start: day, End: day.AddDate(0, 0, 2), Bucket: usage.BucketDay})
+		Expect(buckets).To(Equal([]types.UsageBucket{
+			{Start: day, KeyID: "key_alice", Team: "search", Model: "gemma", Requests: 1, PromptTokens: 5, CompletionTokens: 5, TotalTokens: 10},
+			{Start: day, KeyID: "key_alice", Team: "search", Model: "llama", Requests: 2, PromptTokens: 30, CompletionTokens: 30, TotalTokens: 60},
+			{Start: day.AddDate(0, 0, 1), KeyID: "key_bob", Team: "ads", Model: "llama", Requests: 1, PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2},
+		}))
+	})
+
+	It("buckets usage by hour", func() {
+		record(day.Add(9*time.Hour+time.Minute), "key_alice", "", "llama", 10)
+		record(day.Add(9*time.Hour+59*time.Minute), "key_alice", "", "llama", 10)
+		record(day.Add(10*time.Hour), "key_alice", "", "llama", 10)
+
+		buckets := query(usage.Query{Start: day, End: day.AddDate(0, 0, 1), Bucket: usage.BucketHour})
+		Expect(buckets).To(HaveLen(2))
+		Expect(buckets[0].Start).To(Equal(day.Add(9 * time.Hour)))
+		Expect(buckets[0].Requests).To(Equal(int64(2)))
+		Expect(buckets[1].Start).To(Equal(day.Add(10 * time.Hour)))
+	})
+
+	It("filters by time range, key, team and model", func() {
+		record(day.Add(-time.Hour), "key_alice", "search", "llama", 1)
+		record(day.Add(time.Hour), "key_alice", "search", "llama", 2)
+		record(day.Add(time.Hour), "key_alice", "search", "gemma", 4)
+		record(day.Add(time.Hour), "key_bob", "ads", "llama", 8)
+		record(day.Add(24*time.Hour), "key_alice", "search", "llama", 16)
+
+		total := func(q usage.Query) int64 {
+			q.Start, q.End, q.Bucket = day, day.AddDate(0, 0, 1), usage.BucketDay
+			var tokens int64
+			for _, b := range query(q) {
+				tokens += b.PromptTokens
+			}
+			return tokens
+		}
+		Expect(total(usage.Query{})).To(Equal(int64(14)))
+		Expect(total(usage.Query{KeyID: "key_alice"})).To(Equal(int64(6)))
+		Expect(total(usage.Query{Team: "ads"})).To(Equal(int64(8)))
+		Expect(total(usage.Query{Model: "llama"})).To(Equal(int64(10)))
+		Expect(total(usage.Query{KeyID: "key_alice", Model: "gemma"})).To(Equal(int64(4)))
+	})
+
+	It("keeps usage across restarts", func() {
+		record(day, "key_alice", "", "llama", 10)
+		Expect(store.Close()).To(Succeed())
+
+		var err error
+		store, err = usage.OpenStore(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(query(usage.Query{Start: day, End: day.Add(time.Hour), Bucket: usage.BucketDay})).To(HaveLen(1))
+	})
+
+	It("records concurrent completions", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = store.Record(usage.Record{Time: day, KeyID: "key_alice", Model: "llama", Usage: types.Usage{TotalTokens: 1}})
+			}()
+		}
+		wg.Wait()
+
+		buckets := query(usage.Query{Start: day, End: day.Add(time.Hour), Bucket: usage.BucketDay})
+		Expect(buckets).To(HaveLen(1))
+		Expect(buckets[0].Requests).To(Equal(int64(20)))
+		Expect(buckets[0].TotalTokens).To(Equal(int64(20)))
+	})
+})
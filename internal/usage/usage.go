@@ -0,0 +1,130 @@
+package usage
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"go-api/internal/types"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// ContextKey is the echo context key holding the types.Usage of the completion served
+	ContextKey = "usage"
+
+	// charsPerToken is the rough number of characters per token for English text
+	charsPerToken = 4
+
+	// tokensPerMessage is the formatting overhead each chat message adds to the prompt
+	tokensPerMessage = 4
+
+	// tokensPerReply primes the assistant's reply
+	tokensPerReply = 3
+)
+
+// Set records the usage of the completion served for this request, for metrics and accounting
+func Set(c echo.Context, u types.Usage) {
+	c.Set(ContextKey, u)
+}
+
+// FromContext returns the usage recorded for this request, if any
+func FromContext(c echo.Context) (types.Usage, bool) {
+	u, ok := c.Get(ContextKey).(types.Usage)
+	return u, ok
+}
+
+// EstimateTokens approximates the number of tokens in text.
+// It is only used when the upstream doesn't report usage.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}
+
+// EstimatePrompt approximates the number of prompt tokens in req
+func EstimatePrompt(req *types.ChatRequest) int {
+	tokens := tokensPerReply
+	for _, m := range req.Messages {
+		tokens += tokensPerMessage + EstimateTokens(m.Role) + EstimateTokens(m.Text())
+	}
+	return tokens
+}
+
+// Estimate approximates the usage of a completion of req that produced completion
+func Estimate(req *types.ChatRequest, completion string) types.Usage {
+	u := types.Usage{
+		PromptTokens:     EstimatePrompt(req),
+		CompletionTokens: EstimateTokens(completion),
+	}
+	u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	return u
+}
+
+// FromResponse returns the usage reported in a chat completion, estimating it if the upstream left it out
+func FromResponse(req *types.ChatRequest, resp *types.ChatResponse) types.Usage {
+	if resp.Usage.TotalTokens > 0 {
+		return resp.Usage
+	}
+
+	return Estimate(req, completionText(resp.Choices))
+}
+
+// completionText returns everything the model generated in choices, including tool call arguments
+func completionText(choices []types.Choice) string {
+	var completion strings.Builder
+	for _, choice := range choices {
+		completion.WriteString(choice.Message.Text())
+		for _, call := range choice.Message.ToolCalls {
+			completion.WriteString(call.Function.Name)
+			completion.WriteString(call.Function.Arguments)
+		}
+	}
+	return completion.String()
+}
+
+// Accumulator tracks the usage of a streamed completion as its chunks pass through
+type Accumulator struct {
+	id         string
+	reported   *types.Usage
+	completion types.StreamAccumulator
+}
+
+// NewAccumulator creates an accumulator for a completion of n choices. The
+// zero Accumulator is ready to use for a completion of one.
+func NewAccumulator(n int) *Accumulator {
+	return &Accumulator{completion: types.StreamAccumulator{N: n}}
+}
+
+// Add inspects a chunk for reported usage and completion text
+func (a *Accumulator) Add(chunk *types.ChatCompletionChunk) {
+	if a.id == "" {
+		a.id = chunk.ID
+	}
+	if chunk.Usage != nil {
+		a.reported = chunk.Usage
+	} else if chunk.XGroq != nil && chunk.XGroq.Usage != nil {
+		a.reported = chunk.XGroq.Usage
+	}
+
+	a.completion.Add(chunk)
+}
+
+// Usage returns the usage reported by the upstream, or an estimate if it never reported any
+func (a *Accumulator) Usage(req *types.ChatRequest) types.Usage {
+	if a.reported != nil && a.reported.TotalTokens > 0 {
+		return *a.reported
+	}
+	return Estimate(req, completionText(a.completion.Choices()))
+}
+
+// ID returns the ID the upstream gave the completion, as sent in its chunks
+func (a *Accumulator) ID() string {
+	return a.id
+}
+
+// Choices returns the choices of the completion as assembled from its chunks so far
+func (a *Accumulator) Choices() []types.Choice {
+	return a.completion.Choices()
+}
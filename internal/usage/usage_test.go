@@ -0,0 +1,70 @@
+package usage_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"go-api/internal/types"
+	"go-api/internal/usage"
+
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Usage", func() {
+	req := &types.ChatRequest{
+		Messages: []types.Message{{Role: "user", Content: "What is the capital of France?"}},
+	}
+
+	Describe("Accumulator", func() {
+		It("prefers usage reported in the final chunk", func() {
+			var acc usage.Accumulator
+			acc.Add(&types.ChatCompletionChunk{Choices: []types.ChunkChoice{{Delta: types.ChunkDelta{Content: "Paris"}}}})
+			acc.Add(&types.ChatCompletionChunk{Usage: &types.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}})
+
+			Expect(acc.Usage(req)).To(Equal(types.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12}))
+		})
+
+		It("reads Groq's x_groq usage", func() {
+			var acc usage.Accumulator
+			acc.Add(&types.ChatCompletionChunk{XGroq: &types.XGroq{Usage: &types.Usage{PromptTokens: 8, CompletionTokens: 1, TotalTokens: 9}}})
+
+			Expect(acc.Usage(req).TotalTokens).To(Equal(9))
+		})
+
+		It("estimates usage when the upstream reports none", func() {
+			var acc usage.Accumulator
+			acc.Add(&types.ChatCompletionChunk{Choices: []types.ChunkChoice{{Delta: types.ChunkDelta{Content: "The capital is Paris."}}}})
+
+			u := acc.Usage(req)
+			Expect(u.PromptTokens).To(Equal(usage.EstimatePrompt(req)))
+			Expect(u.CompletionTokens).To(Equal(6))
+			Expect(u.TotalTokens).To(Equal(u.PromptTokens + u.CompletionTokens))
+		})
+
+		It("keeps the completion id from the chunks", func() {
+			var acc usage.Accumulator
+			acc.Add(&types.ChatCompletionChunk{ID: "chatcmpl-1", Choices: []types.ChunkChoice{{Delta: types.ChunkDelta{Content: "Par"}}}})
+			acc.Add(&types.ChatCompletionChunk{ID: "chatcmpl-1", Choices: []types.ChunkChoice{{Delta: types.ChunkDelta{Content: "is"}}}})
+
+			Expect(acc.ID()).To(Equal("chatcmpl-1"))
+		})
+	})
+
+	It("round-trips through the echo context", func() {
+		c := echo.New().NewContext(httptest.NewRequest("POST", "/", nil), httptest.NewRecorder())
+		_, ok := usage.FromContext(c)
+		Expect(ok).To(BeFalse())
+
+		usage.Set(c, types.Usage{TotalTokens: 3})
+		u, ok := usage.FromContext(c)
+		Expect(ok).To(BeTrue())
+		Expect(u.TotalTokens).To(Equal(3))
+	})
+})
+
+func TestUsage(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Usage Suite")
+}
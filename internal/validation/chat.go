@@ -0,0 +1,168 @@
+package validation
+
+import (
+	"fmt"
+	"strconv"
+
+	"go-api/internal/types"
+)
+
+// Limits on chat request parameters, matching the ranges OpenAI documents
+const (
+	// MaxMessages is the most messages a single request may contain
+	MaxMessages = 2048
+
+	// MaxStopSequences is the most stop sequences a request may set
+	MaxStopSequences = 4
+
+	// MaxN is the most completions a request may ask for
+	MaxN = 128
+
+	// MaxTopLogprobs is the largest top_logprobs value
+	MaxTopLogprobs = 20
+)
+
+// validRoles are the message roles accepted from clients. function is the legacy
+// form of tool and is still passed through for older SDKs.
+var validRoles = map[string]bool{
+	types.RoleSystem:    true,
+	types.RoleDeveloper: true,
+	types.RoleUser:      true,
+	types.RoleAssistant: true,
+	types.RoleTool:      true,
+	"function":          true,
+}
+
+// validPartTypes are the content part types accepted in multi-part messages
+var validPartTypes = map[string]bool{
+	"text":        true,
+	"image_url":   true,
+	"input_audio": true,
+}
+
+// validResponseFormats are the accepted response_format types
+var validResponseFormats = map[string]bool{
+	"text":        true,
+	"json_object": true,
+	"json_schema": true,
+}
+
+// ValidateChatRequest checks the required fields, ranges and enums of req,
+// including its tools, and returns the first problem found
+func ValidateChatRequest(req *types.ChatRequest) *Error {
+	if req.Model == "" {
+		return invalid("model", CodeMissingRequired, "Missing required parameter: 'model'.")
+	}
+
+	if err := validateMessages(req.Messages); err != nil {
+		return err
+	}
+
+	if err := checkRange("temperature", req.Temperature, 0, 2); err != nil {
+		return err
+	}
+	if err := checkRange("top_p", req.TopP, 0, 1); err != nil {
+		return err
+	}
+	if err := checkRange("frequency_penalty", req.FrequencyPenalty, -2, 2); err != nil {
+		return err
+	}
+	if err := checkRange("presence_penalty", req.PresencePenalty, -2, 2); err != nil {
+		return err
+	}
+
+	if req.MaxTokens < 0 {
+		return invalid("max_tokens", CodeInvalidValue, "Invalid 'max_tokens': integer below minimum value. Expected a value >= 1, but got %d instead.", req.MaxTokens)
+	}
+	if req.MaxCompletionTokens < 0 {
+		return invalid("max_completion_tokens", CodeInvalidValue, "Invalid 'max_completion_tokens': integer below minimum value. Expected a value >= 1, but got %d instead.", req.MaxCompletionTokens)
+	}
+	if req.N < 0 || req.N > MaxN {
+		return invalid("n", CodeInvalidValue, "Invalid 'n': expected a value between 1 and %d, but got %d instead.", MaxN, req.N)
+	}
+
+	if len(req.Stop) > MaxStopSequences {
+		return invalid("stop", CodeInvalidValue, "Invalid 'stop': array too long. Expected an array with maximum length %d, but got an array with length %d instead.", MaxStopSequences, len(req.Stop))
+	}
+
+	if req.TopLogprobs != nil {
+		if *req.TopLogprobs < 0 || *req.TopLogprobs > MaxTopLogprobs {
+			return invalid("top_logprobs", CodeInvalidValue, "Invalid 'top_logprobs': expected a value between 0 and %d, but got %d instead.", MaxTopLogprobs, *req.TopLogprobs)
+		}
+		if !req.Logprobs {
+			return invalid("top_logprobs", CodeInvalidValue, "Invalid 'top_logprobs': 'logprobs' must be set to true when 'top_logprobs' is specified.")
+		}
+	}
+
+	for token, bias := range req.LogitBias {
+		if _, err := strconv.Atoi(token); err != nil {
+			return invalid("logit_bias", CodeInvalidValue, "Invalid 'logit_bias': key '%s' is not a token ID.", token)
+		}
+		if bias < -100 || bias > 100 {
+			return invalid("logit_bias", CodeInvalidValue, "Invalid 'logit_bias': bias for token %s must be between -100 and 100, but got %g instead.", token, bias)
+		}
+	}
+
+	if format := req.ResponseFormat; format != nil {
+		if !validResponseFormats[format.Type] {
+			return invalid("response_format.type", CodeInvalidValue, "Invalid value for 'response_format.type': expected 'text', 'json_object' or 'json_schema', got '%s'.", format.Type)
+		}
+		if format.Type == "json_schema" {
+			if format.JSONSchema == nil {
+				return invalid("response_format.json_schema", CodeMissingRequired, "Missing required parameter: 'response_format.json_schema'.")
+			}
+			if format.JSONSchema.Name == "" {
+				return invalid("response_format.json_schema.name", CodeMissingRequired, "Missing required parameter: 'response_format.json_schema.name'.")
+			}
+		}
+	}
+
+	if req.StreamOptions != nil && !req.Stream {
+		return invalid("stream_options", CodeInvalidValue, "Invalid 'stream_options': only allowed when 'stream' is true.")
+	}
+
+	return ValidateTools(req)
+}
+
+// validateMessages checks the message count, roles and content parts
+func validateMessages(messages []types.Message) *Error {
+	if len(messages) == 0 {
+		return invalid("messages", CodeMissingRequired, "Invalid 'messages': empty array. Expected an array with minimum length 1.")
+	}
+	if len(messages) > MaxMessages {
+		return invalid("messages", CodeInvalidValue, "Invalid 'messages': array too long. Expected an array with maximum length %d, but got an array with length %d instead.", MaxMessages, len(messages))
+	}
+
+	for i, m := range messages {
+		param := fmt.Sprintf("messages[%d]", i)
+
+		if m.Role == "" {
+			return invalid(param+".role", CodeMissingRequired, "Missing required parameter: '%s.role'.", param)
+		}
+		if !validRoles[m.Role] {
+			return invalid(param+".role", CodeInvalidValue, "Invalid value for '%s.role': expected 'system', 'developer', 'user', 'assistant' or 'tool', got '%s'.", param, m.Role)
+		}
+
+		for j, part := range m.Parts {
+			partParam := fmt.Sprintf("%s.content[%d]", param, j)
+			switch {
+			case !validPartTypes[part.Type]:
+				return invalid(partParam+".type", CodeInvalidValue, "Invalid value for '%s.type': expected 'text', 'image_url' or 'input_audio', got '%s'.", partParam, part.Type)
+			case part.Type == "image_url" && (part.ImageURL == nil || part.ImageURL.URL == ""):
+				return invalid(partParam+".image_url.url", CodeMissingRequired, "Missing required parameter: '%s.image_url.url'.", partParam)
+			case part.Type == "input_audio" && (part.InputAudio == nil || part.InputAudio.Data == ""):
+				return invalid(partParam+".input_audio.data", CodeMissingRequired, "Missing required parameter: '%s.input_audio.data'.", partParam)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkRange returns an Error if value is set and outside [min, max]
+func checkRange(param string, value *float64, min, max float64) *Error {
+	if value != nil && (*value < min || *value > max) {
+		return invalid(param, CodeInvalidValue, "Invalid '%s': expected a value between %g and %g, but got %g instead.", param, min, max, *value)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package validation_test
+
+import (
+	"go-api/internal/validation"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ValidateChatRequest", func() {
+	It("accepts a typical request", func() {
+		req := decode(`{
+			"model": "llama",
+			"messages": [
+				{"role": "system", "content": "Be brief."},
+				{"role": "user", "content": [{"type": "text", "text": "What is this?"}, {"type": "image_url", "image_url": {"url": "https://example.com/cat.png"}}]}
+			],
+			"temperature": 0.7,
+			"top_p": 1,
+			"max_tokens": 100,
+			"n": 1,
+			"stop": ["END"],
+			"logprobs": true,
+			"top_logprobs": 5,
+			"logit_bias": {"50256": -100},
+			"response_format": {"type": "json_schema", "json_schema": {"name": "answer", "schema": {"type": "object"}}},
+			"stream": true,
+			"stream_options": {"include_usage": true}
+		}`)
+		Expect(validation.ValidateChatRequest(req)).To(BeNil())
+	})
+
+	It("fills in an OpenAI-style error body", func() {
+		resp := validation.ValidateChatRequest(decode(`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "temperature": 5}`)).APIError().Response()
+		Expect(resp.Error.Type).To(Equal("invalid_request_error"))
+		Expect(resp.Error.Param).To(Equal("temperature"))
+		Expect(resp.Error.Code).To(Equal(validation.CodeInvalidValue))
+		Expect(resp.Error.Message).To(ContainSubstring("between 0 and 2"))
+	})
+
+	DescribeTable("rejects invalid requests",
+		func(body, param, code string) {
+			err := validation.ValidateChatRequest(decode(body))
+			Expect(err).NotTo(BeNil())
+			Expect(err.Param).To(Equal(param))
+			Expect(err.Code).To(Equal(code))
+		},
+		Entry("missing model",
+			`{"messages": [{"role": "user", "content": "hi"}]}`,
+			"model", validation.CodeMissingRequired),
+		Entry("empty messages",
+			`{"model": "llama", "messages": []}`,
+			"messages", validation.CodeMissingRequired),
+		Entry("missing role",
+			`{"model": "llama", "messages": [{"content": "hi"}]}`,
+			"messages[0].role", validation.CodeMissingRequired),
+		Entry("unknown role",
+			`{"model": "llama", "messages": [{"role": "robot", "content": "hi"}]}`,
+			"messages[0].role", validation.CodeInvalidValue),
+		Entry("unknown content part type",
+			`{"model": "llama", "messages": [{"role": "user", "content": [{"type": "video"}]}]}`,
+			"messages[0].content[0].type", validation.CodeInvalidValue),
+		Entry("image part without a URL",
+			`{"model": "llama", "messages": [{"role": "user", "content": [{"type": "image_url"}]}]}`,
+			"messages[0].content[0].image_url.url", validation.CodeMissingRequired),
+		Entry("temperature too high",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "temperature": 5}`,
+			"temperature", validation.CodeInvalidValue),
+		Entry("top_p above 1",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "top_p": 1.5}`,
+			"top_p", validation.CodeInvalidValue),
+		Entry("presence_penalty below -2",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "presence_penalty": -3}`,
+			"presence_penalty", validation.CodeInvalidValue),
+		Entry("negative max_tokens",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "max_tokens": -1}`,
+			"max_tokens", validation.CodeInvalidValue),
+		Entry("n too large",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "n": 500}`,
+			"n", validation.CodeInvalidValue),
+		Entry("too many stop sequences",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "stop": ["a", "b", "c", "d", "e"]}`,
+			"stop", validation.CodeInvalidValue),
+		Entry("top_logprobs without logprobs",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "top_logprobs": 3}`,
+			"top_logprobs", validation.CodeInvalidValue),
+		Entry("logit_bias out of range",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "logit_bias": {"42": 101}}`,
+			"logit_bias", validation.CodeInvalidValue),
+		Entry("unknown response_format type",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "response_format": {"type": "yaml"}}`,
+			"response_format.type", validation.CodeInvalidValue),
+		Entry("json_schema without a name",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "response_format": {"type": "json_schema", "json_schema": {}}}`,
+			"response_format.json_schema.name", validation.CodeMissingRequired),
+		Entry("stream_options without stream",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "stream_options": {"include_usage": true}}`,
+			"stream_options", validation.CodeInvalidValue),
+		Entry("invalid tools",
+			`{"model": "llama", "messages": [{"role": "user", "content": "hi"}], "tools": [{"type": "function", "function": {}}]}`,
+			"tools[0].function.name", validation.CodeMissingRequired),
+	)
+})
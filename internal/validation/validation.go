@@ -0,0 +1,162 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"go-api/internal/apierror"
+	"go-api/internal/types"
+)
+
+// Error codes, following the codes OpenAI uses for parameter errors
+const (
+	CodeMissingRequired = "missing_required_parameter"
+	CodeInvalidValue    = "invalid_value"
+	CodeInvalidType     = "invalid_type"
+)
+
+// Error describes an invalid request parameter
+type Error struct {
+	// Param is the path of the offending parameter, e.g. tools[0].function.name
+	Param string
+	// Code is one of the Code* constants
+	Code string
+	// Message explains the problem to the client
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// APIError returns the error as a 400 invalid_request_error
+func (e *Error) APIError() *apierror.Error {
+	return apierror.InvalidParam(e.Param, e.Code, e.Message)
+}
+
+// invalid returns an Error with a formatted message
+func invalid(param, code, format string, args ...interface{}) *Error {
+	return &Error{Param: param, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// functionNamePattern is the set of names OpenAI accepts for functions
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ValidateTools checks the tool definitions, tool choice and tool messages of req
+func ValidateTools(req *types.ChatRequest) *Error {
+	names := make(map[string]bool, len(req.Tools))
+	for i, tool := range req.Tools {
+		param := fmt.Sprintf("tools[%d]", i)
+
+		if tool.Type != "function" {
+			return invalid(param+".type", CodeInvalidValue, "Invalid value for '%s.type': expected 'function', got '%s'.", param, tool.Type)
+		}
+
+		name := tool.Function.Name
+		if name == "" {
+			return invalid(param+".function.name", CodeMissingRequired, "Missing required parameter: '%s.function.name'.", param)
+		}
+		if !functionNamePattern.MatchString(name) {
+			return invalid(param+".function.name", CodeInvalidValue, "Invalid '%s.function.name': must be 1-64 characters of a-z, A-Z, 0-9, underscores and dashes.", param)
+		}
+		if names[name] {
+			return invalid(param+".function.name", CodeInvalidValue, "Duplicate function name '%s' in tools.", name)
+		}
+		names[name] = true
+
+		if err := validateParameters(param+".function.parameters", tool.Function.Parameters); err != nil {
+			return err
+		}
+	}
+
+	if choice := req.ToolChoice; choice != nil {
+		switch {
+		case choice.Function != nil:
+			if !names[choice.Function.Name] {
+				return invalid("tool_choice", CodeInvalidValue, "Invalid 'tool_choice': function '%s' is not one of the request's tools.", choice.Function.Name)
+			}
+		case choice.Mode == "none":
+		case choice.Mode == "auto" || choice.Mode == "required":
+			if len(req.Tools) == 0 {
+				return invalid("tool_choice", CodeInvalidValue, "Invalid 'tool_choice': '%s' is only allowed when 'tools' are specified.", choice.Mode)
+			}
+		default:
+			return invalid("tool_choice", CodeInvalidValue, "Invalid value for 'tool_choice': expected 'none', 'auto', 'required' or a function, got '%s'.", choice.Mode)
+		}
+	}
+
+	return validateToolMessages(req.Messages)
+}
+
+// validateParameters checks that a function's parameters are a JSON Schema for an object
+func validateParameters(param string, parameters json.RawMessage) *Error {
+	if len(parameters) == 0 {
+		return nil
+	}
+
+	var schema map[string]json.RawMessage
+	if err := json.Unmarshal(parameters, &schema); err != nil || schema == nil {
+		return invalid(param, CodeInvalidType, "Invalid '%s': must be a JSON Schema object.", param)
+	}
+
+	if raw, ok := schema["type"]; ok {
+		var schemaType string
+		if err := json.Unmarshal(raw, &schemaType); err != nil || schemaType != "object" {
+			return invalid(param+".type", CodeInvalidValue, "Invalid '%s.type': function parameters must be of type 'object'.", param)
+		}
+	}
+
+	if raw, ok := schema["properties"]; ok {
+		var properties map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &properties); err != nil || properties == nil {
+			return invalid(param+".properties", CodeInvalidType, "Invalid '%s.properties': must be an object.", param)
+		}
+	}
+
+	if raw, ok := schema["required"]; ok {
+		var required []string
+		if err := json.Unmarshal(raw, &required); err != nil {
+			return invalid(param+".required", CodeInvalidType, "Invalid '%s.required': must be an array of strings.", param)
+		}
+	}
+
+	return nil
+}
+
+// validateToolMessages checks that tool calls in assistant messages are well formed
+// and that every tool message answers one of them
+func validateToolMessages(messages []types.Message) *Error {
+	calls := make(map[string]bool)
+	for i, m := range messages {
+		param := fmt.Sprintf("messages[%d]", i)
+
+		for j, call := range m.ToolCalls {
+			callParam := fmt.Sprintf("%s.tool_calls[%d]", param, j)
+			if m.Role != types.RoleAssistant {
+				return invalid(param+".tool_calls", CodeInvalidValue, "Invalid '%s.tool_calls': only assistant messages can contain tool calls.", param)
+			}
+			if call.ID == "" {
+				return invalid(callParam+".id", CodeMissingRequired, "Missing required parameter: '%s.id'.", callParam)
+			}
+			if call.Type != "function" {
+				return invalid(callParam+".type", CodeInvalidValue, "Invalid value for '%s.type': expected 'function', got '%s'.", callParam, call.Type)
+			}
+			if call.Function.Name == "" {
+				return invalid(callParam+".function.name", CodeMissingRequired, "Missing required parameter: '%s.function.name'.", callParam)
+			}
+			calls[call.ID] = true
+		}
+
+		if m.Role == types.RoleTool {
+			if m.ToolCallID == "" {
+				return invalid(param+".tool_call_id", CodeMissingRequired, "Missing required parameter: '%s.tool_call_id'.", param)
+			}
+			if !calls[m.ToolCallID] {
+				return invalid(param+".tool_call_id", CodeInvalidValue, "Invalid '%s.tool_call_id': no preceding assistant message made tool call '%s'.", param, m.ToolCallID)
+			}
+		}
+	}
+
+	return nil
+}
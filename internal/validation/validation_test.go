@@ -0,0 +1,85 @@
+package validation_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go-api/internal/types"
+	"go-api/internal/validation"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// decode parses a chat request, failing the spec if it isn't valid JSON
+func decode(body string) *types.ChatRequest {
+	var req types.ChatRequest
+	ExpectWithOffset(1, json.Unmarshal([]byte(body), &req)).To(Succeed())
+	return &req
+}
+
+var _ = Describe("ValidateTools", func() {
+	It("accepts well-formed tools and tool messages", func() {
+		req := decode(`{
+			"model": "llama",
+			"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}}}],
+			"tool_choice": "auto",
+			"messages": [
+				{"role": "user", "content": "Weather in Paris?"},
+				{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+				{"role": "tool", "tool_call_id": "call_1", "content": "18C and sunny"}
+			]
+		}`)
+		Expect(validation.ValidateTools(req)).To(BeNil())
+	})
+
+	DescribeTable("rejects malformed requests",
+		func(body, param, code string) {
+			err := validation.ValidateTools(decode(body))
+			Expect(err).NotTo(BeNil())
+			Expect(err.Param).To(Equal(param))
+			Expect(err.Code).To(Equal(code))
+		},
+		Entry("missing function name",
+			`{"tools": [{"type": "function", "function": {}}]}`,
+			"tools[0].function.name", validation.CodeMissingRequired),
+		Entry("wrong tool type",
+			`{"tools": [{"type": "retrieval", "function": {"name": "f"}}]}`,
+			"tools[0].type", validation.CodeInvalidValue),
+		Entry("invalid function name",
+			`{"tools": [{"type": "function", "function": {"name": "get weather"}}]}`,
+			"tools[0].function.name", validation.CodeInvalidValue),
+		Entry("duplicate function names",
+			`{"tools": [{"type": "function", "function": {"name": "f"}}, {"type": "function", "function": {"name": "f"}}]}`,
+			"tools[1].function.name", validation.CodeInvalidValue),
+		Entry("parameters that aren't an object",
+			`{"tools": [{"type": "function", "function": {"name": "f", "parameters": "string"}}]}`,
+			"tools[0].function.parameters", validation.CodeInvalidType),
+		Entry("parameters of a non-object type",
+			`{"tools": [{"type": "function", "function": {"name": "f", "parameters": {"type": "array"}}}]}`,
+			"tools[0].function.parameters.type", validation.CodeInvalidValue),
+		Entry("required that isn't a string array",
+			`{"tools": [{"type": "function", "function": {"name": "f", "parameters": {"type": "object", "required": "city"}}}]}`,
+			"tools[0].function.parameters.required", validation.CodeInvalidType),
+		Entry("tool_choice naming an unknown function",
+			`{"tools": [{"type": "function", "function": {"name": "f"}}], "tool_choice": {"type": "function", "function": {"name": "g"}}}`,
+			"tool_choice", validation.CodeInvalidValue),
+		Entry("tool_choice required without tools",
+			`{"tool_choice": "required"}`,
+			"tool_choice", validation.CodeInvalidValue),
+		Entry("tool message without tool_call_id",
+			`{"messages": [{"role": "tool", "content": "x"}]}`,
+			"messages[0].tool_call_id", validation.CodeMissingRequired),
+		Entry("tool message answering an unknown call",
+			`{"messages": [{"role": "tool", "tool_call_id": "call_9", "content": "x"}]}`,
+			"messages[0].tool_call_id", validation.CodeInvalidValue),
+		Entry("tool call without an id",
+			`{"messages": [{"role": "assistant", "tool_calls": [{"type": "function", "function": {"name": "f"}}]}]}`,
+			"messages[0].tool_calls[0].id", validation.CodeMissingRequired),
+	)
+})
+
+func TestValidation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Validation Suite")
+}
@@ -0,0 +1,379 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-api/internal/requestid"
+	"go-api/internal/tracing"
+	"go-api/internal/types"
+)
+
+const (
+	// AnthropicEndpoint is the default Messages API base URL
+	AnthropicEndpoint = "https://api.anthropic.com/v1"
+
+	// APIVersion is the Messages API version sent with every request
+	APIVersion = "2023-06-01"
+
+	// DefaultMaxTokens is used when the client doesn't set max_tokens, which the Messages API requires
+	DefaultMaxTokens = 1024
+)
+
+// Client translates OpenAI-style chat requests to Anthropic's Messages API
+// and translates the responses back, so callers only ever see the OpenAI format
+type Client struct {
+	apiKey   string
+	endpoint string
+	client   *http.Client
+}
+
+// NewClient creates an Anthropic client. An empty baseURL uses AnthropicEndpoint.
+func NewClient(baseURL, apiKey string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = AnthropicEndpoint
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	return &Client{
+		apiKey:   apiKey,
+		endpoint: strings.TrimRight(baseURL, "/") + "/messages",
+		client:   httpClient,
+	}
+}
+
+// messagesRequest is the request body of the Messages API
+type messagesRequest struct {
+	Model         string      `json:"model"`
+	System        string      `json:"system,omitempty"`
+	Messages      []message   `json:"messages"`
+	MaxTokens     int         `json:"max_tokens"`
+	Temperature   *float64    `json:"temperature,omitempty"`
+	TopP          *float64    `json:"top_p,omitempty"`
+	StopSequences []string    `json:"stop_sequences,omitempty"`
+	Stream        bool        `json:"stream,omitempty"`
+	Tools         []tool      `json:"tools,omitempty"`
+	ToolChoice    *toolChoice `json:"tool_choice,omitempty"`
+}
+
+type tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type toolChoice struct {
+	// Type is auto, any, tool or none
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type message struct {
+	Role string `json:"role"`
+	// Content is a string or a list of content blocks
+	Content interface{} `json:"content"`
+}
+
+// contentBlock is a text, image, tool_use or tool_result block of a message
+type contentBlock struct {
+	Type   string       `json:"type"`
+	Text   string       `json:"text,omitempty"`
+	Source *imageSource `json:"source,omitempty"`
+
+	// tool_use fields
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result fields
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+}
+
+type imageSource struct {
+	// Type is base64 or url
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// messagesResponse is the non-streaming response body of the Messages API
+type messagesResponse struct {
+	ID         string         `json:"id"`
+	Model      string         `json:"model"`
+	Content    []contentBlock `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      usage          `json:"usage"`
+}
+
+type usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// errorResponse is the error body of the Messages API
+type errorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *Client) ChatCompletion(ctx context.Context, req *types.ChatRequest) (*http.Response, error) {
+	reqBody, err := json.Marshal(toMessagesRequest(req))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.apiKey)
+	httpReq.Header.Set("anthropic-version", APIVersion)
+	requestid.Propagate(httpReq)
+
+	httpReq, span := tracing.StartHTTP(httpReq, "anthropic")
+	resp, err := c.client.Do(httpReq)
+	resp, err = tracing.EndHTTP(span, resp, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return translateError(resp)
+	}
+
+	if req.Stream {
+		return translateStream(resp), nil
+	}
+
+	return translateResponse(resp)
+}
+
+// toMessagesRequest converts an OpenAI chat request into a Messages API request.
+// System messages are hoisted into the top-level system prompt.
+func toMessagesRequest(req *types.ChatRequest) *messagesRequest {
+	out := &messagesRequest{
+		Model:         req.Model,
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+		Stream:        req.Stream,
+	}
+	if req.MaxCompletionTokens > 0 {
+		out.MaxTokens = req.MaxCompletionTokens
+	}
+	if out.MaxTokens == 0 {
+		out.MaxTokens = DefaultMaxTokens
+	}
+
+	for _, t := range req.Tools {
+		schema := t.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object"}`)
+		}
+		out.Tools = append(out.Tools, tool{Name: t.Function.Name, Description: t.Function.Description, InputSchema: schema})
+	}
+	out.ToolChoice = toToolChoice(req)
+
+	var system []string
+	for _, m := range req.Messages {
+		switch {
+		case m.Role == types.RoleSystem || m.Role == types.RoleDeveloper:
+			system = append(system, m.Text())
+		case m.Role == types.RoleTool:
+			// Tool results go back as user messages, with consecutive results sharing one message
+			result := contentBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Text()}
+			if last := len(out.Messages) - 1; last >= 0 && out.Messages[last].Role == types.RoleUser {
+				if blocks, ok := out.Messages[last].Content.([]contentBlock); ok {
+					out.Messages[last].Content = append(blocks, result)
+					continue
+				}
+			}
+			out.Messages = append(out.Messages, message{Role: types.RoleUser, Content: []contentBlock{result}})
+		default:
+			out.Messages = append(out.Messages, message{Role: m.Role, Content: toContent(m)})
+		}
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	return out
+}
+
+// toToolChoice converts tool_choice and parallel_tool_calls to the Messages API tool choice
+func toToolChoice(req *types.ChatRequest) *toolChoice {
+	if len(req.Tools) == 0 {
+		return nil
+	}
+
+	choice := &toolChoice{Type: "auto"}
+	if tc := req.ToolChoice; tc != nil {
+		switch {
+		case tc.Function != nil:
+			choice = &toolChoice{Type: "tool", Name: tc.Function.Name}
+		case tc.Mode == "required":
+			choice.Type = "any"
+		case tc.Mode == "none":
+			return &toolChoice{Type: "none"}
+		}
+	}
+	if req.ParallelToolCalls != nil && !*req.ParallelToolCalls {
+		choice.DisableParallelToolUse = true
+	}
+
+	return choice
+}
+
+// toContent converts message content to a string or, for multi-part messages, content blocks.
+// Parts the Messages API can't take, such as audio, are dropped.
+func toContent(m types.Message) interface{} {
+	if m.Parts == nil && len(m.ToolCalls) == 0 {
+		return m.Content
+	}
+
+	blocks := make([]contentBlock, 0, len(m.Parts)+len(m.ToolCalls)+1)
+	if m.Parts == nil && m.Content != "" {
+		blocks = append(blocks, contentBlock{Type: "text", Text: m.Content})
+	}
+	for _, part := range m.Parts {
+		switch {
+		case part.Type == "text":
+			blocks = append(blocks, contentBlock{Type: "text", Text: part.Text})
+		case part.Type == "image_url" && part.ImageURL != nil:
+			blocks = append(blocks, contentBlock{Type: "image", Source: toImageSource(part.ImageURL.URL)})
+		}
+	}
+	for _, call := range m.ToolCalls {
+		input := json.RawMessage(call.Function.Arguments)
+		if len(input) == 0 {
+			input = json.RawMessage(`{}`)
+		}
+		blocks = append(blocks, contentBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+	}
+	return blocks
+}
+
+// toImageSource converts an image URL, which may be a base64 data URL, to an image source
+func toImageSource(url string) *imageSource {
+	// data:<media type>;base64,<data>
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		meta, data, found := strings.Cut(rest, ",")
+		if mediaType, isBase64 := strings.CutSuffix(meta, ";base64"); found && isBase64 {
+			return &imageSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+	}
+	return &imageSource{Type: "url", URL: url}
+}
+
+// finishReason maps an Anthropic stop reason to its OpenAI equivalent
+func finishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "":
+		return ""
+	default:
+		return "stop"
+	}
+}
+
+// translateResponse rewrites a Messages API response body into a chat completion
+func translateResponse(resp *http.Response) (*http.Response, error) {
+	defer resp.Body.Close()
+
+	var msg messagesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, err
+	}
+
+	var (
+		text      strings.Builder
+		toolCalls []types.ToolCall
+	)
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, types.ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: types.FunctionCall{Name: block.Name, Arguments: string(block.Input)},
+			})
+		}
+	}
+
+	chatResp := types.ChatResponse{
+		ID:      msg.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   msg.Model,
+		Choices: []types.Choice{{
+			Index:        0,
+			Message:      types.Message{Role: types.RoleAssistant, Content: text.String(), ToolCalls: toolCalls},
+			FinishReason: finishReason(msg.StopReason),
+		}},
+		Usage: types.Usage{
+			PromptTokens:     msg.Usage.InputTokens,
+			CompletionTokens: msg.Usage.OutputTokens,
+			TotalTokens:      msg.Usage.InputTokens + msg.Usage.OutputTokens,
+		},
+	}
+
+	return replaceBody(resp, chatResp)
+}
+
+// translateError rewrites a Messages API error body into an OpenAI error, keeping the status code
+func translateError(resp *http.Response) (*http.Response, error) {
+	defer resp.Body.Close()
+
+	var anthropicErr errorResponse
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &anthropicErr); err != nil || anthropicErr.Error.Message == "" {
+		anthropicErr.Error.Message = string(body)
+	}
+
+	var errResp types.ErrorResponse
+	errResp.Error.Message = anthropicErr.Error.Message
+	errResp.Error.Type = anthropicErr.Error.Type
+	if errResp.Error.Type == "" {
+		errResp.Error.Type = "api_error"
+	}
+
+	return replaceBody(resp, errResp)
+}
+
+// replaceBody returns a copy of resp whose body is the JSON encoding of v
+func replaceBody(resp *http.Response, v interface{}) (*http.Response, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *resp
+	out.Header = resp.Header.Clone()
+	out.Header.Set("Content-Type", "application/json")
+	out.Header.Del("Content-Length")
+	out.ContentLength = int64(len(body))
+	out.Body = io.NopCloser(bytes.NewReader(body))
+
+	return &out, nil
+}
@@ -0,0 +1,186 @@
+package anthropic_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-api/internal/types"
+	"go-api/pkg/anthropic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Anthropic client", func() {
+	var (
+		server   *httptest.Server
+		received map[string]interface{}
+		reply    func(w http.ResponseWriter)
+	)
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Path).To(Equal("/v1/messages"))
+			Expect(r.Header.Get("x-api-key")).To(Equal("test-key"))
+			Expect(json.NewDecoder(r.Body).Decode(&received)).To(Succeed())
+			reply(w)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	request := func(stream bool) *types.ChatRequest {
+		return &types.ChatRequest{
+			Model: "claude-3-5-sonnet-latest",
+			Messages: []types.Message{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "Hi"},
+			},
+			Stream: stream,
+		}
+	}
+
+	It("translates requests and responses", func() {
+		reply = func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"id":"msg_1","model":"claude-3-5-sonnet-latest","content":[{"type":"text","text":"Hello!"}],"stop_reason":"end_turn","usage":{"input_tokens":5,"output_tokens":2}}`)
+		}
+
+		client := anthropic.NewClient(server.URL+"/v1", "test-key", server.Client())
+		req := request(false)
+		temperature := 0.0
+		req.Temperature = &temperature
+		resp, err := client.ChatCompletion(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(received["system"]).To(Equal("Be brief."))
+		Expect(received["messages"]).To(HaveLen(1))
+		Expect(received["max_tokens"]).To(BeNumerically("==", anthropic.DefaultMaxTokens))
+		Expect(received).To(HaveKeyWithValue("temperature", BeNumerically("==", 0)))
+		Expect(received).NotTo(HaveKey("top_p"))
+
+		var chatResp types.ChatResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&chatResp)).To(Succeed())
+		Expect(chatResp.Object).To(Equal("chat.completion"))
+		Expect(chatResp.Choices[0].Message.Content).To(Equal("Hello!"))
+		Expect(chatResp.Choices[0].FinishReason).To(Equal("stop"))
+		Expect(chatResp.Usage.TotalTokens).To(Equal(7))
+	})
+
+	It("translates tool definitions, tool calls and tool results", func() {
+		reply = func(w http.ResponseWriter) {
+			io.WriteString(w, `{"id":"msg_2","model":"claude","content":[{"type":"tool_use","id":"toolu_2","name":"get_time","input":{"tz":"UTC"}}],"stop_reason":"tool_use","usage":{"input_tokens":9,"output_tokens":4}}`)
+		}
+
+		var req types.ChatRequest
+		Expect(json.Unmarshal([]byte(`{
+			"model": "claude",
+			"tools": [{"type": "function", "function": {"name": "get_weather", "parameters": {"type": "object"}}}, {"type": "function", "function": {"name": "get_time"}}],
+			"tool_choice": "required",
+			"messages": [
+				{"role": "user", "content": "Weather?"},
+				{"role": "assistant", "content": null, "tool_calls": [{"id": "toolu_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]},
+				{"role": "tool", "tool_call_id": "toolu_1", "content": "sunny"}
+			]
+		}`), &req)).To(Succeed())
+
+		client := anthropic.NewClient(server.URL+"/v1", "test-key", server.Client())
+		resp, err := client.ChatCompletion(context.Background(), &req)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(received["tools"]).To(HaveLen(2))
+		Expect(received["tool_choice"]).To(HaveKeyWithValue("type", "any"))
+		messages := received["messages"].([]interface{})
+		Expect(messages).To(HaveLen(3))
+		Expect(messages[1]).To(HaveKeyWithValue("content", ContainElement(HaveKeyWithValue("type", "tool_use"))))
+		Expect(messages[2]).To(HaveKeyWithValue("role", "user"))
+		Expect(messages[2]).To(HaveKeyWithValue("content", ContainElement(HaveKeyWithValue("tool_use_id", "toolu_1"))))
+
+		var chatResp types.ChatResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&chatResp)).To(Succeed())
+		Expect(chatResp.Choices[0].FinishReason).To(Equal("tool_calls"))
+		Expect(chatResp.Choices[0].Message.ToolCalls).To(HaveLen(1))
+		Expect(chatResp.Choices[0].Message.ToolCalls[0].Function.Name).To(Equal("get_time"))
+		Expect(chatResp.Choices[0].Message.ToolCalls[0].Function.Arguments).To(MatchJSON(`{"tz":"UTC"}`))
+	})
+
+	It("translates error bodies and keeps the status", func() {
+		reply = func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`)
+		}
+
+		client := anthropic.NewClient(server.URL+"/v1", "test-key", server.Client())
+		resp, err := client.ChatCompletion(context.Background(), request(false))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		var errResp types.ErrorResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&errResp)).To(Succeed())
+		Expect(errResp.Error.Type).To(Equal("invalid_request_error"))
+		Expect(errResp.Error.Message).To(Equal("bad"))
+	})
+
+	It("translates the event stream into chat completion chunks", func() {
+		reply = func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"model\":\"claude\"}}\n\n"+
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi\"}}\n\n"+
+				"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"}}\n\n"+
+				"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+		}
+
+		client := anthropic.NewClient(server.URL+"/v1", "test-key", server.Client())
+		resp, err := client.ChatCompletion(context.Background(), request(true))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring(`"role":"assistant"`))
+		Expect(string(body)).To(ContainSubstring(`"content":"Hi"`))
+		Expect(string(body)).To(ContainSubstring(`"finish_reason":"stop"`))
+		Expect(string(body)).To(HaveSuffix("data: [DONE]\n\n"))
+	})
+
+	It("reports the usage of the stream in a final chunk", func() {
+		reply = func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"model\":\"claude\",\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n"+
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi\"}}\n\n"+
+				"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":5}}\n\n"+
+				"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+		}
+
+		client := anthropic.NewClient(server.URL+"/v1", "test-key", server.Client())
+		resp, err := client.ChatCompletion(context.Background(), request(true))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		events := strings.Split(strings.TrimSuffix(string(body), "\n\n"), "\n\n")
+		Expect(events).To(HaveLen(5))
+		Expect(events[4]).To(Equal("data: [DONE]"))
+
+		var chunk types.ChatCompletionChunk
+		Expect(json.Unmarshal([]byte(strings.TrimPrefix(events[3], "data: ")), &chunk)).To(Succeed())
+		Expect(chunk.Choices).To(BeEmpty())
+		Expect(chunk.Usage).To(Equal(&types.Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17}))
+	})
+})
+
+func TestAnthropic(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Anthropic Suite")
+}
@@ -0,0 +1,169 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go-api/internal/types"
+	"go-api/pkg/sse"
+)
+
+// streamEvent covers the fields we need from every Messages API stream event
+type streamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		ID    string `json:"id"`
+		Model string `json:"model"`
+		Usage usage  `json:"usage"`
+	} `json:"message"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage usage `json:"usage"`
+}
+
+// translateStream returns a copy of resp whose body is the Messages API event
+// stream rewritten as OpenAI chat completion chunks
+func translateStream(resp *http.Response) *http.Response {
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer resp.Body.Close()
+		pw.CloseWithError(pipeStream(resp.Body, pw))
+	}()
+
+	out := *resp
+	out.Header = resp.Header.Clone()
+	out.Header.Set("Content-Type", "text/event-stream")
+	out.Header.Del("Content-Length")
+	out.ContentLength = -1
+	out.Body = pr
+
+	return &out
+}
+
+// pipeStream reads Messages API events from r and writes OpenAI chunks to w
+func pipeStream(r io.Reader, w io.Writer) error {
+	var id, model string
+	created := time.Now().Unix()
+
+	// message_start reports the input tokens and message_delta the output tokens
+	var inputTokens, outputTokens int
+
+	// toolIndex maps content block indexes to tool call indexes
+	toolIndex := make(map[int]int)
+
+	write := func(delta types.ChunkDelta, finishReason *string) error {
+		data, err := json.Marshal(types.ChatCompletionChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []types.ChunkChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+
+	// writeUsage writes the final chunk, which has no choices, like OpenAI's
+	// when stream_options.include_usage is set
+	writeUsage := func() error {
+		data, err := json.Marshal(types.ChatCompletionChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []types.ChunkChoice{},
+			Usage: &types.Usage{
+				PromptTokens:     inputTokens,
+				CompletionTokens: outputTokens,
+				TotalTokens:      inputTokens + outputTokens,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		return err
+	}
+
+	events := sse.NewReader(r)
+	for {
+		sseEvent, err := events.Next()
+		if err == io.EOF {
+			// The upstream closed without message_stop, let the reader on the other end see it
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+
+		var event streamEvent
+		if err := json.Unmarshal([]byte(sseEvent.Data), &event); err != nil {
+			continue
+		}
+
+		switch event.Type {
+		case "message_start":
+			id = event.Message.ID
+			model = event.Message.Model
+			inputTokens = event.Message.Usage.InputTokens
+			err = write(types.ChunkDelta{Role: "assistant"}, nil)
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				index := len(toolIndex)
+				toolIndex[event.Index] = index
+				err = write(types.ChunkDelta{ToolCalls: []types.ToolCallDelta{{
+					Index:    index,
+					ID:       event.ContentBlock.ID,
+					Type:     "function",
+					Function: types.FunctionCallDelta{Name: event.ContentBlock.Name},
+				}}}, nil)
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				err = write(types.ChunkDelta{Content: event.Delta.Text}, nil)
+			case "input_json_delta":
+				err = write(types.ChunkDelta{ToolCalls: []types.ToolCallDelta{{
+					Index:    toolIndex[event.Index],
+					Function: types.FunctionCallDelta{Arguments: event.Delta.PartialJSON},
+				}}}, nil)
+			}
+		case "message_delta":
+			outputTokens = event.Usage.OutputTokens
+			if event.Delta.StopReason != "" {
+				reason := finishReason(event.Delta.StopReason)
+				err = write(types.ChunkDelta{}, &reason)
+			}
+		case "message_stop":
+			if err = writeUsage(); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "data: %s\n\n", sse.DoneData)
+			if err == nil {
+				return nil
+			}
+		case "error":
+			err = fmt.Errorf("anthropic stream error: %s", sseEvent.Data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -2,39 +2,52 @@ package groq
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 
+	"go-api/internal/requestid"
+	"go-api/internal/tracing"
 	"go-api/internal/types"
 )
 
 const GroqEndpoint = "https://api.groq.com/openai/v1/chat/completions"
 
 type Client struct {
-	apiKey string
-	client *http.Client
+	apiKey   string
+	endpoint string
+	client   *http.Client
 }
 
 func NewClient(apiKey string) *Client {
+	return NewClientWithHTTPClient(apiKey, &http.Client{})
+}
+
+// NewClientWithHTTPClient creates a Groq client that sends requests through the given HTTP client
+func NewClientWithHTTPClient(apiKey string, httpClient *http.Client) *Client {
 	return &Client{
-		apiKey: apiKey,
-		client: &http.Client{},
+		apiKey:   apiKey,
+		endpoint: GroqEndpoint,
+		client:   httpClient,
 	}
 }
 
-func (c *Client) ChatCompletion(req *types.ChatRequest) (*http.Response, error) {
+func (c *Client) ChatCompletion(ctx context.Context, req *types.ChatRequest) (*http.Response, error) {
 	reqBody, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequest("POST", GroqEndpoint, bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	requestid.Propagate(httpReq)
 
-	return c.client.Do(httpReq)
+	httpReq, span := tracing.StartHTTP(httpReq, "groq")
+	resp, err := c.client.Do(httpReq)
+	return tracing.EndHTTP(span, resp, err)
 }
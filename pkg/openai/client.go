@@ -0,0 +1,57 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"go-api/internal/requestid"
+	"go-api/internal/tracing"
+	"go-api/internal/types"
+)
+
+// Client talks to any server exposing the OpenAI chat completions API,
+// such as vLLM, Ollama or LM Studio
+type Client struct {
+	apiKey   string
+	endpoint string
+	client   *http.Client
+}
+
+// NewClient creates a client for the server at baseURL (e.g. "http://localhost:8000/v1").
+// The API key is optional since most self-hosted servers don't require one.
+func NewClient(baseURL, apiKey string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+
+	return &Client{
+		apiKey:   apiKey,
+		endpoint: strings.TrimRight(baseURL, "/") + "/chat/completions",
+		client:   httpClient,
+	}
+}
+
+func (c *Client) ChatCompletion(ctx context.Context, req *types.ChatRequest) (*http.Response, error) {
+	reqBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	requestid.Propagate(httpReq)
+
+	httpReq, span := tracing.StartHTTP(httpReq, "openai")
+	resp, err := c.client.Do(httpReq)
+	return tracing.EndHTTP(span, resp, err)
+}
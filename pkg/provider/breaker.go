@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureRateThreshold is the share of failed requests in a window that opens the breaker
+	DefaultFailureRateThreshold = 0.5
+
+	// DefaultMinRequests is how many requests a window needs before the failure rate is trusted
+	DefaultMinRequests = 10
+
+	// DefaultBreakerWindow is how long failures are counted before the counts reset
+	DefaultBreakerWindow = time.Minute
+
+	// DefaultOpenTimeout is how long an open breaker rejects requests before probing again
+	DefaultOpenTimeout = 30 * time.Second
+
+	// DefaultHalfOpenRequests is how many probe requests a half-open breaker lets through
+	DefaultHalfOpenRequests = 1
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// StateClosed lets all requests through
+	StateClosed BreakerState = iota
+	// StateOpen rejects all requests
+	StateOpen
+	// StateHalfOpen lets a few probe requests through to test recovery
+	StateHalfOpen
+)
+
+// String returns the lowercase state name used in metrics and logs
+func (s BreakerState) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// BreakerConfig controls when a circuit breaker opens and how it recovers
+type BreakerConfig struct {
+	// FailureRateThreshold opens the breaker once this share of a window's requests failed
+	FailureRateThreshold float64 `yaml:"failure_rate_threshold"`
+
+	// MinRequests is the number of requests a window needs before the breaker can open
+	MinRequests int `yaml:"min_requests"`
+
+	// Window is how long requests are counted before the counts reset
+	Window time.Duration `yaml:"window"`
+
+	// OpenTimeout is how long the breaker stays open before going half-open
+	OpenTimeout time.Duration `yaml:"open_timeout"`
+
+	// HalfOpenRequests is how many probes must succeed before the breaker closes
+	HalfOpenRequests int `yaml:"half_open_requests"`
+}
+
+// DefaultBreakerConfig returns the breaker config used when none is configured
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureRateThreshold: DefaultFailureRateThreshold,
+		MinRequests:          DefaultMinRequests,
+		Window:               DefaultBreakerWindow,
+		OpenTimeout:          DefaultOpenTimeout,
+		HalfOpenRequests:     DefaultHalfOpenRequests,
+	}
+}
+
+// withDefaults fills in zero fields from DefaultBreakerConfig
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	defaults := DefaultBreakerConfig()
+	if c.FailureRateThreshold <= 0 {
+		c.FailureRateThreshold = defaults.FailureRateThreshold
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = defaults.MinRequests
+	}
+	if c.Window <= 0 {
+		c.Window = defaults.Window
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = defaults.OpenTimeout
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = defaults.HalfOpenRequests
+	}
+	return c
+}
+
+// Breaker is a failure-rate circuit breaker for a single route
+type Breaker struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	onChange func(from, to BreakerState)
+
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	probesOK    int
+}
+
+// NewBreaker creates a closed breaker. onChange, if set, is called on every state transition.
+func NewBreaker(config BreakerConfig, onChange func(from, to BreakerState)) *Breaker {
+	return &Breaker{
+		config:      config.withDefaults(),
+		onChange:    onChange,
+		windowStart: time.Now(),
+	}
+}
+
+// State returns the current state, moving an open breaker to half-open once its timeout has passed
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(time.Now())
+	return b.state
+}
+
+// Allow reports whether a request may be sent. Every allowed request must be
+// followed by a call to Record or Cancel.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(time.Now())
+	switch b.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.probes >= b.config.HalfOpenRequests {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// Record reports the outcome of an allowed request
+func (b *Breaker) Record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.advance(now)
+
+	switch b.state {
+	case StateHalfOpen:
+		if failed {
+			b.transition(StateOpen, now)
+			return
+		}
+		b.probesOK++
+		if b.probesOK >= b.config.HalfOpenRequests {
+			b.transition(StateClosed, now)
+		}
+	case StateClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.config.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.config.FailureRateThreshold {
+			b.transition(StateOpen, now)
+		}
+	}
+}
+
+// Cancel releases an allowed request that finished without a meaningful
+// outcome, such as the client disconnecting
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// advance applies time-based transitions. Callers must hold b.mu.
+func (b *Breaker) advance(now time.Time) {
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) >= b.config.OpenTimeout {
+			b.transition(StateHalfOpen, now)
+		}
+	case StateClosed:
+		if now.Sub(b.windowStart) >= b.config.Window {
+			b.windowStart = now
+			b.requests = 0
+			b.failures = 0
+		}
+	}
+}
+
+// transition moves to state to and resets the counters. Callers must hold b.mu.
+func (b *Breaker) transition(to BreakerState, now time.Time) {
+	from := b.state
+	b.state = to
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+	b.probes = 0
+	b.probesOK = 0
+	if to == StateOpen {
+		b.openedAt = now
+	}
+
+	if b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
@@ -0,0 +1,123 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go-api/internal/types"
+	"go-api/pkg/provider"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Breaker", func() {
+	var (
+		breaker     *provider.Breaker
+		transitions []string
+	)
+
+	BeforeEach(func() {
+		transitions = nil
+		breaker = provider.NewBreaker(provider.BreakerConfig{
+			FailureRateThreshold: 0.5,
+			MinRequests:          4,
+			Window:               time.Minute,
+			OpenTimeout:          20 * time.Millisecond,
+			HalfOpenRequests:     1,
+		}, func(from, to provider.BreakerState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		})
+	})
+
+	record := func(failed ...bool) {
+		for _, f := range failed {
+			Expect(breaker.Allow()).To(BeTrue())
+			breaker.Record(f)
+		}
+	}
+
+	It("stays closed until the window has enough requests", func() {
+		record(true, true, true)
+		Expect(breaker.State()).To(Equal(provider.StateClosed))
+	})
+
+	It("opens once the failure rate crosses the threshold", func() {
+		record(false, true, false, true)
+		Expect(breaker.State()).To(Equal(provider.StateOpen))
+		Expect(breaker.Allow()).To(BeFalse())
+		Expect(transitions).To(Equal([]string{"closed->open"}))
+	})
+
+	It("closes again after a successful probe", func() {
+		record(true, true, true, true)
+		Eventually(breaker.State).Should(Equal(provider.StateHalfOpen))
+
+		Expect(breaker.Allow()).To(BeTrue())
+		Expect(breaker.Allow()).To(BeFalse(), "only one probe at a time")
+		breaker.Record(false)
+
+		Expect(breaker.State()).To(Equal(provider.StateClosed))
+		Expect(transitions).To(Equal([]string{"closed->open", "open->half_open", "half_open->closed"}))
+	})
+
+	It("reopens after a failed probe", func() {
+		record(true, true, true, true)
+		Eventually(breaker.State).Should(Equal(provider.StateHalfOpen))
+
+		record(true)
+		Expect(breaker.State()).To(Equal(provider.StateOpen))
+	})
+})
+
+var _ = Describe("Registry circuit breaking", func() {
+	var (
+		registry  *provider.Registry
+		primary   *scriptedProvider
+		secondary *scriptedProvider
+	)
+
+	BeforeEach(func() {
+		primary = &scriptedProvider{script: []func() (*http.Response, error){fail(errors.New("connection refused"))}}
+		secondary = &scriptedProvider{script: []func() (*http.Response, error){respond(http.StatusOK, "{}")}}
+
+		registry = provider.NewRegistry("")
+		registry.Register("groq", primary)
+		registry.Register("vllm", secondary)
+		registry.SetRetryPolicy(provider.RetryPolicy{MaxAttempts: 1})
+		registry.SetBreakerConfig(provider.BreakerConfig{MinRequests: 2, OpenTimeout: time.Hour})
+	})
+
+	It("skips routes whose breaker is open", func() {
+		registry.MapModel("llama", provider.ModelConfig{
+			Provider:  "groq",
+			Fallbacks: []provider.ModelConfig{{Provider: "vllm"}},
+		})
+
+		for i := 0; i < 2; i++ {
+			_, route, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(route.Provider).To(Equal("vllm"))
+		}
+		Expect(primary.calls).To(Equal(2))
+
+		_, route, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(route.Provider).To(Equal("vllm"))
+		Expect(primary.calls).To(Equal(2), "open breaker should not be called")
+	})
+
+	It("fails fast when every route's breaker is open", func() {
+		registry.MapModel("llama", provider.ModelConfig{Provider: "groq"})
+
+		for i := 0; i < 2; i++ {
+			registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		}
+
+		_, _, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		Expect(errors.Is(err, provider.ErrUpstreamUnavailable)).To(BeTrue())
+		Expect(primary.calls).To(Equal(2))
+	})
+})
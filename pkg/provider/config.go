@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"go-api/pkg/anthropic"
+	"go-api/pkg/groq"
+	"go-api/pkg/openai"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Supported provider types
+const (
+	TypeGroq      = "groq"
+	TypeOpenAI    = "openai"
+	TypeAnthropic = "anthropic"
+)
+
+// Config is the model to provider mapping, usually loaded from providers.yaml
+type Config struct {
+	// DefaultProvider serves any model not listed in Models
+	DefaultProvider string `yaml:"default_provider"`
+
+	// Providers lists the upstream backends
+	Providers []ProviderConfig `yaml:"providers"`
+
+	// Models maps a requested model name to a provider
+	Models map[string]ModelConfig `yaml:"models"`
+
+	// Retry controls retries of transient upstream failures
+	Retry RetryPolicy `yaml:"retry"`
+
+	// CircuitBreaker controls when failing routes are taken out of rotation
+	CircuitBreaker BreakerConfig `yaml:"circuit_breaker"`
+}
+
+// ProviderConfig configures a single upstream backend
+type ProviderConfig struct {
+	// Name is how models refer to this provider
+	Name string `yaml:"name"`
+
+	// Type is one of groq, openai or anthropic. Use openai for any
+	// OpenAI-compatible server such as vLLM, Ollama or LM Studio.
+	Type string `yaml:"type"`
+
+	// BaseURL is the API root, e.g. http://localhost:11434/v1 (not used by groq)
+	BaseURL string `yaml:"base_url"`
+
+	// APIKeyEnv is the environment variable holding the upstream API key
+	APIKeyEnv string `yaml:"api_key_env"`
+}
+
+// ModelConfig routes a requested model to a provider
+type ModelConfig struct {
+	// Provider is the name of the provider serving this model
+	Provider string `yaml:"provider"`
+
+	// Model is the upstream model name, defaults to the requested name
+	Model string `yaml:"model"`
+
+	// Fallbacks are tried in order when this provider keeps failing
+	Fallbacks []ModelConfig `yaml:"fallbacks"`
+}
+
+// DefaultConfig sends every model to Groq, matching the behaviour before providers were configurable
+func DefaultConfig() *Config {
+	return &Config{
+		DefaultProvider: TypeGroq,
+		Providers: []ProviderConfig{
+			{Name: TypeGroq, Type: TypeGroq, APIKeyEnv: "GROQ_API_KEY"},
+		},
+	}
+}
+
+// LoadConfig reads the provider config from path, falling back to DefaultConfig if the file doesn't exist
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("Warning: %s not found, routing all models to Groq", path)
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+// NewRegistryFromConfig creates the providers described by config, all sharing httpClient
+func NewRegistryFromConfig(config *Config, httpClient *http.Client) (*Registry, error) {
+	registry := NewRegistry(config.DefaultProvider)
+	registry.SetRetryPolicy(config.Retry)
+	registry.SetBreakerConfig(config.CircuitBreaker)
+
+	for _, pc := range config.Providers {
+		p, err := newProvider(pc, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		registry.Register(pc.Name, p)
+	}
+
+	for alias, model := range config.Models {
+		for _, mc := range append([]ModelConfig{model}, model.Fallbacks...) {
+			if _, ok := registry.providers[mc.Provider]; !ok {
+				return nil, fmt.Errorf("model %s refers to unknown provider %s", alias, mc.Provider)
+			}
+		}
+		registry.MapModel(alias, model)
+	}
+
+	if config.DefaultProvider != "" {
+		if _, ok := registry.providers[config.DefaultProvider]; !ok {
+			return nil, fmt.Errorf("default provider %s is not configured", config.DefaultProvider)
+		}
+	}
+
+	return registry, nil
+}
+
+// newProvider creates the client for a single provider config
+func newProvider(pc ProviderConfig, httpClient *http.Client) (Provider, error) {
+	if pc.Name == "" {
+		return nil, fmt.Errorf("provider of type %s has no name", pc.Type)
+	}
+
+	var apiKey string
+	if pc.APIKeyEnv != "" {
+		apiKey = os.Getenv(pc.APIKeyEnv)
+		if apiKey == "" {
+			log.Printf("Warning: %s not set, requests to provider %s will not be authenticated", pc.APIKeyEnv, pc.Name)
+		}
+	}
+
+	switch pc.Type {
+	case TypeGroq:
+		return groq.NewClientWithHTTPClient(apiKey, httpClient), nil
+	case TypeOpenAI:
+		if pc.BaseURL == "" {
+			return nil, fmt.Errorf("provider %s needs a base_url", pc.Name)
+		}
+		return openai.NewClient(pc.BaseURL, apiKey, httpClient), nil
+	case TypeAnthropic:
+		return anthropic.NewClient(pc.BaseURL, apiKey, httpClient), nil
+	default:
+		return nil, fmt.Errorf("provider %s has unsupported type %q", pc.Name, pc.Type)
+	}
+}
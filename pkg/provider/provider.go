@@ -0,0 +1,294 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-api/internal/types"
+)
+
+const (
+	// HeaderUpstream is the response header naming the provider and model that served a request
+	HeaderUpstream = "X-Upstream"
+
+	// DefaultFirstByteTimeout is how long a streamed response may take to send its first bytes after its headers
+	DefaultFirstByteTimeout = 30 * time.Second
+)
+
+var (
+	// ErrUnknownModel is returned when a model has no route and there is no default provider
+	ErrUnknownModel = errors.New("unknown model")
+
+	// ErrUpstreamUnavailable is returned when the circuit breaker of every route for a model is open
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+
+	// ErrFirstByteTimeout is returned when a stream sends its headers but no data in time
+	ErrFirstByteTimeout = errors.New("stream sent no data in time")
+)
+
+// Provider is an upstream chat completions backend.
+// Implementations always respond in the OpenAI chat completions format,
+// whether or not the request is streamed.
+type Provider interface {
+	ChatCompletion(ctx context.Context, req *types.ChatRequest) (*http.Response, error)
+}
+
+// Route is the provider and upstream model a requested model resolves to
+type Route struct {
+	// Provider is the configured name of the provider
+	Provider string
+	// Model is the model name sent upstream
+	Model string
+
+	client Provider
+}
+
+// ChatCompletion sends req to the route's provider with the model rewritten to the upstream name
+func (r Route) ChatCompletion(ctx context.Context, req *types.ChatRequest) (*http.Response, error) {
+	upstreamReq := *req
+	upstreamReq.Model = r.Model
+	return r.client.ChatCompletion(ctx, &upstreamReq)
+}
+
+// String returns the route as provider/model, the form used in the X-Upstream header
+func (r Route) String() string {
+	return r.Provider + "/" + r.Model
+}
+
+// Registry maps requested models to providers
+type Registry struct {
+	providers       map[string]Provider
+	models          map[string]ModelConfig
+	defaultProvider string
+	retryPolicy     RetryPolicy
+	firstByte       time.Duration
+
+	breakerConfig   BreakerConfig
+	breakersMutex   sync.Mutex
+	breakers        map[string]*Breaker
+	onBreakerChange func(route Route, from, to BreakerState)
+}
+
+// NewRegistry creates an empty registry. Models without an explicit route
+// are sent to defaultProvider unchanged; leave it empty to reject them.
+func NewRegistry(defaultProvider string) *Registry {
+	return &Registry{
+		providers:       make(map[string]Provider),
+		models:          make(map[string]ModelConfig),
+		defaultProvider: defaultProvider,
+		retryPolicy:     DefaultRetryPolicy(),
+		firstByte:       DefaultFirstByteTimeout,
+		breakerConfig:   DefaultBreakerConfig(),
+		breakers:        make(map[string]*Breaker),
+	}
+}
+
+// SetRetryPolicy sets how transient failures are retried before failing over
+func (r *Registry) SetRetryPolicy(policy RetryPolicy) {
+	r.retryPolicy = policy.withDefaults()
+}
+
+// SetFirstByteTimeout sets how long a streamed response may take to send its
+// first bytes after its headers. Zero uses DefaultFirstByteTimeout.
+func (r *Registry) SetFirstByteTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultFirstByteTimeout
+	}
+	r.firstByte = timeout
+}
+
+// SetBreakerConfig sets the thresholds of circuit breakers created from now on
+func (r *Registry) SetBreakerConfig(config BreakerConfig) {
+	r.breakerConfig = config.withDefaults()
+}
+
+// OnBreakerStateChange registers fn to be called whenever a route's circuit breaker changes state
+func (r *Registry) OnBreakerStateChange(fn func(route Route, from, to BreakerState)) {
+	r.onBreakerChange = fn
+}
+
+// Breaker returns the circuit breaker of a route, creating it on first use
+func (r *Registry) Breaker(route Route) *Breaker {
+	key := route.String()
+
+	r.breakersMutex.Lock()
+	defer r.breakersMutex.Unlock()
+
+	breaker, ok := r.breakers[key]
+	if !ok {
+		var onChange func(from, to BreakerState)
+		if r.onBreakerChange != nil {
+			route := Route{Provider: route.Provider, Model: route.Model}
+			onChange = func(from, to BreakerState) {
+				log.Printf("Circuit breaker for %s changed from %s to %s", route, from, to)
+				r.onBreakerChange(route, from, to)
+			}
+		}
+		breaker = NewBreaker(r.breakerConfig, onChange)
+		r.breakers[key] = breaker
+	}
+
+	return breaker
+}
+
+// Register adds a provider under the given name
+func (r *Registry) Register(name string, p Provider) {
+	r.providers[name] = p
+}
+
+// MapModel routes requests for alias to the given provider and upstream model
+func (r *Registry) MapModel(alias string, model ModelConfig) {
+	r.models[alias] = model
+}
+
+// Resolve returns the routes for the requested model, primary first, followed by its fallbacks
+func (r *Registry) Resolve(model string) ([]Route, error) {
+	m, ok := r.models[model]
+	if !ok {
+		m = ModelConfig{Provider: r.defaultProvider}
+	}
+	if m.Provider == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownModel, model)
+	}
+
+	configs := append([]ModelConfig{m}, m.Fallbacks...)
+	routes := make([]Route, 0, len(configs))
+	for _, mc := range configs {
+		route := Route{Provider: mc.Provider, Model: mc.Model}
+		if route.Model == "" {
+			route.Model = model
+		}
+
+		client, ok := r.providers[route.Provider]
+		if !ok {
+			return nil, fmt.Errorf("model %s is routed to unregistered provider %s", model, route.Provider)
+		}
+		route.client = client
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+// ChatCompletion sends req to the first route for its model that succeeds.
+// Connection errors, 429s and 5xxs are retried with backoff, then the next
+// fallback route is tried. Routes whose circuit breaker is open are skipped,
+// and ErrUpstreamUnavailable is returned if that leaves nothing to try. If
+// every attempted route fails, the last upstream response is returned so its
+// status and body can be passed on, or the last error if there was none.
+// Streamed responses only count as successful once their first bytes have
+// arrived, so a stream that dies or stalls before sending anything still
+// fails over.
+func (r *Registry) ChatCompletion(ctx context.Context, req *types.ChatRequest) (*http.Response, Route, error) {
+	routes, err := r.Resolve(req.Model)
+	if err != nil {
+		return nil, Route{}, err
+	}
+
+	var (
+		lastResp  *http.Response
+		lastErr   error
+		lastRoute Route
+	)
+	for _, route := range routes {
+		breaker := r.Breaker(route)
+
+		for attempt := 1; attempt <= r.retryPolicy.MaxAttempts; attempt++ {
+			if !breaker.Allow() {
+				log.Printf("Circuit breaker for %s is open, skipping", route)
+				if lastResp == nil && lastErr == nil {
+					lastErr, lastRoute = ErrUpstreamUnavailable, route
+				}
+				break
+			}
+
+			if lastResp != nil {
+				lastResp.Body.Close()
+				lastResp = nil
+			}
+
+			resp, err := route.ChatCompletion(ctx, req)
+			if err == nil && resp.StatusCode == http.StatusOK && req.Stream {
+				err = peekBody(resp, r.firstByte)
+				if err != nil {
+					resp = nil
+				}
+			}
+			lastResp, lastErr, lastRoute = resp, err, route
+
+			if ctx.Err() != nil {
+				breaker.Cancel()
+				return resp, route, err
+			}
+			breaker.Record(isUpstreamFailure(resp, err))
+
+			if !isRetryable(resp, err) {
+				return resp, route, err
+			}
+
+			log.Printf("Upstream %s attempt %d failed: %s", route, attempt, describeFailure(resp, err))
+
+			if attempt == r.retryPolicy.MaxAttempts {
+				break
+			}
+			delay, ok := r.retryPolicy.backoff(attempt, resp)
+			if !ok || sleep(ctx, delay) != nil {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if lastResp != nil {
+		return lastResp, lastRoute, nil
+	}
+	return nil, lastRoute, lastErr
+}
+
+// isUpstreamFailure reports whether an attempt counts against the route's circuit breaker.
+// Rate limiting means the upstream is healthy but busy, so only errors and 5xxs count.
+func isUpstreamFailure(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= 500
+}
+
+// peekBody waits up to timeout for the first bytes of a streamed body without
+// consuming them. The body is closed when they don't arrive in time, which
+// unblocks the read.
+func peekBody(resp *http.Response, timeout time.Duration) error {
+	reader := bufio.NewReader(resp.Body)
+	timer := time.AfterFunc(timeout, func() { resp.Body.Close() })
+	_, err := reader.Peek(1)
+	if !timer.Stop() {
+		return fmt.Errorf("%w after %s", ErrFirstByteTimeout, timeout)
+	}
+	if err != nil {
+		resp.Body.Close()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("stream ended before any data: %w", err)
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, resp.Body}
+	return nil
+}
+
+// describeFailure summarizes a failed attempt for logging
+func describeFailure(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return resp.Status
+}
@@ -0,0 +1,121 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-api/internal/types"
+	"go-api/pkg/provider"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeProvider records the last request it received
+type fakeProvider struct {
+	lastModel string
+}
+
+func (f *fakeProvider) ChatCompletion(ctx context.Context, req *types.ChatRequest) (*http.Response, error) {
+	f.lastModel = req.Model
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+var _ = Describe("Registry", func() {
+	var (
+		registry *provider.Registry
+		groq     *fakeProvider
+		local    *fakeProvider
+	)
+
+	BeforeEach(func() {
+		groq = &fakeProvider{}
+		local = &fakeProvider{}
+
+		registry = provider.NewRegistry("groq")
+		registry.Register("groq", groq)
+		registry.Register("ollama", local)
+		registry.MapModel("llama3", provider.ModelConfig{Provider: "ollama", Model: "llama3.1:8b"})
+	})
+
+	It("routes mapped models to their provider and upstream name", func() {
+		routes, err := registry.Resolve("llama3")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(routes).To(HaveLen(1))
+		Expect(routes[0].Provider).To(Equal("ollama"))
+		Expect(routes[0].Model).To(Equal("llama3.1:8b"))
+
+		req := &types.ChatRequest{Model: "llama3"}
+		_, err = routes[0].ChatCompletion(context.Background(), req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(local.lastModel).To(Equal("llama3.1:8b"))
+		Expect(req.Model).To(Equal("llama3"), "the caller's request must not be modified")
+	})
+
+	It("sends unmapped models to the default provider unchanged", func() {
+		routes, err := registry.Resolve("deepseek-r1-distill-llama-70b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(routes[0].Provider).To(Equal("groq"))
+		Expect(routes[0].Model).To(Equal("deepseek-r1-distill-llama-70b"))
+	})
+
+	It("rejects unmapped models when there is no default provider", func() {
+		registry = provider.NewRegistry("")
+		_, err := registry.Resolve("anything")
+		Expect(errors.Is(err, provider.ErrUnknownModel)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Config", func() {
+	It("falls back to Groq when the config file is missing", func() {
+		config, err := provider.LoadConfig(filepath.Join(GinkgoT().TempDir(), "missing.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.DefaultProvider).To(Equal(provider.TypeGroq))
+	})
+
+	It("builds a registry from yaml", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "providers.yaml")
+		Expect(os.WriteFile(path, []byte(`
+default_provider: groq
+providers:
+  - name: groq
+    type: groq
+  - name: vllm
+    type: openai
+    base_url: http://localhost:8000/v1
+models:
+  qwen:
+    provider: vllm
+    model: Qwen/Qwen2.5-7B-Instruct
+`), 0o644)).To(Succeed())
+
+		config, err := provider.LoadConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		registry, err := provider.NewRegistryFromConfig(config, http.DefaultClient)
+		Expect(err).NotTo(HaveOccurred())
+
+		routes, err := registry.Resolve("qwen")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(routes[0].Provider).To(Equal("vllm"))
+		Expect(routes[0].Model).To(Equal("Qwen/Qwen2.5-7B-Instruct"))
+	})
+
+	It("rejects models that refer to unknown providers", func() {
+		config := &provider.Config{
+			Providers: []provider.ProviderConfig{{Name: "groq", Type: provider.TypeGroq}},
+			Models:    map[string]provider.ModelConfig{"x": {Provider: "nope"}},
+		}
+		_, err := provider.NewRegistryFromConfig(config, http.DefaultClient)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+func TestProvider(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Provider Suite")
+}
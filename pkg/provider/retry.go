@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a single route is tried before failing over
+	DefaultMaxAttempts = 3
+
+	// DefaultBaseDelay is the backoff before the first retry
+	DefaultBaseDelay = 250 * time.Millisecond
+
+	// DefaultMaxDelay caps the backoff, including delays asked for by Retry-After
+	DefaultMaxDelay = 5 * time.Second
+)
+
+// RetryPolicy controls how transient upstream failures are retried on the same route
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per route, including the first
+	MaxAttempts int `yaml:"max_attempts"`
+
+	// BaseDelay is doubled after every attempt
+	BaseDelay time.Duration `yaml:"base_delay"`
+
+	// MaxDelay caps the backoff. A Retry-After longer than this skips
+	// straight to the next route instead of waiting.
+	MaxDelay time.Duration `yaml:"max_delay"`
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
+		MaxDelay:    DefaultMaxDelay,
+	}
+}
+
+// withDefaults fills in zero fields from DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaults.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaults.MaxDelay
+	}
+	return p
+}
+
+// backoff returns how long to wait before the given retry (1 for the first retry).
+// It honors Retry-After when the upstream sent one; ok is false if that is longer than MaxDelay.
+func (p RetryPolicy) backoff(retry int, resp *http.Response) (delay time.Duration, ok bool) {
+	if resp != nil {
+		if after, found := retryAfter(resp); found {
+			return after, after <= p.MaxDelay
+		}
+	}
+
+	delay = p.BaseDelay << (retry - 1)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+
+	// Equal jitter: keep half the delay and randomize the rest
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+// retryAfter parses the Retry-After header, in either delay-seconds or HTTP-date form
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		delay := time.Until(at)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// isRetryable reports whether an attempt failed in a way that another attempt might fix
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		// The client went away, trying again won't help
+		return !errors.Is(err, context.Canceled)
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,173 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"go-api/internal/types"
+	"go-api/pkg/provider"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// scriptedProvider replies with the next response or error in its script
+type scriptedProvider struct {
+	script []func() (*http.Response, error)
+	calls  int
+}
+
+func (s *scriptedProvider) ChatCompletion(ctx context.Context, req *types.ChatRequest) (*http.Response, error) {
+	step := s.script[len(s.script)-1]
+	if s.calls < len(s.script) {
+		step = s.script[s.calls]
+	}
+	s.calls++
+	return step()
+}
+
+func respond(status int, body string) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	}
+}
+
+func fail(err error) func() (*http.Response, error) {
+	return func() (*http.Response, error) { return nil, err }
+}
+
+var _ = Describe("Retry and failover", func() {
+	var (
+		registry  *provider.Registry
+		primary   *scriptedProvider
+		secondary *scriptedProvider
+	)
+
+	BeforeEach(func() {
+		primary = &scriptedProvider{}
+		secondary = &scriptedProvider{}
+
+		registry = provider.NewRegistry("")
+		registry.Register("groq", primary)
+		registry.Register("vllm", secondary)
+		registry.MapModel("llama", provider.ModelConfig{
+			Provider:  "groq",
+			Model:     "llama-3.3-70b-versatile",
+			Fallbacks: []provider.ModelConfig{{Provider: "vllm", Model: "meta-llama/Llama-3.3-70B-Instruct"}},
+		})
+		registry.SetRetryPolicy(provider.RetryPolicy{
+			MaxAttempts: 2,
+			BaseDelay:   time.Millisecond,
+			MaxDelay:    10 * time.Millisecond,
+		})
+	})
+
+	It("retries transient failures on the same route", func() {
+		primary.script = append(primary.script, fail(errors.New("connection reset")), respond(http.StatusOK, "{}"))
+
+		resp, route, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(route.String()).To(Equal("groq/llama-3.3-70b-versatile"))
+		Expect(primary.calls).To(Equal(2))
+		Expect(secondary.calls).To(Equal(0))
+	})
+
+	It("fails over once the primary's attempts are used up", func() {
+		primary.script = append(primary.script, respond(http.StatusServiceUnavailable, "down"))
+		secondary.script = append(secondary.script, respond(http.StatusOK, "{}"))
+
+		resp, route, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(route.Provider).To(Equal("vllm"))
+		Expect(primary.calls).To(Equal(2))
+	})
+
+	It("fails over immediately when Retry-After exceeds the max delay", func() {
+		primary.script = append(primary.script, func() (*http.Response, error) {
+			resp, _ := respond(http.StatusTooManyRequests, "slow down")()
+			resp.Header.Set("Retry-After", "60")
+			return resp, nil
+		})
+		secondary.script = append(secondary.script, respond(http.StatusOK, "{}"))
+
+		_, route, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(route.Provider).To(Equal("vllm"))
+		Expect(primary.calls).To(Equal(1))
+	})
+
+	It("passes client errors through without retrying", func() {
+		primary.script = append(primary.script, respond(http.StatusBadRequest, "bad"))
+
+		resp, _, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(primary.calls).To(Equal(1))
+		Expect(secondary.calls).To(Equal(0))
+	})
+
+	It("returns the last upstream response when every route fails", func() {
+		primary.script = append(primary.script, respond(http.StatusBadGateway, "bad gateway"))
+		secondary.script = append(secondary.script, respond(http.StatusServiceUnavailable, "unavailable"))
+
+		resp, route, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(route.Provider).To(Equal("vllm"))
+	})
+
+	It("fails over a stream that ends before sending any data", func() {
+		primary.script = append(primary.script, respond(http.StatusOK, ""))
+		secondary.script = append(secondary.script, respond(http.StatusOK, "data: [DONE]\n\n"))
+
+		resp, route, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama", Stream: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(route.Provider).To(Equal("vllm"))
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("data: [DONE]\n\n"))
+	})
+
+	It("fails over a stream that sends its headers and then stalls", func() {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		DeferCleanup(server.Close)
+		DeferCleanup(func() { close(release) })
+
+		primary.script = append(primary.script, func() (*http.Response, error) {
+			return server.Client().Get(server.URL)
+		})
+		secondary.script = append(secondary.script, respond(http.StatusOK, "data: [DONE]\n\n"))
+		registry.SetFirstByteTimeout(50 * time.Millisecond)
+
+		resp, route, err := registry.ChatCompletion(context.Background(), &types.ChatRequest{Model: "llama", Stream: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(route.Provider).To(Equal("vllm"))
+		Expect(primary.calls).To(Equal(2))
+
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(Equal("data: [DONE]\n\n"))
+	})
+})
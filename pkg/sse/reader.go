@@ -0,0 +1,130 @@
+package sse
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"go-api/internal/types"
+)
+
+// DoneData is the data of the event that ends an OpenAI chat completion stream
+const DoneData = "[DONE]"
+
+// maxLineSize is the longest line the reader accepts
+const maxLineSize = 1024 * 1024
+
+// Event is a single server-sent event
+type Event struct {
+	// Event is the event type, empty for the default "message" type
+	Event string
+	// Data is the event payload, with multiple data lines joined by newlines
+	Data string
+	// ID is the event ID, if any
+	ID string
+}
+
+// Reader reads server-sent events from a stream
+type Reader struct {
+	scanner *bufio.Scanner
+}
+
+// NewReader creates a reader for the event stream r
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next event. It returns io.EOF once the stream ends cleanly
+// and io.ErrUnexpectedEOF if it ends in the middle of an event.
+func (r *Reader) Next() (*Event, error) {
+	var (
+		event   Event
+		data    []string
+		started bool
+	)
+
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+
+		// A blank line dispatches the event
+		if line == "" {
+			if started {
+				event.Data = strings.Join(data, "\n")
+				return &event, nil
+			}
+			continue
+		}
+
+		// Lines starting with a colon are comments, used for keep-alives
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		started = true
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			event.ID = value
+		}
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	if started {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return nil, io.EOF
+}
+
+// ChunkReader reads chat completion chunks from an OpenAI-style event stream
+type ChunkReader struct {
+	events *Reader
+}
+
+// NewChunkReader creates a chunk reader for the event stream r
+func NewChunkReader(r io.Reader) *ChunkReader {
+	return &ChunkReader{events: NewReader(r)}
+}
+
+// Next returns the next chunk along with its raw JSON data, so it can be
+// forwarded without dropping fields the chunk type doesn't know about.
+// It returns io.EOF after the [DONE] event and io.ErrUnexpectedEOF if the
+// stream ends without one.
+func (r *ChunkReader) Next() (*types.ChatCompletionChunk, []byte, error) {
+	for {
+		event, err := r.events.Next()
+		if err == io.EOF {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if event.Data == "" {
+			continue
+		}
+		if event.Data == DoneData {
+			return nil, nil, io.EOF
+		}
+
+		data := []byte(event.Data)
+		var chunk types.ChatCompletionChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return nil, nil, fmt.Errorf("invalid chunk: %w", err)
+		}
+
+		return &chunk, data, nil
+	}
+}
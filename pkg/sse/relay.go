@@ -0,0 +1,84 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"go-api/internal/types"
+)
+
+// DefaultHeartbeatInterval is how long a relayed stream may sit idle before a heartbeat is sent
+const DefaultHeartbeatInterval = 15 * time.Second
+
+// RelayOption configures Relay
+type RelayOption func(*relayOptions)
+
+// relayOptions are what RelayOptions set
+type relayOptions struct {
+	requestID string
+}
+
+// WithRequestID quotes id, the ID of the request being streamed, in the error event
+func WithRequestID(id string) RelayOption {
+	return func(o *relayOptions) {
+		o.requestID = id
+	}
+}
+
+// Relay forwards a chat completion stream from upstream to w one chunk at a
+// time, calling onChunk (if set) for every chunk on the way through. Idle
+// periods are filled with heartbeats. If the upstream stream breaks before
+// [DONE], or ctx's deadline passes, a well-formed error event is sent to the
+// client and the error is returned. If ctx is canceled, the client is gone and
+// nothing more is written.
+func Relay(ctx context.Context, w http.ResponseWriter, upstream io.Reader, heartbeat time.Duration, onChunk func(*types.ChatCompletionChunk), opts ...RelayOption) error {
+	var options relayOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	writer := NewWriter(w)
+	w.WriteHeader(http.StatusOK)
+
+	stop := writer.StartHeartbeat(heartbeat)
+	defer stop()
+
+	chunks := NewChunkReader(upstream)
+	for {
+		chunk, data, err := chunks.Next()
+		if err == io.EOF {
+			return writer.WriteDone()
+		}
+		if err != nil {
+			// Nobody is listening any more, so there's no one to tell. A
+			// deadline that passed, such as the stream's time limit, leaves
+			// the client connected and waiting for the rest.
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return ctx.Err()
+			}
+
+			var errResp types.ErrorResponse
+			errResp.Error.Message = "The upstream stream ended unexpectedly"
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				errResp.Error.Message = "The stream did not finish in time"
+				err = ctx.Err()
+			}
+			errResp.Error.Type = "api_error"
+			errResp.Error.Code = "stream_interrupted"
+			errResp.RequestID = options.requestID
+			writer.WriteJSON(errResp)
+
+			return err
+		}
+
+		if onChunk != nil {
+			onChunk(chunk)
+		}
+		if err := writer.WriteData(data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package sse_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"go-api/internal/types"
+	"go-api/pkg/sse"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const chunkJSON = `{"id":"chatcmpl-1","object":"chat.completion.chunk","model":"llama","choices":[{"index":0,"delta":{"content":"Hi"},"finish_reason":null}],"x_groq":{"id":"req_1"}}`
+
+var _ = Describe("Reader", func() {
+	It("parses multi-line data, event types and ignores comments", func() {
+		reader := sse.NewReader(strings.NewReader(": ping\n\nevent: delta\nid: 7\ndata: line one\ndata: line two\n\ndata: second\n\n"))
+
+		event, err := reader.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.Event).To(Equal("delta"))
+		Expect(event.ID).To(Equal("7"))
+		Expect(event.Data).To(Equal("line one\nline two"))
+
+		event, err = reader.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(event.Data).To(Equal("second"))
+
+		_, err = reader.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+})
+
+var _ = Describe("ChunkReader", func() {
+	It("decodes chunks and stops at [DONE]", func() {
+		reader := sse.NewChunkReader(strings.NewReader("data: " + chunkJSON + "\n\ndata: [DONE]\n\n"))
+
+		chunk, data, err := reader.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chunk.ID).To(Equal("chatcmpl-1"))
+		Expect(chunk.Choices[0].Delta.Content).To(Equal("Hi"))
+		Expect(string(data)).To(Equal(chunkJSON))
+
+		_, _, err = reader.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("reports streams that end without [DONE]", func() {
+		reader := sse.NewChunkReader(strings.NewReader("data: " + chunkJSON + "\n\n"))
+
+		_, _, err := reader.Next()
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = reader.Next()
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+	})
+})
+
+var _ = Describe("Relay", func() {
+	It("forwards chunks unchanged and ends with [DONE]", func() {
+		rec := httptest.NewRecorder()
+		var seen []string
+
+		err := sse.Relay(context.Background(), rec, strings.NewReader("data: "+chunkJSON+"\n\ndata: [DONE]\n\n"), time.Minute,
+			func(chunk *types.ChatCompletionChunk) { seen = append(seen, chunk.Choices[0].Delta.Content) })
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rec.Header().Get("Content-Type")).To(Equal("text/event-stream"))
+		Expect(rec.Flushed).To(BeTrue())
+		Expect(rec.Body.String()).To(Equal("data: " + chunkJSON + "\n\ndata: [DONE]\n\n"))
+		Expect(seen).To(Equal([]string{"Hi"}))
+	})
+
+	It("sends an error event when the upstream dies mid-stream", func() {
+		rec := httptest.NewRecorder()
+
+		err := sse.Relay(context.Background(), rec, strings.NewReader("data: "+chunkJSON+"\n\n"), time.Minute, nil, sse.WithRequestID("req_123"))
+		Expect(err).To(Equal(io.ErrUnexpectedEOF))
+
+		events := strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n")
+		Expect(events).To(HaveLen(2))
+
+		var errResp types.ErrorResponse
+		Expect(json.Unmarshal([]byte(strings.TrimPrefix(events[1], "data: ")), &errResp)).To(Succeed())
+		Expect(errResp.Error.Type).To(Equal("api_error"))
+		Expect(errResp.Error.Code).To(Equal("stream_interrupted"))
+		Expect(errResp.RequestID).To(Equal("req_123"))
+	})
+
+	It("sends an error event when the stream runs out of time", func() {
+		rec := httptest.NewRecorder()
+		pr, pw := io.Pipe()
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		stop := context.AfterFunc(ctx, func() { pw.CloseWithError(ctx.Err()) })
+		defer stop()
+
+		err := sse.Relay(ctx, rec, pr, time.Minute, nil)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+
+		var errResp types.ErrorResponse
+		Expect(json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(rec.Body.String()), "data: ")), &errResp)).To(Succeed())
+		Expect(errResp.Error.Code).To(Equal("stream_interrupted"))
+		Expect(errResp.Error.Message).To(Equal("The stream did not finish in time"))
+	})
+
+	It("writes nothing more once the client is gone", func() {
+		rec := httptest.NewRecorder()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := sse.Relay(ctx, rec, iotest.ErrReader(context.Canceled), time.Minute, nil)
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(rec.Body.String()).To(BeEmpty())
+	})
+
+	It("sends heartbeats while the upstream is idle", func() {
+		rec := httptest.NewRecorder()
+		pr, pw := io.Pipe()
+
+		done := make(chan error)
+		go func() {
+			done <- sse.Relay(context.Background(), rec, pr, 10*time.Millisecond, nil)
+		}()
+
+		time.Sleep(50 * time.Millisecond)
+		pw.Write([]byte("data: [DONE]\n\n"))
+		Expect(<-done).To(Succeed())
+
+		Expect(rec.Body.String()).To(HavePrefix(": ping\n\n"))
+		Expect(rec.Body.String()).To(HaveSuffix("data: [DONE]\n\n"))
+	})
+})
+
+func TestSSE(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SSE Suite")
+}
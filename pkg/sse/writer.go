@@ -0,0 +1,117 @@
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Writer writes server-sent events, flushing after each one so clients see them immediately.
+// It is safe for concurrent use, which lets heartbeats interleave with events.
+type Writer struct {
+	mu        sync.Mutex
+	w         http.ResponseWriter
+	flusher   http.Flusher
+	lastWrite time.Time
+	written   bool
+}
+
+// NewWriter creates an event writer and sets the event stream response headers
+func NewWriter(w http.ResponseWriter) *Writer {
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+
+	flusher, _ := w.(http.Flusher)
+
+	return &Writer{
+		w:         w,
+		flusher:   flusher,
+		lastWrite: time.Now(),
+	}
+}
+
+// WriteData writes a data-only event
+func (w *Writer) WriteData(data []byte) error {
+	return w.write("data: %s\n\n", data)
+}
+
+// WriteJSON writes a data-only event holding the JSON encoding of v
+func (w *Writer) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.WriteData(data)
+}
+
+// WriteDone writes the [DONE] event that ends a chat completion stream
+func (w *Writer) WriteDone() error {
+	return w.WriteData([]byte(DoneData))
+}
+
+// WriteComment writes a comment line, which clients ignore
+func (w *Writer) WriteComment(text string) error {
+	return w.write(": %s\n\n", text)
+}
+
+// Written reports whether anything has been sent to the client yet
+func (w *Writer) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.written
+}
+
+// StartHeartbeat writes a comment whenever nothing has been written for interval,
+// so proxies and clients don't time out idle streams. The returned function stops
+// the heartbeat and waits until it can no longer write.
+func (w *Writer) StartHeartbeat(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(exited)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				w.mu.Lock()
+				idle := now.Sub(w.lastWrite) >= interval
+				w.mu.Unlock()
+				if idle && w.WriteComment("ping") != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-exited
+	}
+}
+
+// write formats and flushes a single event
+func (w *Writer) write(format string, arg interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w.w, format, arg); err != nil {
+		return err
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	w.lastWrite = time.Now()
+	w.written = true
+
+	return nil
+}